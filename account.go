@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+	"github.com/nicholasss/chirpy/internal/mailer"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	defaultDeletionGracePeriod = time.Duration(time.Hour * 24 * 30)
+	accountReaperInterval      = time.Duration(time.Hour * 1)
+
+	// logins older than this are dropped from the login history
+	loginHistoryRetention = time.Duration(time.Hour * 24 * 365)
+	// user agents are cut to this many bytes before they are stored
+	maxLoginUserAgentBytes = 512
+
+	loginMethodPassword  = "password"
+	loginMethodTwoFactor = "two_factor"
+)
+
+// =====
+// TYPES
+// =====
+
+// every field is optional, nil fields are left unchanged
+type UserPatchRequest struct {
+	Email           *string `json:"email"`
+	RawPassword     *string `json:"password"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+type UserDeleteRequest struct {
+	RawPassword string `json:"password"`
+}
+type UserDeleteResponse struct {
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+// removes accounts once their deletion grace period has passed, and purges old data, every accountReaperInterval
+type accountReaperJob struct{}
+
+func (accountReaperJob) Kind() string { return "accounts.reap" }
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// reads ACCOUNT_DELETION_GRACE_PERIOD (e.g. '720h'), falling back to 30 days
+func deletionGracePeriodFromEnv() (time.Duration, error) {
+	raw := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")
+	if raw == "" {
+		return defaultDeletionGracePeriod, nil
+	}
+
+	gracePeriod, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("ACCOUNT_DELETION_GRACE_PERIOD: %w", err)
+	}
+	if gracePeriod < 0 {
+		return 0, errors.New("ACCOUNT_DELETION_GRACE_PERIOD: must not be negative")
+	}
+
+	return gracePeriod, nil
+}
+
+// logging back in cancels a pending account deletion
+// a failure here should not block the login
+func (cfg *apiConfig) cancelPendingDeletion(ctx context.Context, userID uuid.UUID) {
+	cancelled, err := cfg.db.CancelUserDeletion(ctx, userID)
+	if err != nil {
+		log.Printf("Unable to cancel pending deletion for '%s': %s", userID, err)
+		return
+	}
+
+	if cancelled > 0 {
+		log.Printf("Cancelled pending deletion for user '%s'.", userID)
+	}
+}
+
+// deletes every user whose grace period has passed
+// their chirps, tokens and other records are removed by the cascading foreign keys
+// stored media is not, so it is deleted first
+func (cfg *apiConfig) reapDeletedUsers(ctx context.Context) {
+	attachments, err := cfg.db.ListAttachmentsOfUsersDueForDeletion(ctx)
+	if err != nil {
+		log.Printf("Unable to list media of users due for deletion: %s", err)
+		return
+	}
+	cfg.deleteAttachments(ctx, attachments)
+
+	deleted, err := cfg.db.DeleteUsersDueForDeletion(ctx)
+	if err != nil {
+		log.Printf("Unable to delete users due for deletion: %s", err)
+		return
+	}
+
+	if deleted > 0 {
+		log.Printf("Deleted %d users after their grace period.", deleted)
+	}
+}
+
+// deletes data export archives that are past their retention
+func (cfg *apiConfig) purgeExpiredExports(ctx context.Context) {
+	deleted, err := cfg.db.DeleteExpiredDataExports(ctx)
+	if err != nil {
+		log.Printf("Unable to delete expired data exports: %s", err)
+		return
+	}
+
+	if deleted > 0 {
+		log.Printf("Deleted %d expired data exports.", deleted)
+	}
+}
+
+// adds the login to the user's login history
+// a failure here should not block the login
+func (cfg *apiConfig) recordLogin(r *http.Request, userID uuid.UUID, method string) {
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ipAddress = r.RemoteAddr
+	}
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxLoginUserAgentBytes {
+		userAgent = strings.ToValidUTF8(userAgent[:maxLoginUserAgentBytes], "")
+	}
+
+	err = cfg.db.CreateLoginEvent(r.Context(), database.CreateLoginEventParams{
+		UserID:    userID,
+		Method:    method,
+		IpAddress: ipAddress,
+		UserAgent: userAgent,
+	})
+	if err != nil {
+		log.Printf("Unable to record login of user '%s': %s", userID, err)
+	}
+}
+
+// drops logins older than the login history is kept for
+func (cfg *apiConfig) purgeLoginHistory(ctx context.Context) {
+	deleted, err := cfg.db.DeleteLoginEventsBefore(ctx, time.Now().UTC().Add(-loginHistoryRetention))
+	if err != nil {
+		log.Printf("Unable to delete old login history: %s", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d old logins from the login history.", deleted)
+	}
+}
+
+// runs the account cleanup, each step logs its own failures so the rest still run
+func (cfg *apiConfig) reapAccounts(ctx context.Context, job accountReaperJob) error {
+	cfg.reapDeletedUsers(ctx)
+	cfg.purgeExpiredExports(ctx)
+	cfg.purgeUnattachedMedia(ctx)
+	cfg.purgeWebhookNonces(ctx)
+	cfg.purgeFinishedJobs(ctx)
+	cfg.purgeDeletedChirps(ctx)
+	cfg.purgeLoginHistory(ctx)
+
+	return nil
+}
+
+// reports if the error is a postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// partially updates the user
+// changing the email or password requires the current password,
+// a new email must be verified again and a new password revokes every other session
+func (cfg *apiConfig) handlerPatchUser(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeUsersWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	var patchRequest UserPatchRequest
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&patchRequest)
+	if err != nil {
+		log.Printf("Error decoding patch user request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	if patchRequest.Email == nil && patchRequest.RawPassword == nil {
+		respondWithError(w, http.StatusBadRequest, "No fields to update.")
+		return
+	}
+
+	// re-authentication is done with the password, which third-party clients never see
+	_, err = cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Sensitive user update attempted with a third-party token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	unsafeUserRecord, err := cfg.db.GetUserByIDRetHashedPassword(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error getting user record by id: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	_, err = auth.CheckPasswordHash(patchRequest.CurrentPassword, unsafeUserRecord.HashedPassword)
+	if err != nil {
+		log.Printf("User update with wrong current password attempted for '%s'", unsafeUserRecord.ID)
+		respondWithError(w, http.StatusUnauthorized, "Current password is incorrect.")
+		return
+	}
+	patchRequest.CurrentPassword = ""
+
+	oldEmail := unsafeUserRecord.Email
+	newEmail := oldEmail
+	emailChanged := false
+	if patchRequest.Email != nil {
+		newEmail = strings.TrimSpace(*patchRequest.Email)
+		if newEmail == "" {
+			respondWithError(w, http.StatusBadRequest, "Email cannot be empty.")
+			return
+		}
+		emailChanged = newEmail != oldEmail
+	}
+
+	newHashedPassword := ""
+	passwordChanged := patchRequest.RawPassword != nil
+	if passwordChanged {
+		if !cfg.enforcePasswordPolicy(w, *patchRequest.RawPassword, newEmail) {
+			return
+		}
+
+		newHashedPassword, err = auth.HashPassword(*patchRequest.RawPassword)
+		if err != nil {
+			log.Printf("Error hashing provided password: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		patchRequest.RawPassword = nil
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if emailChanged {
+		_, err = qtx.UpdateUserEmail(r.Context(), database.UpdateUserEmailParams{
+			ID:    unsafeUserRecord.ID,
+			Email: newEmail,
+		})
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "Email is already in use.")
+			return
+		}
+		if err != nil {
+			log.Printf("Error updating email for '%s': %s", unsafeUserRecord.ID, err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+
+		// let the old address know, in case the change was not made by its owner
+		err = cfg.sendMail(r.Context(), qtx, mailer.Message{
+			To:      oldEmail,
+			Subject: "Your Chirpy email was changed",
+			Body: "The email on your Chirpy account was changed to " + newEmail + ".\n\n" +
+				"If you did not make this change, please reset your password.",
+		})
+		if err != nil {
+			log.Printf("Error queueing email change notice for '%s': %s", unsafeUserRecord.ID, err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+	}
+
+	if passwordChanged {
+		err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:             unsafeUserRecord.ID,
+			HashedPassword: newHashedPassword,
+		})
+		if err != nil {
+			log.Printf("Error updating password for '%s': %s", unsafeUserRecord.ID, err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+
+		// the current session gets new tokens below
+		err = qtx.RevokeAllRefreshTokensByUserID(r.Context(), unsafeUserRecord.ID)
+		if err != nil {
+			log.Printf("Error revoking refresh tokens for '%s': %s", unsafeUserRecord.ID, err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing user update: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	if emailChanged {
+		err = cfg.sendVerificationEmail(r.Context(), unsafeUserRecord.ID, newEmail)
+		if err != nil {
+			log.Printf("Error sending verification email: %s", err)
+		}
+
+	}
+
+	// the access token is still valid, so only a password change needs new tokens
+	if passwordChanged {
+		loginResponseRecord, err := cfg.issueLoginTokens(r, unsafeUserRecord.ID)
+		if err != nil {
+			log.Printf("Error issuing login tokens: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+
+		log.Printf("Updated user '%s', other sessions were revoked.", unsafeUserRecord.ID)
+		respondWithJSON(w, http.StatusOK, loginResponseRecord)
+		return
+	}
+
+	safeUserRecord, err := cfg.db.GetUserByIDSafe(r.Context(), unsafeUserRecord.ID)
+	if err != nil {
+		log.Printf("Error getting updated user record: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("Updated user '%s'.", unsafeUserRecord.ID)
+	respondWithJSON(w, http.StatusOK, UserLoginResponse{
+		ID:            safeUserRecord.ID,
+		CreatedAt:     safeUserRecord.CreatedAt,
+		UpdatedAt:     safeUserRecord.UpdatedAt,
+		Email:         safeUserRecord.Email,
+		EmailVerified: safeUserRecord.EmailVerified,
+		IsChirpyRed:   safeUserRecord.IsChirpyRed,
+		AccessToken:   "",
+		RefreshToken:  "",
+	})
+}
+
+// schedules the user to be deleted after the grace period
+// every refresh token is revoked right away, and the user's chirps are hidden until then
+func (cfg *apiConfig) handlerDeleteUser(w http.ResponseWriter, r *http.Request) {
+	// only the user can delete their account, not third-party clients
+	tokenUUID, err := cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	var deleteRequest UserDeleteRequest
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&deleteRequest)
+	if err != nil {
+		log.Printf("Error decoding delete user request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	unsafeUserRecord, err := cfg.db.GetUserByIDRetHashedPassword(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error getting user record by id: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	_, err = auth.CheckPasswordHash(deleteRequest.RawPassword, unsafeUserRecord.HashedPassword)
+	if err != nil {
+		log.Printf("User deletion with wrong password attempted for '%s'", unsafeUserRecord.ID)
+		respondWithError(w, http.StatusUnauthorized, "Password is incorrect.")
+		return
+	}
+	deleteRequest.RawPassword = ""
+
+	// asking again does not push the deletion back
+	if unsafeUserRecord.DeleteAfter.Valid {
+		respondWithJSON(w, http.StatusAccepted, UserDeleteResponse{
+			DeleteAfter: unsafeUserRecord.DeleteAfter.Time,
+		})
+		return
+	}
+
+	deleteAfter := time.Now().UTC().Add(cfg.deletionGrace)
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+		ID:          unsafeUserRecord.ID,
+		DeleteAfter: sql.NullTime{Time: deleteAfter, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error scheduling deletion for '%s': %s", unsafeUserRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = qtx.RevokeAllRefreshTokensByUserID(r.Context(), unsafeUserRecord.ID)
+	if err != nil {
+		log.Printf("Error revoking refresh tokens for '%s': %s", unsafeUserRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = cfg.sendMail(r.Context(), qtx, mailer.Message{
+		To:      unsafeUserRecord.Email,
+		Subject: "Your Chirpy account will be deleted",
+		Body: "Your Chirpy account will be deleted on " + deleteAfter.Format(time.RFC1123) + ".\n\n" +
+			"Changed your mind? Log back in before then to keep your account.",
+	})
+	if err != nil {
+		log.Printf("Error queueing deletion email for '%s': %s", unsafeUserRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing user deletion: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("Scheduled user '%s' for deletion after %s.", unsafeUserRecord.ID, deleteAfter)
+	respondWithJSON(w, http.StatusAccepted, UserDeleteResponse{
+		DeleteAfter: deleteAfter,
+	})
+}
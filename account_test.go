@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/nicholasss/chirpy/internal/auth"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	var tests = []struct {
+		err      error
+		expected bool
+	}{
+		{&pq.Error{Code: "23505"}, true},
+		{&pq.Error{Code: "23503"}, false},
+		{errors.New("23505"), false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		actual := isUniqueViolation(test.err)
+		if actual != test.expected {
+			t.Errorf("Error '%v', expected: %t, Got: %t", test.err, test.expected, actual)
+		}
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerPatchUserRejects(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	userID := uuid.New()
+
+	firstParty, err := auth.MakeJWT(userID, cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+	thirdParty, err := auth.MakeScopedJWT(userID, uuid.New(), auth.ScopeUsersWrite, cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+
+	var tests = []struct {
+		token        string
+		body         string
+		expectedCode int
+	}{
+		{"", `{"email":"new@example.com"}`, http.StatusUnauthorized},
+		{firstParty, `not json`, http.StatusBadRequest},
+		{firstParty, `{}`, http.StatusBadRequest},
+		{firstParty, `{"current_password":"hunter2"}`, http.StatusBadRequest},
+		{thirdParty, `{"email":"new@example.com","current_password":"hunter2"}`, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(test.body))
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+
+		cfg.handlerPatchUser(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Body '%s', expected: %d, Got: %d", test.body, test.expectedCode, actualCode)
+		}
+	}
+}
+
+func TestAuthenticateRequestPendingDeletion(t *testing.T) {
+	pendingUserID := uuid.New()
+	activeUserID := uuid.New()
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{pendingUserID: true}}
+
+	var tests = []struct {
+		userID    uuid.UUID
+		expectErr bool
+	}{
+		{activeUserID, false},
+		{pendingUserID, true},
+	}
+
+	for _, test := range tests {
+		token, err := auth.MakeJWT(test.userID, cfg.jwtSecret, time.Minute)
+		if err != nil {
+			t.Fatalf("unable to create JWT: %s", err)
+		}
+		r := httptest.NewRequest(http.MethodGet, "/api/users/me", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		_, err = cfg.authenticateRequest(r, "")
+		if (err != nil) != test.expectErr {
+			t.Errorf("User '%s', expected error: %t, Got: '%v'", test.userID, test.expectErr, err)
+		}
+	}
+}
+
+func TestDeletionGracePeriodFromEnv(t *testing.T) {
+	var tests = []struct {
+		input     string
+		expected  time.Duration
+		expectErr bool
+	}{
+		{"", defaultDeletionGracePeriod, false},
+		{"168h", time.Hour * 168, false},
+		{"0s", 0, false},
+		{"-1h", 0, true},
+		{"a week", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Setenv("ACCOUNT_DELETION_GRACE_PERIOD", test.input)
+
+		actual, err := deletionGracePeriodFromEnv()
+		if (err != nil) != test.expectErr {
+			t.Errorf("Input '%s', expected error: %t, Got: '%v'", test.input, test.expectErr, err)
+		}
+		if err == nil && actual != test.expected {
+			t.Errorf("Expected '%s', received '%s'", test.expected, actual)
+		}
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerDeleteUserRejects(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	userID := uuid.New()
+
+	firstParty, err := auth.MakeJWT(userID, cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+	thirdParty, err := auth.MakeScopedJWT(userID, uuid.New(), auth.ScopeUsersWrite, cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+
+	var tests = []struct {
+		token        string
+		body         string
+		expectedCode int
+	}{
+		{"", `{"password":"hunter2"}`, http.StatusUnauthorized},
+		{thirdParty, `{"password":"hunter2"}`, http.StatusForbidden},
+		{firstParty, `not json`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodDelete, "/api/users/me", strings.NewReader(test.body))
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+
+		cfg.handlerDeleteUser(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Body '%s', expected: %d, Got: %d", test.body, test.expectedCode, actualCode)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/blobstore"
+	"github.com/nicholasss/chirpy/internal/database"
+	"github.com/nicholasss/chirpy/internal/jobs"
+	"github.com/nicholasss/chirpy/internal/media"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	defaultMediaMaxBytes = 5 << 20
+	defaultMediaDir      = "media"
+	// room for the multipart boundaries and headers around the file
+	mediaMultipartOverhead = 64 << 10
+	// longest side of a stored image, larger images are scaled down
+	mediaMaxDimension = 2048
+	// uploads not attached to a chirp within this time are deleted
+	unattachedMediaExpiry = time.Duration(time.Hour * 24)
+	// stored media never changes, a new upload always gets a new key
+	mediaCacheControl = "public, max-age=31536000, immutable"
+	// the original served in place of a thumbnail that is not made yet, must not be cached under the thumbnail's url
+	mediaFallbackCacheControl = "no-cache"
+)
+
+// ================
+// GLOBAL VARIABLES
+// ================
+
+var errMediaTooLarge = errors.New("media is too large")
+
+// =====
+// TYPES
+// =====
+
+type MediaResponse struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	Width       int32     `json:"width"`
+	Height      int32     `json:"height"`
+	// smaller versions, which may still be being made for new uploads
+	Variants []MediaVariantResponse `json:"variants"`
+}
+
+// tells if stored media belongs to a deleted chirp, *database.Queries outside of tests
+type deletedMediaChecker interface {
+	IsMediaOfDeletedChirp(ctx context.Context, storageKey string) (bool, error)
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// reads BLOB_STORE, 'local' (default) or 's3', and the settings for that store
+func blobStoreFromEnv() (blobstore.BlobStore, error) {
+	switch os.Getenv("BLOB_STORE") {
+	case "local", "":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = defaultMediaDir
+		}
+		return blobstore.NewLocalStore(dir)
+
+	case "s3":
+		pathStyle, _ := strconv.ParseBool(os.Getenv("S3_PATH_STYLE"))
+		return blobstore.NewS3Store(blobstore.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       pathStyle,
+		}, nil)
+
+	default:
+		return nil, fmt.Errorf("unknown blob store '%s'", os.Getenv("BLOB_STORE"))
+	}
+}
+
+// reads MEDIA_MAX_BYTES, falling back to 5 MiB
+func mediaMaxBytesFromEnv() (int64, error) {
+	raw := os.Getenv("MEDIA_MAX_BYTES")
+	if raw == "" {
+		return defaultMediaMaxBytes, nil
+	}
+
+	maxBytes, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("MEDIA_MAX_BYTES: %w", err)
+	}
+	if maxBytes <= 0 {
+		return 0, errors.New("MEDIA_MAX_BYTES: must be positive")
+	}
+
+	return maxBytes, nil
+}
+
+// reads the named file field from a multipart form, without holding the rest of the form in memory
+func readMultipartFile(r *http.Request, field string, maxBytes int64) ([]byte, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("missing '%s' field", field)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() != field {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > maxBytes {
+			return nil, errMediaTooLarge
+		}
+
+		return data, nil
+	}
+}
+
+// removes duplicates, keeping the order the client gave
+func parseMediaIDs(mediaIDs []uuid.UUID, maxAttachments int) ([]uuid.UUID, error) {
+	unique := make([]uuid.UUID, 0, len(mediaIDs))
+	seen := make(map[uuid.UUID]bool)
+	for _, mediaID := range mediaIDs {
+		if seen[mediaID] {
+			continue
+		}
+		seen[mediaID] = true
+		unique = append(unique, mediaID)
+	}
+
+	if len(unique) > maxAttachments {
+		return nil, fmt.Errorf("a chirp can have at most %d attachments", maxAttachments)
+	}
+
+	return unique, nil
+}
+
+func (cfg *apiConfig) mediaURL(storageKey string) string {
+	return cfg.publicBaseURL + "/media/" + storageKey
+}
+
+func (cfg *apiConfig) newMediaResponse(attachment database.Attachment, variants []database.AttachmentVariant) MediaResponse {
+	variantResponses := make([]MediaVariantResponse, 0, len(variants))
+	for _, variant := range variants {
+		variantResponses = append(variantResponses, cfg.newMediaVariantResponse(variant))
+	}
+
+	return MediaResponse{
+		ID:          attachment.ID,
+		CreatedAt:   attachment.CreatedAt,
+		URL:         cfg.mediaURL(attachment.StorageKey),
+		ContentType: attachment.ContentType,
+		SizeBytes:   attachment.SizeBytes,
+		Width:       attachment.Width,
+		Height:      attachment.Height,
+		Variants:    variantResponses,
+	}
+}
+
+// groups the variants of the attachments by attachment id
+func (cfg *apiConfig) variantsByAttachment(ctx context.Context, attachments []database.Attachment) (map[uuid.UUID][]database.AttachmentVariant, error) {
+	attachmentIDs := make([]uuid.UUID, 0, len(attachments))
+	for _, attachment := range attachments {
+		attachmentIDs = append(attachmentIDs, attachment.ID)
+	}
+
+	variants, err := cfg.db.ListAttachmentVariantsByAttachmentIDs(ctx, attachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byAttachment := make(map[uuid.UUID][]database.AttachmentVariant)
+	for _, variant := range variants {
+		byAttachment[variant.AttachmentID] = append(byAttachment[variant.AttachmentID], variant)
+	}
+
+	return byAttachment, nil
+}
+
+// adds the attachments and link previews to each chirp, looked up for all the chirps at once
+func (cfg *apiConfig) newChirpResponses(ctx context.Context, chirpRecords []database.Chirp) ([]ChirpResponse, error) {
+	chirpIDs := make([]uuid.UUID, 0, len(chirpRecords))
+	for _, chirpRecord := range chirpRecords {
+		chirpIDs = append(chirpIDs, chirpRecord.ID)
+	}
+
+	attachments, err := cfg.db.ListAttachmentsByChirpIDs(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := cfg.variantsByAttachment(ctx, attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	linkPreviews, err := cfg.linkPreviewsByChirp(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byChirp := make(map[uuid.UUID][]MediaResponse)
+	for _, attachment := range attachments {
+		mediaResponse := cfg.newMediaResponse(attachment, variants[attachment.ID])
+		byChirp[attachment.ChirpID.UUID] = append(byChirp[attachment.ChirpID.UUID], mediaResponse)
+	}
+
+	responses := make([]ChirpResponse, 0, len(chirpRecords))
+	for _, chirpRecord := range chirpRecords {
+		chirpAttachments := byChirp[chirpRecord.ID]
+		if chirpAttachments == nil {
+			chirpAttachments = make([]MediaResponse, 0)
+		}
+		chirpLinkPreviews := linkPreviews[chirpRecord.ID]
+		if chirpLinkPreviews == nil {
+			chirpLinkPreviews = make([]LinkPreviewResponse, 0)
+		}
+		responses = append(responses, ChirpResponse{
+			Chirp:        chirpRecord,
+			Attachments:  chirpAttachments,
+			LinkPreviews: chirpLinkPreviews,
+		})
+	}
+
+	return responses, nil
+}
+
+// saves the attachment's record and enqueues making its thumbnails, with the queries of the caller's transaction
+func createAttachment(ctx context.Context, q *database.Queries, params database.CreateAttachmentParams) (database.Attachment, error) {
+	attachment, err := q.CreateAttachment(ctx, params)
+	if err != nil {
+		return database.Attachment{}, err
+	}
+
+	_, err = jobs.Enqueue(ctx, q, thumbnailJob{AttachmentID: attachment.ID}, jobs.Options{})
+	if err != nil {
+		return database.Attachment{}, err
+	}
+
+	return attachment, nil
+}
+
+// deletes the blobs of each attachment and its variants, then its record
+// a record is kept when a blob could not be deleted, so it is tried again later
+func (cfg *apiConfig) deleteAttachments(ctx context.Context, attachments []database.Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+
+	variants, err := cfg.variantsByAttachment(ctx, attachments)
+	if err != nil {
+		log.Printf("Unable to list attachment variants: %s", err)
+		return
+	}
+
+	for _, attachment := range attachments {
+		storageKeys := []string{attachment.StorageKey}
+		for _, variant := range variants[attachment.ID] {
+			storageKeys = append(storageKeys, variant.StorageKey)
+		}
+
+		deleted := true
+		for _, storageKey := range storageKeys {
+			err := cfg.blobs.Delete(ctx, storageKey)
+			if err != nil {
+				log.Printf("Unable to delete blob '%s': %s", storageKey, err)
+				deleted = false
+			}
+		}
+		if !deleted {
+			continue
+		}
+
+		err := cfg.db.DeleteAttachmentByID(ctx, attachment.ID)
+		if err != nil {
+			log.Printf("Unable to delete attachment '%s': %s", attachment.ID, err)
+		}
+	}
+}
+
+// deletes uploads that were never attached to a chirp, and attachments left behind by purged chirps
+func (cfg *apiConfig) purgeUnattachedMedia(ctx context.Context) {
+	attachments, err := cfg.db.ListUnattachedAttachments(ctx, time.Now().UTC().Add(-unattachedMediaExpiry))
+	if err != nil {
+		log.Printf("Unable to list unattached media: %s", err)
+		return
+	}
+
+	cfg.deleteAttachments(ctx, attachments)
+	if len(attachments) > 0 {
+		log.Printf("Purged %d unattached media uploads.", len(attachments))
+	}
+}
+
+// writes the blob as the response, with headers for caching it forever
+// returns an error, and writes nothing, when the blob can not be read
+func (cfg *apiConfig) serveBlob(w http.ResponseWriter, r *http.Request, storageKey, cacheControl string) error {
+	reader, info, err := cfg.blobs.Get(r.Context(), storageKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	etag := `"` + storageKey + `"`
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+	// stops browsers treating an upload as anything but the sniffed image type
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+
+	// files on disk support range and conditional requests
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", info.ModTime, seeker)
+		return nil
+	}
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.Copy(w, reader)
+	}
+
+	return nil
+}
+
+// =============
+// HANDLER TYPES
+// =============
+
+// serves stored media like the file server serves /app/
+// keys are never reused, so responses can be cached forever
+// media of deleted chirps is not served, but kept until the chirp is purged in case it is restored
+func (cfg *apiConfig) handlerMedia(path string, deleted deletedMediaChecker) http.Handler {
+	serveBlob := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storageKey := r.URL.Path
+		if blobstore.ValidateKey(storageKey) != nil {
+			respondWithError(w, http.StatusNotFound, "Media not found.")
+			return
+		}
+
+		isDeleted, err := deleted.IsMediaOfDeletedChirp(r.Context(), storageKey)
+		if err != nil {
+			log.Printf("Unable to check blob '%s': %s", storageKey, err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		if isDeleted {
+			respondWithError(w, http.StatusNotFound, "Media not found.")
+			return
+		}
+
+		err = cfg.serveBlob(w, r, storageKey, mediaCacheControl)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Media not found.")
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to get blob '%s': %s", storageKey, err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+	})
+
+	return http.StripPrefix(path, serveBlob)
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// uploads an image to attach to a later chirp
+// the type is sniffed from the content, and the image is re-encoded to remove its metadata
+func (cfg *apiConfig) handlerUploadMedia(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.mediaMaxBytes+mediaMultipartOverhead)
+	data, err := readMultipartFile(r, "file", cfg.mediaMaxBytes)
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, errMediaTooLarge) || errors.As(err, &maxBytesErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Media must be at most %d bytes.", cfg.mediaMaxBytes))
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading media upload: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Request must be multipart/form-data with a 'file' field.")
+		return
+	}
+
+	if !media.IsSupported(media.Sniff(data)) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Media must be a jpeg, png or gif image.")
+		return
+	}
+
+	processed, err := media.Process(data, mediaMaxDimension)
+	if errors.Is(err, media.ErrTooManyPixels) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Image dimensions are too large.")
+		return
+	}
+	if errors.Is(err, media.ErrTooManyFrames) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Animations can have at most %d frames.", media.MaxGIFFrames))
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to process media upload: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid image.")
+		return
+	}
+
+	// the upload is checked first, so a bad file is reported even when over the limit
+	entitlements, err := cfg.db.GetEntitlementsByUserID(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error getting entitlements of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	// the upload is counted towards the rate limit and saved together
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	allowed, err := canUploadMedia(r.Context(), qtx, tokenUUID, entitlements)
+	if err != nil {
+		log.Printf("Error counting recent uploads of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusTooManyRequests, "Too many uploads, please try again later.")
+		return
+	}
+
+	attachmentID := uuid.New()
+	storageKey := attachmentID.String() + media.Extension(processed.ContentType)
+	err = cfg.blobs.Put(r.Context(), storageKey, bytes.NewReader(processed.Data), int64(len(processed.Data)), processed.ContentType)
+	if err != nil {
+		log.Printf("Unable to store blob '%s': %s", storageKey, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	// the thumbnails are only made once the attachment is saved
+	attachment, err := createAttachment(r.Context(), qtx, database.CreateAttachmentParams{
+		ID:          attachmentID,
+		UserID:      tokenUUID,
+		StorageKey:  storageKey,
+		ContentType: processed.ContentType,
+		SizeBytes:   int64(len(processed.Data)),
+		Width:       int32(processed.Width),
+		Height:      int32(processed.Height),
+	})
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Unable to create attachment record: %s", err)
+		cfg.blobs.Delete(r.Context(), storageKey)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("Stored %d byte %s upload '%s' for user '%s'.", attachment.SizeBytes, attachment.ContentType, attachment.ID, tokenUUID)
+	respondWithJSON(w, http.StatusCreated, cfg.newMediaResponse(attachment, nil))
+}
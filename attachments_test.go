@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/blobstore"
+)
+
+// storage keys of media belonging to deleted chirps
+type fakeDeletedMedia map[string]bool
+
+func (f fakeDeletedMedia) IsMediaOfDeletedChirp(ctx context.Context, storageKey string) (bool, error) {
+	return f[storageKey], nil
+}
+
+// builds a multipart upload request with the data in the named field
+func newUploadRequest(t *testing.T, field string, data []byte) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile(field, "upload.bin")
+	if err != nil {
+		t.Fatalf("unable to create form file: %s", err)
+	}
+	part.Write(data)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/media", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestParseMediaIDs(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+
+	received, err := parseMediaIDs([]uuid.UUID{a, b, a}, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(received) != 2 || received[0] != a || received[1] != b {
+		t.Errorf("Expected '%v', received '%v'", []uuid.UUID{a, b}, received)
+	}
+
+	tooMany := make([]uuid.UUID, 5)
+	for i := range tooMany {
+		tooMany[i] = uuid.New()
+	}
+	_, err = parseMediaIDs(tooMany, 4)
+	if err == nil {
+		t.Errorf("Expected an error for %d attachments", len(tooMany))
+	}
+}
+
+func TestReadMultipartFile(t *testing.T) {
+	tests := []struct {
+		field     string
+		data      []byte
+		maxBytes  int64
+		expectErr bool
+	}{
+		{"file", []byte("hello"), 10, false},
+		{"file", []byte("hello"), 5, false},
+		{"file", []byte("hello!"), 5, true},
+		{"other", []byte("hello"), 10, true},
+	}
+
+	for _, test := range tests {
+		received, err := readMultipartFile(newUploadRequest(t, test.field, test.data), "file", test.maxBytes)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Expected error: %t, received: %v", test.expectErr, err)
+			continue
+		}
+		if err == nil && !bytes.Equal(received, test.data) {
+			t.Errorf("Expected '%s', received '%s'", test.data, received)
+		}
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerUploadMediaRejects(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}, mediaMaxBytes: 1024}
+	token, err := auth.MakeJWT(uuid.New(), cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("unable to make token: %s", err)
+	}
+
+	tests := []struct {
+		name         string
+		token        string
+		data         []byte
+		expectedCode int
+	}{
+		{"no token", "", []byte("GIF89a"), http.StatusUnauthorized},
+		{"too large", token, bytes.Repeat([]byte("a"), 2048), http.StatusRequestEntityTooLarge},
+		{"html", token, []byte("<html><script>alert(1)</script></html>"), http.StatusUnsupportedMediaType},
+		{"svg", token, []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), http.StatusUnsupportedMediaType},
+		{"broken png", token, []byte("\x89PNG\r\n\x1a\nbroken"), http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req := newUploadRequest(t, "file", test.data)
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+
+		cfg.handlerUploadMedia(w, req)
+		_, code := readResponse(w, t)
+		if code != test.expectedCode {
+			t.Errorf("%s: Expected: %d, Got: %d", test.name, test.expectedCode, code)
+		}
+	}
+}
+
+func TestHandlerMedia(t *testing.T) {
+	store, err := blobstore.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unable to create store: %s", err)
+	}
+	cfg := apiConfig{blobs: store}
+
+	imageData := &bytes.Buffer{}
+	png.Encode(imageData, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	err = store.Put(context.Background(), "abc.png", bytes.NewReader(imageData.Bytes()), int64(imageData.Len()), "image/png")
+	if err != nil {
+		t.Fatalf("unable to put blob: %s", err)
+	}
+
+	handler := cfg.handlerMedia("/media/", fakeDeletedMedia{"hidden.png": true})
+
+	req := httptest.NewRequest(http.MethodGet, "/media/abc.png", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	body, code := readResponse(w, t)
+	if code != http.StatusOK {
+		t.Fatalf("Expected: %d, Got: %d", http.StatusOK, code)
+	}
+	if body != imageData.String() {
+		t.Errorf("Expected the stored image to be served")
+	}
+	for header, expected := range map[string]string{
+		"Content-Type":           "image/png",
+		"Cache-Control":          mediaCacheControl,
+		"ETag":                   `"abc.png"`,
+		"X-Content-Type-Options": "nosniff",
+	} {
+		received := w.Result().Header.Get(header)
+		if received != expected {
+			t.Errorf("%s: Expected '%s', received '%s'", header, expected, received)
+		}
+	}
+
+	// cached copies are revalidated by etag
+	req = httptest.NewRequest(http.MethodGet, "/media/abc.png", nil)
+	req.Header.Set("If-None-Match", `"abc.png"`)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	_, code = readResponse(w, t)
+	if code != http.StatusNotModified {
+		t.Errorf("Expected: %d, Got: %d", http.StatusNotModified, code)
+	}
+
+	// the blob of a deleted chirp is still stored, but not served
+	err = store.Put(context.Background(), "hidden.png", bytes.NewReader(imageData.Bytes()), int64(imageData.Len()), "image/png")
+	if err != nil {
+		t.Fatalf("unable to put blob: %s", err)
+	}
+
+	for _, path := range []string{"/media/missing.png", "/media/hidden.png", "/media/../main.go", "/media/a%20b.png"} {
+		req = httptest.NewRequest(http.MethodGet, "/media/", nil)
+		req.URL.Path = strings.ReplaceAll(path, "%20", " ")
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		_, code = readResponse(w, t)
+		if code != http.StatusNotFound {
+			t.Errorf("%s: Expected: %d, Got: %d", path, http.StatusNotFound, code)
+		}
+	}
+}
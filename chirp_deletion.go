@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	// how long a deleted chirp is kept as a tombstone, before it is purged for good
+	defaultDeletedChirpRetentionDays = 30
+	// replies further up a thread than this are left out
+	maxThreadDepth = 100
+)
+
+// =====
+// TYPES
+// =====
+
+// what is shown of a chirp in a thread once it is deleted, or its author's account is being deleted
+// the body and author are left out, replies to it still point at its id
+type ChirpTombstone struct {
+	ID        uuid.UUID     `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	InReplyTo uuid.NullUUID `json:"in_reply_to"`
+	Deleted   bool          `json:"deleted"`
+}
+
+// a chirp in a thread, written as the chirp, or as its tombstone when it has one
+type ThreadChirp struct {
+	Chirp     *ChirpResponse
+	Tombstone *ChirpTombstone
+}
+
+func (c ThreadChirp) MarshalJSON() ([]byte, error) {
+	if c.Tombstone != nil {
+		return json.Marshal(c.Tombstone)
+	}
+	return json.Marshal(c.Chirp)
+}
+
+type ChirpThreadResponse struct {
+	// the chirps it replies to, from the start of the thread
+	Ancestors []ThreadChirp `json:"ancestors"`
+	Chirp     ThreadChirp   `json:"chirp"`
+	// direct replies, oldest first
+	Replies []ThreadChirp `json:"replies"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// reads DELETED_CHIRP_RETENTION_DAYS, falling back to 30 days
+func deletedChirpRetentionFromEnv() (time.Duration, error) {
+	days := defaultDeletedChirpRetentionDays
+	if raw := os.Getenv("DELETED_CHIRP_RETENTION_DAYS"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return 0, fmt.Errorf("DELETED_CHIRP_RETENTION_DAYS: %w", err)
+		}
+		if parsed < 0 {
+			return 0, errors.New("DELETED_CHIRP_RETENTION_DAYS: must not be negative")
+		}
+		days = parsed
+	}
+
+	return time.Duration(time.Hour * 24 * time.Duration(days)), nil
+}
+
+func newChirpTombstone(chirp database.Chirp) *ChirpTombstone {
+	return &ChirpTombstone{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		InReplyTo: chirp.InReplyTo,
+		Deleted:   true,
+	}
+}
+
+// the chirps as they are shown in a thread, in the same order
+// deleted chirps, and those of authors whose account is being deleted, become tombstones
+func (cfg *apiConfig) newThreadChirps(ctx context.Context, chirpRecords []database.Chirp) ([]ThreadChirp, error) {
+	authorIDs := make([]uuid.UUID, 0, len(chirpRecords))
+	for _, chirpRecord := range chirpRecords {
+		authorIDs = append(authorIDs, chirpRecord.UserID)
+	}
+	leavingIDs, err := cfg.db.ListUserIDsPendingDeletion(ctx, authorIDs)
+	if err != nil {
+		return nil, err
+	}
+	leaving := make(map[uuid.UUID]bool)
+	for _, userID := range leavingIDs {
+		leaving[userID] = true
+	}
+
+	visibleRecords := make([]database.Chirp, 0, len(chirpRecords))
+	for _, chirpRecord := range chirpRecords {
+		if !chirpRecord.DeletedAt.Valid && !leaving[chirpRecord.UserID] {
+			visibleRecords = append(visibleRecords, chirpRecord)
+		}
+	}
+	chirpResponses, err := cfg.newChirpResponses(ctx, visibleRecords)
+	if err != nil {
+		return nil, err
+	}
+
+	threadChirps := make([]ThreadChirp, 0, len(chirpRecords))
+	for _, chirpRecord := range chirpRecords {
+		if chirpRecord.DeletedAt.Valid || leaving[chirpRecord.UserID] {
+			threadChirps = append(threadChirps, ThreadChirp{Tombstone: newChirpTombstone(chirpRecord)})
+			continue
+		}
+		threadChirps = append(threadChirps, ThreadChirp{Chirp: &chirpResponses[0]})
+		chirpResponses = chirpResponses[1:]
+	}
+
+	return threadChirps, nil
+}
+
+// deletes chirps that were deleted before the retention period, replies to them lose their in_reply_to
+// their media goes first, any that can not be deleted is left unattached and purged with the other unattached media
+func (cfg *apiConfig) purgeDeletedChirps(ctx context.Context) {
+	cutoff := sql.NullTime{Time: time.Now().UTC().Add(-cfg.chirpRetention), Valid: true}
+
+	attachments, err := cfg.db.ListAttachmentsOfChirpsDeletedBefore(ctx, cutoff)
+	if err != nil {
+		log.Printf("Unable to list attachments of deleted chirps: %s", err)
+		return
+	}
+	cfg.deleteAttachments(ctx, attachments)
+
+	purged, err := cfg.db.PurgeDeletedChirpsBefore(ctx, cutoff)
+	if err != nil {
+		log.Printf("Unable to purge deleted chirps: %s", err)
+		return
+	}
+
+	if purged > 0 {
+		log.Printf("Purged %d deleted chirps.", purged)
+	}
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// the conversation around a chirp: the chirps it replies to, and the replies to it
+// deleted chirps are kept as tombstones, so the thread still holds together
+func (cfg *apiConfig) handlerGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Chirp not found.")
+		return
+	}
+
+	chirpRecord, err := cfg.db.GetThreadChirpByID(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting chirp '%s': %s", chirpID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	ancestors, err := cfg.db.ListChirpAncestors(r.Context(), database.ListChirpAncestorsParams{
+		ID:       chirpRecord.ID,
+		MaxDepth: maxThreadDepth,
+	})
+	if err != nil {
+		log.Printf("Error listing chirps replied to by '%s': %s", chirpRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	replies, err := cfg.db.ListChirpReplies(r.Context(), uuid.NullUUID{UUID: chirpRecord.ID, Valid: true})
+	if err != nil {
+		log.Printf("Error listing replies to '%s': %s", chirpRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	chirpRecords := append(append(ancestors, chirpRecord), replies...)
+	threadChirps, err := cfg.newThreadChirps(r.Context(), chirpRecords)
+	if err != nil {
+		log.Printf("Error building thread of '%s': %s", chirpRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ChirpThreadResponse{
+		Ancestors: threadChirps[:len(ancestors)],
+		Chirp:     threadChirps[len(ancestors)],
+		Replies:   threadChirps[len(ancestors)+1:],
+	})
+}
+
+// brings back a deleted chirp that has not been purged yet, along with the media it had
+// webhook subscribers hear of it as a new chirp again
+func (cfg *apiConfig) handlerRestoreChirp(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authenticateAdmin(r)
+	if err != nil {
+		log.Printf("Rejected chirp restore: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Deleted chirp not found.")
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	chirpRecord, err := qtx.RestoreChirpByID(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Deleted chirp not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to restore chirp '%s': %s", chirpID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = enqueueOutboundWebhook(r.Context(), qtx, chirpRecord.UserID, outboundEventChirpCreated, newChirpWebhookData(chirpRecord))
+	if err != nil {
+		log.Printf("Unable to queue chirp webhooks: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Unable to commit chirp restore: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	chirpResponses, err := cfg.newChirpResponses(r.Context(), []database.Chirp{chirpRecord})
+	if err != nil {
+		log.Printf("Unable to get chirp attachments: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("Chirp ID '%s' was restored.", chirpRecord.ID)
+	respondWithJSON(w, http.StatusOK, chirpResponses[0])
+}
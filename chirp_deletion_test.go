@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+func TestDeletedChirpRetentionFromEnv(t *testing.T) {
+	var tests = []struct {
+		input     string
+		expected  time.Duration
+		expectErr bool
+	}{
+		{"", time.Hour * 24 * defaultDeletedChirpRetentionDays, false},
+		{"7", time.Hour * 24 * 7, false},
+		{"0", 0, false},
+		{"-1", 0, true},
+		{"168h", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Setenv("DELETED_CHIRP_RETENTION_DAYS", test.input)
+
+		actual, err := deletedChirpRetentionFromEnv()
+		if (err != nil) != test.expectErr {
+			t.Errorf("Input '%s', expected error: %t, Got: '%v'", test.input, test.expectErr, err)
+		}
+		if err == nil && actual != test.expected {
+			t.Errorf("Expected '%s', received '%s'", test.expected, actual)
+		}
+	}
+}
+
+func TestThreadChirpJSON(t *testing.T) {
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		Body:      "gone but not forgotten",
+		UserID:    uuid.New(),
+		DeletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+
+	data, err := json.Marshal(ThreadChirp{Tombstone: newChirpTombstone(chirp)})
+	if err != nil {
+		t.Fatalf("unable to marshal tombstone: %s", err)
+	}
+	for _, hidden := range []string{"body", "user_id", chirp.Body} {
+		if strings.Contains(string(data), hidden) {
+			t.Errorf("Tombstone should not contain '%s': %s", hidden, data)
+		}
+	}
+	if !strings.Contains(string(data), `"deleted":true`) {
+		t.Errorf("Expected the tombstone to be marked deleted: %s", data)
+	}
+
+	// a live chirp is written as it is anywhere else, without the deleted_at column
+	data, err = json.Marshal(ThreadChirp{Chirp: &ChirpResponse{Chirp: database.Chirp{Body: "still here"}}})
+	if err != nil {
+		t.Fatalf("unable to marshal chirp: %s", err)
+	}
+	if !strings.Contains(string(data), `"body":"still here"`) {
+		t.Errorf("Expected the chirp body: %s", data)
+	}
+	if strings.Contains(string(data), "deleted") {
+		t.Errorf("Expected no deleted fields on a live chirp: %s", data)
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerChirpDeletionRejects(t *testing.T) {
+	cfg := apiConfig{adminAPIKey: "admin-key"}
+
+	var tests = []struct {
+		name         string
+		handler      http.HandlerFunc
+		authHeader   string
+		id           string
+		expectedCode int
+	}{
+		{"thread bad id", cfg.handlerGetChirpThread, "", "not-a-uuid", http.StatusNotFound},
+		{"restore without key", cfg.handlerRestoreChirp, "", uuid.NewString(), http.StatusUnauthorized},
+		{"restore wrong key", cfg.handlerRestoreChirp, "ApiKey wrong", uuid.NewString(), http.StatusUnauthorized},
+		{"restore bad id", cfg.handlerRestoreChirp, "ApiKey admin-key", "not-a-uuid", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if test.authHeader != "" {
+			r.Header.Set("Authorization", test.authHeader)
+		}
+		r.SetPathValue("id", test.id)
+		w := httptest.NewRecorder()
+
+		test.handler(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("%s, expected: %d, Got: %d", test.name, test.expectedCode, actualCode)
+		}
+	}
+}
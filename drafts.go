@@ -0,0 +1,469 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	// drafts may run past the chirp length limit while they are written, but not without bound
+	maxDraftBytes = 16 * 1024
+	// unpublished drafts, per user
+	maxDraftsPerUser = 100
+
+	chirpWarningTooLong  = "too_long"
+	chirpWarningCensored = "censored"
+)
+
+// =====
+// TYPES
+// =====
+
+type DraftRequest struct {
+	Body      string     `json:"body"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+}
+type DraftPublishRequest struct {
+	MediaIDs []uuid.UUID `json:"media_ids"`
+}
+type DraftResponse struct {
+	database.Draft
+	// the body as it would be published
+	CleanedBody string `json:"cleaned_body"`
+	Length      int    `json:"length"`
+	MaxLength   int    `json:"max_length"`
+	// problems the draft would have if it were published now, none of them stop it being saved
+	Warnings []ChirpWarning `json:"warnings"`
+}
+type ChirpWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// what the author should hear about before publishing, a chirp that is too long is refused then
+func (check chirpCheck) warnings() []ChirpWarning {
+	warnings := make([]ChirpWarning, 0)
+
+	if check.length > check.maxLength {
+		warnings = append(warnings, ChirpWarning{
+			Code:    chirpWarningTooLong,
+			Message: fmt.Sprintf("Chirp is %d characters too long.", check.length-check.maxLength),
+		})
+	}
+
+	if len(check.censored) > 0 {
+		warnings = append(warnings, ChirpWarning{
+			Code:    chirpWarningCensored,
+			Message: fmt.Sprintf("These words will be censored: %s.", strings.Join(check.censored, ", ")),
+		})
+	}
+
+	return warnings
+}
+
+func newDraftResponse(draft database.Draft, maxLength int) DraftResponse {
+	check := checkChirp(draft.Body, draft.InReplyTo.Valid, maxLength)
+	return DraftResponse{
+		Draft:       draft,
+		CleanedBody: check.cleanedBody,
+		Length:      check.length,
+		MaxLength:   check.maxLength,
+		Warnings:    check.warnings(),
+	}
+}
+
+// the chirp a draft replies to, which must be one that can be seen
+func replyParent(w http.ResponseWriter, r *http.Request, q *database.Queries, chirpID *uuid.UUID) (uuid.NullUUID, bool) {
+	if chirpID == nil {
+		return uuid.NullUUID{}, true
+	}
+
+	parentRecord, err := q.GetChirpByID(r.Context(), *chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid in_reply_to: chirp not found.")
+		return uuid.NullUUID{}, false
+	}
+	if err != nil {
+		log.Printf("Error getting chirp replied to: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return uuid.NullUUID{}, false
+	}
+
+	return uuid.NullUUID{UUID: parentRecord.ID, Valid: true}, true
+}
+
+// reads a draft from the request body, refusing one that could never be published
+func decodeDraftRequest(w http.ResponseWriter, r *http.Request) (DraftRequest, bool) {
+	var draftRequest DraftRequest
+	err := json.NewDecoder(r.Body).Decode(&draftRequest)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return DraftRequest{}, false
+	}
+
+	if len(draftRequest.Body) > maxDraftBytes {
+		respondWithError(w, http.StatusBadRequest, "Draft is too long.")
+		return DraftRequest{}, false
+	}
+
+	return draftRequest, true
+}
+
+// the user's draft from the path, another user's draft is reported as not found
+func (cfg *apiConfig) getOwnDraft(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.Draft, bool) {
+	draftID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Draft not found.")
+		return database.Draft{}, false
+	}
+
+	draftRecord, err := cfg.db.GetDraftByID(r.Context(), draftID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && draftRecord.UserID != userID) {
+		respondWithError(w, http.StatusNotFound, "Draft not found.")
+		return database.Draft{}, false
+	}
+	if err != nil {
+		log.Printf("Error getting draft '%s': %s", draftID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return database.Draft{}, false
+	}
+
+	return draftRecord, true
+}
+
+// the longest chirp the user's plan allows, which drafts are measured against
+func (cfg *apiConfig) maxChirpLengthForUser(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (int, bool) {
+	entitlements, err := cfg.db.GetEntitlementsByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting entitlements of user '%s': %s", userID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return 0, false
+	}
+
+	return int(entitlements.MaxChirpLength), true
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// saves an unfinished chirp
+// it is checked as a chirp would be, but problems are returned as warnings rather than refused
+func (cfg *apiConfig) handlerCreateDraft(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	draftRequest, ok := decodeDraftRequest(w, r)
+	if !ok {
+		return
+	}
+
+	maxLength, ok := cfg.maxChirpLengthForUser(w, r, tokenUUID)
+	if !ok {
+		return
+	}
+
+	drafts, err := cfg.db.CountDraftsByUserID(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error counting drafts of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if drafts >= maxDraftsPerUser {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("You can have at most %d drafts.", maxDraftsPerUser))
+		return
+	}
+
+	inReplyTo, ok := replyParent(w, r, cfg.db, draftRequest.InReplyTo)
+	if !ok {
+		return
+	}
+
+	draftRecord, err := cfg.db.CreateDraft(r.Context(), database.CreateDraftParams{
+		UserID:    tokenUUID,
+		Body:      draftRequest.Body,
+		InReplyTo: inReplyTo,
+	})
+	if err != nil {
+		log.Printf("Unable to create draft: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, newDraftResponse(draftRecord, maxLength))
+}
+
+// lists the user's drafts, the most recently edited first
+func (cfg *apiConfig) handlerListDrafts(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	maxLength, ok := cfg.maxChirpLengthForUser(w, r, tokenUUID)
+	if !ok {
+		return
+	}
+
+	draftRecords, err := cfg.db.ListDraftsByUserID(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error listing drafts of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	draftResponses := make([]DraftResponse, 0, len(draftRecords))
+	for _, draftRecord := range draftRecords {
+		draftResponses = append(draftResponses, newDraftResponse(draftRecord, maxLength))
+	}
+
+	respondWithJSON(w, http.StatusOK, draftResponses)
+}
+
+func (cfg *apiConfig) handlerGetDraft(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	draftRecord, ok := cfg.getOwnDraft(w, r, tokenUUID)
+	if !ok {
+		return
+	}
+
+	maxLength, ok := cfg.maxChirpLengthForUser(w, r, tokenUUID)
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newDraftResponse(draftRecord, maxLength))
+}
+
+// replaces the draft's body and the chirp it replies to
+func (cfg *apiConfig) handlerUpdateDraft(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Draft not found.")
+		return
+	}
+
+	draftRequest, ok := decodeDraftRequest(w, r)
+	if !ok {
+		return
+	}
+
+	maxLength, ok := cfg.maxChirpLengthForUser(w, r, tokenUUID)
+	if !ok {
+		return
+	}
+
+	inReplyTo, ok := replyParent(w, r, cfg.db, draftRequest.InReplyTo)
+	if !ok {
+		return
+	}
+
+	// the user id in the update keeps other users' drafts out of reach
+	draftRecord, err := cfg.db.UpdateDraft(r.Context(), database.UpdateDraftParams{
+		ID:        draftID,
+		UserID:    tokenUUID,
+		Body:      draftRequest.Body,
+		InReplyTo: inReplyTo,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Draft not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to update draft '%s': %s", draftID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newDraftResponse(draftRecord, maxLength))
+}
+
+func (cfg *apiConfig) handlerDeleteDraft(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Draft not found.")
+		return
+	}
+
+	deleted, err := cfg.db.DeleteDraft(r.Context(), database.DeleteDraftParams{
+		ID:     draftID,
+		UserID: tokenUUID,
+	})
+	if err != nil {
+		log.Printf("Unable to delete draft '%s': %s", draftID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Draft not found.")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// turns the draft into a chirp, with the same checks as posting one
+// the draft is removed in the same transaction, so it is published once, or not at all
+func (cfg *apiConfig) handlerPublishDraft(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	draftID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Draft not found.")
+		return
+	}
+
+	// the body is optional, it only carries media to attach
+	var publishRequest DraftPublishRequest
+	err = json.NewDecoder(r.Body).Decode(&publishRequest)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	entitlements, err := cfg.db.GetEntitlementsByUserID(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error getting entitlements of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	mediaIDs, err := parseMediaIDs(publishRequest.MediaIDs, int(entitlements.MaxMediaPerChirp))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid media_ids: "+err.Error()+".")
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	allowed, err := canPostChirp(r.Context(), qtx, tokenUUID, entitlements)
+	if err != nil {
+		log.Printf("Error counting recent chirps of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusTooManyRequests, "Too many chirps, please try again later.")
+		return
+	}
+
+	// taking the draft locks it, a second publish waits and then finds it gone
+	draftRecord, err := qtx.TakeDraft(r.Context(), database.TakeDraftParams{
+		ID:     draftID,
+		UserID: tokenUUID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Draft not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to take draft '%s': %s", draftID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	var parentID *uuid.UUID
+	if draftRecord.InReplyTo.Valid {
+		parentID = &draftRecord.InReplyTo.UUID
+	}
+	inReplyTo, ok := replyParent(w, r, qtx, parentID)
+	if !ok {
+		return
+	}
+
+	// what was only a warning on the draft is refused now
+	validBody, err := validateChirp(draftRecord.Body, inReplyTo.Valid, int(entitlements.MaxChirpLength))
+	if err != nil {
+		log.Printf("Chirp is too long. %s\n", err)
+		respondWithError(w, http.StatusBadRequest, "Chirp is too long.")
+		return
+	}
+
+	chirpRecord, err := saveNewChirp(r.Context(), qtx, newChirp{
+		Body:      validBody,
+		UserID:    tokenUUID,
+		InReplyTo: inReplyTo,
+		MediaIDs:  mediaIDs,
+	})
+	if errors.Is(err, errMediaNotAttachable) {
+		respondWithError(w, http.StatusBadRequest, "Invalid media_ids: each must be your own upload, not yet attached to a chirp.")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to save chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Unable to commit published draft: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	chirpResponses, err := cfg.newChirpResponses(r.Context(), []database.Chirp{chirpRecord})
+	if err != nil {
+		log.Printf("Unable to get chirp attachments: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, chirpResponses[0])
+}
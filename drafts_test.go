@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+func TestCheckChirpWarnings(t *testing.T) {
+	var tests = []struct {
+		input         string
+		isReply       bool
+		expectedBody  string
+		expectedCodes []string
+	}{
+		{"hello there", false, "hello there", []string{}},
+		{"what a Kerfuffle", false, "what a ****", []string{chirpWarningCensored}},
+		{strings.Repeat("a", maxChirpLength+1), false, strings.Repeat("a", maxChirpLength+1), []string{chirpWarningTooLong}},
+		{"@alice " + strings.Repeat("a", maxChirpLength), true, "@alice " + strings.Repeat("a", maxChirpLength), []string{}},
+		{"fornax " + strings.Repeat("a", maxChirpLength), false, "**** " + strings.Repeat("a", maxChirpLength), []string{chirpWarningTooLong, chirpWarningCensored}},
+	}
+
+	for _, test := range tests {
+		check := checkChirp(test.input, test.isReply, maxChirpLength)
+		if check.cleanedBody != test.expectedBody {
+			t.Errorf("Expected '%s', received '%s'", test.expectedBody, check.cleanedBody)
+		}
+
+		warnings := check.warnings()
+		if len(warnings) != len(test.expectedCodes) {
+			t.Errorf("'%s': Expected: %d warnings, Got: %d", test.input, len(test.expectedCodes), len(warnings))
+			continue
+		}
+		for i, warning := range warnings {
+			if warning.Code != test.expectedCodes[i] {
+				t.Errorf("'%s': Expected '%s', received '%s'", test.input, test.expectedCodes[i], warning.Code)
+			}
+		}
+	}
+}
+
+func TestNewDraftResponse(t *testing.T) {
+	draft := database.Draft{Body: "a sharbert and a fornax"}
+
+	response := newDraftResponse(draft, 10)
+	if response.CleanedBody != "a **** and a ****" {
+		t.Errorf("Expected '%s', received '%s'", "a **** and a ****", response.CleanedBody)
+	}
+	if response.Length != 23 || response.MaxLength != 10 {
+		t.Errorf("Expected: 23 of 10, Got: %d of %d", response.Length, response.MaxLength)
+	}
+	if len(response.Warnings) != 2 {
+		t.Fatalf("Expected: %d, Got: %d", 2, len(response.Warnings))
+	}
+	if !strings.Contains(response.Warnings[1].Message, "sharbert, fornax") {
+		t.Errorf("Expected the censored words in '%s'", response.Warnings[1].Message)
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerDraftsReject(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	token, err := auth.MakeJWT(uuid.New(), cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+
+	tooLong := `{"body":"` + strings.Repeat("a", maxDraftBytes+1) + `"}`
+
+	var tests = []struct {
+		name         string
+		handler      http.HandlerFunc
+		token        string
+		id           string
+		body         string
+		expectedCode int
+	}{
+		{"create without token", cfg.handlerCreateDraft, "", "", `{"body":"hi"}`, http.StatusUnauthorized},
+		{"create bad body", cfg.handlerCreateDraft, token, "", `not json`, http.StatusBadRequest},
+		{"create too long", cfg.handlerCreateDraft, token, "", tooLong, http.StatusBadRequest},
+		{"list without token", cfg.handlerListDrafts, "", "", "", http.StatusUnauthorized},
+		{"get bad id", cfg.handlerGetDraft, token, "not-a-uuid", "", http.StatusNotFound},
+		{"update bad id", cfg.handlerUpdateDraft, token, "not-a-uuid", `{"body":"hi"}`, http.StatusNotFound},
+		{"update bad body", cfg.handlerUpdateDraft, token, uuid.NewString(), `not json`, http.StatusBadRequest},
+		{"update too long", cfg.handlerUpdateDraft, token, uuid.NewString(), tooLong, http.StatusBadRequest},
+		{"delete without token", cfg.handlerDeleteDraft, "", uuid.NewString(), "", http.StatusUnauthorized},
+		{"delete bad id", cfg.handlerDeleteDraft, token, "not-a-uuid", "", http.StatusNotFound},
+		{"publish bad id", cfg.handlerPublishDraft, token, "not-a-uuid", "", http.StatusNotFound},
+		{"publish bad body", cfg.handlerPublishDraft, token, uuid.NewString(), `not json`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/drafts", strings.NewReader(test.body))
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		r.SetPathValue("id", test.id)
+		w := httptest.NewRecorder()
+
+		test.handler(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("%s, expected: %d, Got: %d", test.name, test.expectedCode, actualCode)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+	"github.com/nicholasss/chirpy/internal/jobs"
+	"github.com/nicholasss/chirpy/internal/mailer"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	emailVerificationExpiry = time.Duration(time.Hour * 48)
+	passwordResetExpiry     = time.Duration(time.Hour * 1)
+	mailSendTimeout         = time.Duration(time.Second * 30)
+	defaultMailFrom         = "Chirpy <no-reply@localhost>"
+	defaultPublicBaseURL    = "http://localhost:" + port
+)
+
+// =====
+// TYPES
+// =====
+
+// an email waiting to be sent
+// it may hold a single use link, so its payload is cleared once it is sent
+type emailJob struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+func (emailJob) Kind() string { return "email.send" }
+
+type EmailVerifyRequest struct {
+	Token string `json:"token"`
+}
+type PasswordForgotRequest struct {
+	Email string `json:"email"`
+}
+type PasswordResetRequest struct {
+	Token       string `json:"token"`
+	RawPassword string `json:"password"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// picks the mailer from the MAILER environment variable
+// 'smtp', 'file' or 'log', where 'log' is the default
+func newMailerFromEnv() (mailer.Mailer, error) {
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = defaultMailFrom
+	}
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mailer")
+		}
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		return mailer.NewSMTPMailer(host, smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom), nil
+
+	case "file":
+		path := os.Getenv("MAIL_FILE")
+		if path == "" {
+			path = "mail.log"
+		}
+		return mailer.NewFileMailer(path, mailFrom)
+
+	case "log", "":
+		return mailer.NewLogMailer(mailFrom), nil
+
+	default:
+		return nil, fmt.Errorf("unknown mailer '%s'", os.Getenv("MAILER"))
+	}
+}
+
+// enqueues the email to be sent in the background, so the response does not wait on the mail server
+// and response timing does not reveal whether an account exists
+// pass the transaction's queries to only send it if the transaction commits
+func (cfg *apiConfig) sendMail(ctx context.Context, q *database.Queries, msg mailer.Message) error {
+	_, err := jobs.Enqueue(ctx, q, emailJob{To: msg.To, Subject: msg.Subject, Body: msg.Body}, jobs.Options{})
+	return err
+}
+
+// sends an enqueued email, retried when the mail server can not be reached
+func (cfg *apiConfig) deliverEmail(ctx context.Context, job emailJob) error {
+	ctx, cancel := context.WithTimeout(ctx, mailSendTimeout)
+	defer cancel()
+
+	err := cfg.mailer.Send(ctx, mailer.Message{To: job.To, Subject: job.Subject, Body: job.Body})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Sent email '%s'.", job.Subject)
+	return nil
+}
+
+// creates a single use token for the purpose, and returns it signed
+func (cfg *apiConfig) makeEmailToken(ctx context.Context, userID uuid.UUID, email, purpose string, expiresIn time.Duration) (string, error) {
+	expiresAt := time.Now().UTC().Add(expiresIn)
+	tokenRecord, err := cfg.db.CreateEmailToken(ctx, database.CreateEmailTokenParams{
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return auth.MakePurposeJWT(userID, purpose, tokenRecord.ID.String(), email, cfg.jwtSecret, expiresIn)
+}
+
+// validates the signed token and marks it as used
+// a token can only be used once, even if it has not expired
+func (cfg *apiConfig) useEmailToken(ctx context.Context, q *database.Queries, token, purpose string) (auth.PurposeClaims, error) {
+	claims, err := auth.ValidatePurposeJWT(token, purpose, cfg.jwtSecret)
+	if err != nil {
+		return auth.PurposeClaims{}, err
+	}
+
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return auth.PurposeClaims{}, err
+	}
+
+	tokenRecord, err := q.UseEmailToken(ctx, database.UseEmailTokenParams{
+		ID:      tokenID,
+		Purpose: purpose,
+	})
+	if err != nil {
+		return auth.PurposeClaims{}, err
+	}
+	if tokenRecord.UserID.String() != claims.Subject {
+		return auth.PurposeClaims{}, fmt.Errorf("token subject does not match record")
+	}
+
+	return claims, nil
+}
+
+func (cfg *apiConfig) buildPublicURL(path string, params url.Values) string {
+	return cfg.publicBaseURL + path + "?" + params.Encode()
+}
+
+// emails a verification link to the user's current address
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := cfg.makeEmailToken(ctx, userID, email, auth.PurposeEmailVerification, emailVerificationExpiry)
+	if err != nil {
+		return err
+	}
+
+	link := cfg.buildPublicURL("/app/verify-email", url.Values{"token": {token}})
+	return cfg.sendMail(ctx, cfg.db, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email",
+		Body: "Welcome to Chirpy!\n\n" +
+			"Please verify your email by opening this link:\n" + link + "\n\n" +
+			"The link expires in 48 hours.",
+	})
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// marks the user's email as verified using the token from the verification email
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var verifyRequest EmailVerifyRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&verifyRequest)
+	if err != nil {
+		log.Printf("Error decoding verify email request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	claims, err := cfg.useEmailToken(r.Context(), cfg.db, verifyRequest.Token, auth.PurposeEmailVerification)
+	if err != nil {
+		log.Printf("Invalid email verification token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token.")
+		return
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		log.Printf("Invalid subject in verification token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token.")
+		return
+	}
+
+	// only verifies if the address has not changed since the email was sent
+	err = cfg.db.MarkUserEmailVerified(r.Context(), database.MarkUserEmailVerifiedParams{
+		ID:    userID,
+		Email: claims.Email,
+	})
+	if err != nil {
+		log.Printf("Error marking email as verified: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("User '%s' verified their email.", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sends a new verification email to the logged in user
+func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Unable to authenticate resend verification: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	safeUserRecord, err := cfg.db.GetUserByIDSafe(r.Context(), userID)
+	if err != nil {
+		log.Printf("Unable to find user for resend verification: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if safeUserRecord.EmailVerified {
+		respondWithError(w, http.StatusConflict, "Email is already verified.")
+		return
+	}
+
+	err = cfg.sendVerificationEmail(r.Context(), userID, safeUserRecord.Email)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// emails a password reset link, if an account with the email exists
+// always responds the same way, so it can not be used to find accounts
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var forgotRequest PasswordForgotRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&forgotRequest)
+	if err != nil {
+		log.Printf("Error decoding forgot password request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	safeUserRecord, err := cfg.db.GetUserByEmailSafe(r.Context(), forgotRequest.Email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting user for forgot password: %s", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := cfg.makeEmailToken(r.Context(), safeUserRecord.ID, safeUserRecord.Email, auth.PurposePasswordReset, passwordResetExpiry)
+	if err != nil {
+		log.Printf("Error making password reset token: %s", err)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	link := cfg.buildPublicURL("/app/reset-password", url.Values{"token": {token}})
+	err = cfg.sendMail(r.Context(), cfg.db, mailer.Message{
+		To:      safeUserRecord.Email,
+		Subject: "Reset your Chirpy password",
+		Body: "Someone asked to reset the password for your Chirpy account.\n\n" +
+			"To choose a new password, open this link:\n" + link + "\n\n" +
+			"The link expires in 1 hour. If this was not you, you can ignore this email.",
+	})
+	if err != nil {
+		log.Printf("Error sending password reset email: %s", err)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	log.Printf("Password reset requested for user '%s'.", safeUserRecord.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sets a new password using the token from the reset email
+// every session of the user is logged out
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	var resetRequest PasswordResetRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&resetRequest)
+	if err != nil {
+		log.Printf("Error decoding reset password request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	if resetRequest.RawPassword == "" {
+		respondWithError(w, http.StatusBadRequest, "A new password is required.")
+		return
+	}
+
+	// the token is checked (but not used up) first, to get the email for the policy
+	unusedClaims, err := auth.ValidatePurposeJWT(resetRequest.Token, auth.PurposePasswordReset, cfg.jwtSecret)
+	if err != nil {
+		log.Printf("Invalid password reset token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token.")
+		return
+	}
+	if !cfg.enforcePasswordPolicy(w, resetRequest.RawPassword, unusedClaims.Email) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(resetRequest.RawPassword)
+	if err != nil {
+		log.Printf("Error hashing new password: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Please try to reset your password again.")
+		return
+	}
+	resetRequest.RawPassword = ""
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	claims, err := cfg.useEmailToken(r.Context(), qtx, resetRequest.Token, auth.PurposePasswordReset)
+	if err != nil {
+		log.Printf("Invalid password reset token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token.")
+		return
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		log.Printf("Invalid subject in reset token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token.")
+		return
+	}
+
+	err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		log.Printf("Error updating password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	// any other outstanding reset links stop working
+	err = qtx.InvalidateEmailTokensByUserID(r.Context(), database.InvalidateEmailTokensByUserIDParams{
+		UserID:  userID,
+		Purpose: auth.PurposePasswordReset,
+	})
+	if err != nil {
+		log.Printf("Error invalidating reset tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = qtx.RevokeAllRefreshTokensByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error revoking refresh tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing password reset: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("User '%s' reset their password.", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+// rate limits count what the user did within this window
+const rateLimitWindow = time.Duration(time.Hour * 1)
+
+// =====
+// TYPES
+// =====
+
+// what the user's plan lets them do, from the plan_entitlements table
+type EntitlementsResponse struct {
+	Plan                string `json:"plan"`
+	MaxChirpLength      int32  `json:"max_chirp_length"`
+	MaxMediaPerChirp    int32  `json:"max_media_per_chirp"`
+	ChirpsPerHour       int32  `json:"chirps_per_hour"`
+	MediaUploadsPerHour int32  `json:"media_uploads_per_hour"`
+	CanEditChirps       bool   `json:"can_edit_chirps"`
+	CanScheduleChirps   bool   `json:"can_schedule_chirps"`
+	MaxPinnedChirps     int32  `json:"max_pinned_chirps"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+func newEntitlementsResponse(entitlements database.PlanEntitlement) EntitlementsResponse {
+	return EntitlementsResponse{
+		Plan:                entitlements.Plan,
+		MaxChirpLength:      entitlements.MaxChirpLength,
+		MaxMediaPerChirp:    entitlements.MaxMediaPerChirp,
+		ChirpsPerHour:       entitlements.ChirpsPerHour,
+		MediaUploadsPerHour: entitlements.MediaUploadsPerHour,
+		CanEditChirps:       entitlements.CanEditChirps,
+		CanScheduleChirps:   entitlements.CanScheduleChirps,
+		MaxPinnedChirps:     entitlements.MaxPinnedChirps,
+	}
+}
+
+// reports if the user has posted fewer chirps within the rate limit window than their plan allows
+// chirps are counted when saved, a scheduled chirp does not count again when it is published
+// pass the transaction's queries the chirp is saved with, the user's row stays locked until it ends,
+// so requests racing each other are counted one after another
+func canPostChirp(ctx context.Context, q *database.Queries, userID uuid.UUID, entitlements database.PlanEntitlement) (bool, error) {
+	_, err := q.LockUserByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	posted, err := q.CountChirpsByUserSince(ctx, database.CountChirpsByUserSinceParams{
+		UserID:   userID,
+		PostedAt: time.Now().UTC().Add(-rateLimitWindow),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return posted < int64(entitlements.ChirpsPerHour), nil
+}
+
+// reports if the user has uploaded less media within the rate limit window than their plan allows
+// pass the transaction's queries the upload is saved with, as with canPostChirp
+func canUploadMedia(ctx context.Context, q *database.Queries, userID uuid.UUID, entitlements database.PlanEntitlement) (bool, error) {
+	_, err := q.LockUserByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	uploaded, err := q.CountAttachmentsByUserSince(ctx, database.CountAttachmentsByUserSinceParams{
+		UserID:    userID,
+		CreatedAt: time.Now().UTC().Add(-rateLimitWindow),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return uploaded < int64(entitlements.MediaUploadsPerHour), nil
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// returns what the logged in user's plan lets them do
+func (cfg *apiConfig) handlerGetEntitlements(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	entitlements, err := cfg.db.GetEntitlementsByUserID(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error getting entitlements of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newEntitlementsResponse(entitlements))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+func TestNewEntitlementsResponse(t *testing.T) {
+	entitlements := database.PlanEntitlement{
+		Plan:                "chirpy_red",
+		UpdatedAt:           time.Now(),
+		MaxChirpLength:      500,
+		MaxMediaPerChirp:    8,
+		ChirpsPerHour:       120,
+		MediaUploadsPerHour: 60,
+		CanEditChirps:       true,
+		CanScheduleChirps:   true,
+		MaxPinnedChirps:     5,
+	}
+
+	expected := EntitlementsResponse{
+		Plan:                "chirpy_red",
+		MaxChirpLength:      500,
+		MaxMediaPerChirp:    8,
+		ChirpsPerHour:       120,
+		MediaUploadsPerHour: 60,
+		CanEditChirps:       true,
+		CanScheduleChirps:   true,
+		MaxPinnedChirps:     5,
+	}
+	received := newEntitlementsResponse(entitlements)
+	if received != expected {
+		t.Errorf("Expected '%+v', received '%+v'", expected, received)
+	}
+}
+
+func TestHandlerGetEntitlementsRejects(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	w := httptest.NewRecorder()
+
+	cfg.handlerGetEntitlements(w, httptest.NewRequest(http.MethodGet, "/api/users/me/entitlements", nil))
+
+	_, code := readResponse(w, t)
+	if code != http.StatusUnauthorized {
+		t.Errorf("Expected: %d, Got: %d", http.StatusUnauthorized, code)
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerUpdateChirpRejects(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	token, err := auth.MakeJWT(uuid.New(), cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+
+	var tests = []struct {
+		id           string
+		token        string
+		body         string
+		expectedCode int
+	}{
+		{"not-a-uuid", token, `{"body":"hello"}`, http.StatusNotFound},
+		{uuid.NewString(), "", `{"body":"hello"}`, http.StatusUnauthorized},
+		{uuid.NewString(), token, `not json`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/api/chirps/"+test.id, strings.NewReader(test.body))
+		r.SetPathValue("id", test.id)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+
+		cfg.handlerUpdateChirp(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Body '%s', expected: %d, Got: %d", test.body, test.expectedCode, actualCode)
+		}
+	}
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+	"github.com/nicholasss/chirpy/internal/jobs"
+	"github.com/nicholasss/chirpy/internal/mailer"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	exportBuildTimeout = time.Duration(time.Minute * 5)
+	// how long a finished archive is kept
+	exportRetention = time.Duration(time.Hour * 24 * 7)
+	// how long a download link works for
+	exportLinkExpiry = time.Duration(time.Hour * 24)
+
+	exportStatusPending = "pending"
+	exportStatusReady   = "ready"
+	exportStatusFailed  = "failed"
+)
+
+// included in every archive, so the user knows what is and is not in it
+const exportReadme = `Chirpy personal data export
+
+profile.json           your account, as stored by Chirpy
+public_profile.json    your public profile, if you have set one up
+chirps.json            every chirp you have posted, including deleted ones not yet purged
+scheduled_chirps.json  chirps you have scheduled that are not published yet
+drafts.json            unfinished chirps you have saved as drafts
+sessions.json          every login session (refresh token), without the token itself
+oauth_grants.json      every third-party app you have given access to your account
+login_history.json     every login within the last year, with the address and browser it came from
+
+Chirpy does not record likes or follows, so there is nothing else to export.
+`
+
+// =====
+// TYPES
+// =====
+
+// builds the archive of a new export
+type dataExportJob struct {
+	ExportID uuid.UUID `json:"export_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+func (dataExportJob) Kind() string { return "data_exports.build" }
+
+type DataExportResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	DownloadURL string     `json:"download_url"`
+}
+
+// archive contents
+
+type ExportProfile struct {
+	ID               uuid.UUID  `json:"id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	Email            string     `json:"email"`
+	EmailVerified    bool       `json:"email_verified"`
+	IsChirpyRed      bool       `json:"is_chirpy_red"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	DeleteAfter      *time.Time `json:"delete_after"`
+}
+type ExportChirp struct {
+	database.Chirp
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+type ExportScheduledChirp struct {
+	ExportChirp
+	PublishAt time.Time `json:"publish_at"`
+	TimeZone  *string   `json:"time_zone"`
+}
+type ExportSession struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	ClientID  *uuid.UUID `json:"client_id"`
+	Scope     string     `json:"scope"`
+}
+
+// the queries an export is collected with, *database.Queries outside of tests
+type exportQuerier interface {
+	GetUserByIDRetHashedPassword(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetTOTPSecretByUserID(ctx context.Context, userID uuid.UUID) (database.TotpSecret, error)
+	ListChirpsByUserIDForExport(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	ListScheduledChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	ListChirpSchedulesByChirpIDs(ctx context.Context, chirpIds []uuid.UUID) ([]database.ChirpSchedule, error)
+	ListDraftsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Draft, error)
+	GetProfileByUserID(ctx context.Context, userID uuid.UUID) (database.Profile, error)
+	ListRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]database.ListRefreshTokensByUserIDRow, error)
+	ListOAuthConsentsByUserID(ctx context.Context, userID uuid.UUID) ([]database.OauthConsent, error)
+	ListLoginEventsByUserID(ctx context.Context, userID uuid.UUID) ([]database.LoginEvent, error)
+}
+
+type exportFile struct {
+	name string
+	data any
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// writes the readme and each file as indented json to a zip archive
+func writeExportArchive(w io.Writer, files []exportFile) error {
+	archive := zip.NewWriter(w)
+
+	readme, err := archive.Create("README.txt")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(readme, exportReadme)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		fileWriter, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(fileWriter)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(file.data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.name, err)
+		}
+	}
+
+	return archive.Close()
+}
+
+// collects everything chirpy stores about the user
+// users whose account is being deleted can still export it, so nothing here skips them
+func collectExportFiles(ctx context.Context, q exportQuerier, userID uuid.UUID) ([]exportFile, error) {
+	unsafeUserRecord, err := q.GetUserByIDRetHashedPassword(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	totpRecord, err := q.GetTOTPSecretByUserID(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	twoFactorEnabled := err == nil && totpRecord.ConfirmedAt.Valid
+
+	// the password hash and totp secret are left out on purpose
+	profile := ExportProfile{
+		ID:               unsafeUserRecord.ID,
+		CreatedAt:        unsafeUserRecord.CreatedAt,
+		UpdatedAt:        unsafeUserRecord.UpdatedAt,
+		Email:            unsafeUserRecord.Email,
+		EmailVerified:    unsafeUserRecord.EmailVerified,
+		IsChirpyRed:      unsafeUserRecord.IsChirpyRed,
+		TwoFactorEnabled: twoFactorEnabled,
+		DeleteAfter:      nullTimePtr(unsafeUserRecord.DeleteAfter),
+	}
+
+	chirpRecords, err := q.ListChirpsByUserIDForExport(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	chirps := make([]ExportChirp, 0, len(chirpRecords))
+	liveChirps := 0
+	for _, chirpRecord := range chirpRecords {
+		chirps = append(chirps, ExportChirp{Chirp: chirpRecord, DeletedAt: nullTimePtr(chirpRecord.DeletedAt)})
+		if !chirpRecord.DeletedAt.Valid {
+			liveChirps++
+		}
+	}
+
+	scheduledRecords, err := q.ListScheduledChirpsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	scheduledIDs := make([]uuid.UUID, 0, len(scheduledRecords))
+	for _, chirpRecord := range scheduledRecords {
+		scheduledIDs = append(scheduledIDs, chirpRecord.ID)
+	}
+	schedules, err := q.ListChirpSchedulesByChirpIDs(ctx, scheduledIDs)
+	if err != nil {
+		return nil, err
+	}
+	byChirp := make(map[uuid.UUID]database.ChirpSchedule)
+	for _, schedule := range schedules {
+		byChirp[schedule.ChirpID] = schedule
+	}
+	scheduledChirps := make([]ExportScheduledChirp, 0, len(scheduledRecords))
+	for _, chirpRecord := range scheduledRecords {
+		schedule := byChirp[chirpRecord.ID]
+		scheduledChirp := ExportScheduledChirp{ExportChirp: ExportChirp{Chirp: chirpRecord}, PublishAt: schedule.PublishAt}
+		if schedule.TimeZone.Valid {
+			scheduledChirp.TimeZone = &schedule.TimeZone.String
+		}
+		scheduledChirps = append(scheduledChirps, scheduledChirp)
+	}
+
+	drafts, err := q.ListDraftsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if drafts == nil {
+		drafts = []database.Draft{}
+	}
+
+	// null when the user never set up a public profile
+	var publicProfile *PublicProfileResponse
+	profileRecord, err := q.GetProfileByUserID(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err == nil {
+		publicProfile = &PublicProfileResponse{
+			ID:          userID,
+			CreatedAt:   unsafeUserRecord.CreatedAt,
+			IsChirpyRed: unsafeUserRecord.IsChirpyRed,
+			Handle:      profileRecord.Handle.String,
+			DisplayName: profileRecord.DisplayName,
+			Bio:         profileRecord.Bio,
+			AvatarURL:   profileRecord.AvatarUrl,
+			Location:    profileRecord.Location,
+			Website:     profileRecord.Website,
+			ChirpCount:  int64(liveChirps),
+		}
+	}
+
+	refreshTokens, err := q.ListRefreshTokensByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]ExportSession, 0, len(refreshTokens))
+	for _, token := range refreshTokens {
+		session := ExportSession{
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+			RevokedAt: nullTimePtr(token.RevokedAt),
+			Scope:     token.Scope,
+		}
+		if token.ClientID.Valid {
+			session.ClientID = &token.ClientID.UUID
+		}
+		sessions = append(sessions, session)
+	}
+
+	consents, err := q.ListOAuthConsentsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if consents == nil {
+		consents = []database.OauthConsent{}
+	}
+
+	logins, err := q.ListLoginEventsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if logins == nil {
+		logins = []database.LoginEvent{}
+	}
+
+	return []exportFile{
+		{"profile.json", profile},
+		{"public_profile.json", publicProfile},
+		{"chirps.json", chirps},
+		{"scheduled_chirps.json", scheduledChirps},
+		{"drafts.json", drafts},
+		{"sessions.json", sessions},
+		{"oauth_grants.json", consents},
+		{"login_history.json", logins},
+	}, nil
+}
+
+// builds the archive for a pending export, and emails the user a link once it is ready
+// an archive that can not be built marks the export as failed, rather than being retried
+func (cfg *apiConfig) buildDataExport(ctx context.Context, job dataExportJob) error {
+	ctx, cancel := context.WithTimeout(ctx, exportBuildTimeout)
+	defer cancel()
+
+	archive := &bytes.Buffer{}
+	files, err := collectExportFiles(ctx, cfg.db, job.UserID)
+	if err == nil {
+		err = writeExportArchive(archive, files)
+	}
+	if err != nil {
+		log.Printf("Error building data export '%s': %s", job.ExportID, err)
+		failErr := cfg.db.FailDataExport(ctx, database.FailDataExportParams{
+			ID:    job.ExportID,
+			Error: sql.NullString{String: err.Error(), Valid: true},
+		})
+		if failErr != nil {
+			return failErr
+		}
+		return fmt.Errorf("%w: %w", jobs.ErrPermanent, err)
+	}
+
+	safeUserRecord, err := cfg.db.GetUserByIDSafe(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	expiresAt := time.Now().UTC().Add(exportRetention)
+	err = qtx.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:        job.ExportID,
+		Archive:   archive.Bytes(),
+		ExpiresAt: sql.NullTime{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = cfg.sendMail(ctx, qtx, mailer.Message{
+		To:      safeUserRecord.Email,
+		Subject: "Your Chirpy data export is ready",
+		Body: "The export of your Chirpy data is ready to download:\n" +
+			cfg.exportDownloadURL(job.ExportID) + "\n\n" +
+			"The link expires in 24 hours. You can get a new link from the app until " +
+			expiresAt.Format(time.RFC1123) + ".",
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Data export '%s' is ready (%d bytes).", job.ExportID, archive.Len())
+	return nil
+}
+
+func exportDownloadPath(exportID uuid.UUID) string {
+	return "/api/exports/" + exportID.String() + "/download"
+}
+
+// a signed link to the archive, which works without an access token until it expires
+func (cfg *apiConfig) exportDownloadURL(exportID uuid.UUID) string {
+	path := exportDownloadPath(exportID)
+	expiresAt := time.Now().UTC().Add(exportLinkExpiry).Truncate(time.Second)
+
+	return cfg.buildPublicURL(path, url.Values{
+		"expires":   {strconv.FormatInt(expiresAt.Unix(), 10)},
+		"signature": {auth.SignPath(path, expiresAt, cfg.jwtSecret)},
+	})
+}
+
+func (cfg *apiConfig) newDataExportResponse(exportRecord database.DataExport) DataExportResponse {
+	response := DataExportResponse{
+		ID:          exportRecord.ID,
+		Status:      exportRecord.Status,
+		CreatedAt:   exportRecord.CreatedAt,
+		CompletedAt: nullTimePtr(exportRecord.CompletedAt),
+		ExpiresAt:   nullTimePtr(exportRecord.ExpiresAt),
+	}
+
+	if exportRecord.Status == exportStatusReady {
+		response.DownloadURL = cfg.exportDownloadURL(exportRecord.ID)
+	}
+
+	return response
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// starts building an archive of the user's data in the background
+func (cfg *apiConfig) handlerCreateDataExport(w http.ResponseWriter, r *http.Request) {
+	// personal data is only handed to the user, not third-party clients
+	tokenUUID, err := cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	// one export at a time
+	pendingRecord, err := cfg.db.GetPendingDataExportByUserID(r.Context(), tokenUUID)
+	if err == nil {
+		respondWithJSON(w, http.StatusAccepted, cfg.newDataExportResponse(pendingRecord))
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting pending data export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	exportRecord, err := qtx.CreateDataExport(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error creating data export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	_, err = jobs.Enqueue(r.Context(), qtx, dataExportJob{ExportID: exportRecord.ID, UserID: tokenUUID}, jobs.Options{})
+	if err != nil {
+		log.Printf("Error queueing data export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing data export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("Started data export '%s' for user '%s'.", exportRecord.ID, tokenUUID)
+	respondWithJSON(w, http.StatusAccepted, cfg.newDataExportResponse(exportRecord))
+}
+
+// reports the status of an export, with a fresh download link once it is ready
+func (cfg *apiConfig) handlerGetDataExport(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	exportID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Export not found.")
+		return
+	}
+
+	exportRecord, err := cfg.db.GetDataExportByID(r.Context(), exportID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && exportRecord.UserID != tokenUUID) {
+		respondWithError(w, http.StatusNotFound, "Export not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting data export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.newDataExportResponse(exportRecord))
+}
+
+// serves the archive to anyone with a valid signed link
+func (cfg *apiConfig) handlerDownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	exportID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Export not found.")
+		return
+	}
+
+	expiresUnix, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, "Invalid download link.")
+		return
+	}
+
+	err = auth.ValidatePathSignature(exportDownloadPath(exportID), time.Unix(expiresUnix, 0), r.URL.Query().Get("signature"), cfg.jwtSecret)
+	if errors.Is(err, auth.ErrSignatureExpired) {
+		respondWithError(w, http.StatusGone, "Download link has expired.")
+		return
+	}
+	if err != nil {
+		log.Printf("Data export download with bad signature: %s", err)
+		respondWithError(w, http.StatusForbidden, "Invalid download link.")
+		return
+	}
+
+	exportRecord, err := cfg.db.GetDataExportByID(r.Context(), exportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Export not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting data export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if exportRecord.Status != exportStatusReady {
+		respondWithError(w, http.StatusNotFound, "Export not found.")
+		return
+	}
+
+	filename := "chirpy-export-" + exportRecord.CreatedAt.Format("2006-01-02") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(exportRecord.Archive)
+
+	log.Printf("Served data export '%s'.", exportID)
+}
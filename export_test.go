@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// answers the export queries for a single user, as the database would
+type fakeExportQuerier struct {
+	user   database.User
+	chirps []database.Chirp
+	logins []database.LoginEvent
+}
+
+func (q fakeExportQuerier) GetUserByIDRetHashedPassword(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return q.user, nil
+}
+func (q fakeExportQuerier) GetTOTPSecretByUserID(ctx context.Context, userID uuid.UUID) (database.TotpSecret, error) {
+	return database.TotpSecret{}, sql.ErrNoRows
+}
+func (q fakeExportQuerier) ListChirpsByUserIDForExport(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	return q.chirps, nil
+}
+func (q fakeExportQuerier) ListScheduledChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	return nil, nil
+}
+func (q fakeExportQuerier) ListChirpSchedulesByChirpIDs(ctx context.Context, chirpIds []uuid.UUID) ([]database.ChirpSchedule, error) {
+	return nil, nil
+}
+func (q fakeExportQuerier) ListDraftsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Draft, error) {
+	return nil, nil
+}
+func (q fakeExportQuerier) GetProfileByUserID(ctx context.Context, userID uuid.UUID) (database.Profile, error) {
+	return database.Profile{}, sql.ErrNoRows
+}
+func (q fakeExportQuerier) ListRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]database.ListRefreshTokensByUserIDRow, error) {
+	return nil, nil
+}
+func (q fakeExportQuerier) ListOAuthConsentsByUserID(ctx context.Context, userID uuid.UUID) ([]database.OauthConsent, error) {
+	return nil, nil
+}
+func (q fakeExportQuerier) ListLoginEventsByUserID(ctx context.Context, userID uuid.UUID) ([]database.LoginEvent, error) {
+	return q.logins, nil
+}
+
+func TestWriteExportArchive(t *testing.T) {
+	profile := ExportProfile{ID: uuid.New(), Email: "user@example.com"}
+
+	archive := &bytes.Buffer{}
+	err := writeExportArchive(archive, []exportFile{
+		{"profile.json", profile},
+		{"chirps.json", []string{}},
+	})
+	if err != nil {
+		t.Fatalf("unable to write archive: %s", err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("unable to read archive: %s", err)
+	}
+
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	expectedNames := []string{"README.txt", "profile.json", "chirps.json"}
+	if len(names) != len(expectedNames) {
+		t.Fatalf("Expected '%v', received '%v'", expectedNames, names)
+	}
+	for i := range names {
+		if names[i] != expectedNames[i] {
+			t.Errorf("Expected '%s', received '%s'", expectedNames[i], names[i])
+		}
+	}
+
+	profileFile, err := reader.Open("profile.json")
+	if err != nil {
+		t.Fatalf("unable to open profile.json: %s", err)
+	}
+	defer profileFile.Close()
+	profileData, err := io.ReadAll(profileFile)
+	if err != nil {
+		t.Fatalf("unable to read profile.json: %s", err)
+	}
+
+	var decoded ExportProfile
+	err = json.Unmarshal(profileData, &decoded)
+	if err != nil {
+		t.Fatalf("unable to decode profile.json: %s", err)
+	}
+	if decoded.ID != profile.ID || decoded.Email != profile.Email {
+		t.Errorf("Expected '%v', received '%v'", profile, decoded)
+	}
+}
+
+// a user whose account is being deleted still gets every chirp and login in their export
+func TestCollectExportFilesDuringGracePeriod(t *testing.T) {
+	userID := uuid.New()
+	q := fakeExportQuerier{
+		user: database.User{
+			ID:          userID,
+			Email:       "leaving@example.com",
+			DeleteAfter: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+		},
+		chirps: []database.Chirp{
+			{ID: uuid.New(), UserID: userID, Body: "still here"},
+			{ID: uuid.New(), UserID: userID, Body: "deleted", DeletedAt: sql.NullTime{Time: time.Now(), Valid: true}},
+		},
+		logins: []database.LoginEvent{
+			{ID: uuid.New(), UserID: userID, Method: loginMethodPassword, IpAddress: "192.0.2.1"},
+		},
+	}
+
+	files, err := collectExportFiles(context.Background(), q, userID)
+	if err != nil {
+		t.Fatalf("unable to collect export files: %s", err)
+	}
+
+	byName := make(map[string]any)
+	for _, file := range files {
+		byName[file.name] = file.data
+	}
+
+	profile, ok := byName["profile.json"].(ExportProfile)
+	if !ok || profile.DeleteAfter == nil {
+		t.Errorf("Expected profile.json to have delete_after, Got: '%v'", byName["profile.json"])
+	}
+	chirps, ok := byName["chirps.json"].([]ExportChirp)
+	if !ok || len(chirps) != 2 {
+		t.Fatalf("Expected: %d chirps, Got: '%v'", 2, byName["chirps.json"])
+	}
+	if chirps[0].DeletedAt != nil || chirps[1].DeletedAt == nil {
+		t.Errorf("Expected only the second chirp to be deleted, Got: '%v', '%v'", chirps[0].DeletedAt, chirps[1].DeletedAt)
+	}
+	logins, ok := byName["login_history.json"].([]database.LoginEvent)
+	if !ok || len(logins) != 1 {
+		t.Errorf("Expected: %d logins, Got: '%v'", 1, byName["login_history.json"])
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerDownloadDataExportRejects(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	exportID := uuid.New()
+	path := exportDownloadPath(exportID)
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	expiredAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	query := func(expiresAt time.Time, signature string) string {
+		return url.Values{
+			"expires":   {strconv.FormatInt(expiresAt.Unix(), 10)},
+			"signature": {signature},
+		}.Encode()
+	}
+
+	var tests = []struct {
+		query        string
+		expectedCode int
+	}{
+		{"", http.StatusForbidden},
+		{query(expiresAt, "bad"), http.StatusForbidden},
+		{query(expiresAt, auth.SignPath(exportDownloadPath(uuid.New()), expiresAt, cfg.jwtSecret)), http.StatusForbidden},
+		{query(expiredAt, auth.SignPath(path, expiredAt, cfg.jwtSecret)), http.StatusGone},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, path+"?"+test.query, nil)
+		r.SetPathValue("id", exportID.String())
+		w := httptest.NewRecorder()
+
+		cfg.handlerDownloadDataExport(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Query '%s', expected: %d, Got: %d", test.query, test.expectedCode, actualCode)
+		}
+	}
+}
@@ -9,4 +9,11 @@ require (
 	golang.org/x/crypto v0.36.0
 )
 
-require github.com/golang-jwt/jwt/v5 v5.2.1
+require (
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/rivo/uniseg v0.4.7
+	golang.org/x/image v0.25.0
+	golang.org/x/net v0.38.0
+)
+
+require golang.org/x/sys v0.31.0 // indirect
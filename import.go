@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	// rows written per transaction
+	importChunkSize = 500
+	// archives larger than this are rejected
+	importMaxBytes = 64 << 20
+	// longest line accepted in a json lines archive
+	importMaxLineBytes = 1 << 20
+	// only the first errors are listed in the response, all are counted
+	importMaxReportedErrors = 1000
+
+	importFormatJSONL = "jsonl"
+	importFormatCSV   = "csv"
+)
+
+// =====
+// TYPES
+// =====
+
+// one chirp in an import archive
+// the author is given by user_id, or by email when user_id is blank
+type ChirpImportRow struct {
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+}
+type ChirpImportError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+type ChirpImportResponse struct {
+	Imported int                `json:"imported"`
+	Failed   int                `json:"failed"`
+	Errors   []ChirpImportError `json:"errors"`
+}
+
+// reads an archive one row at a time, so it is never held in memory all at once
+type chirpImportReader interface {
+	// returns the next row and its line in the archive, or io.EOF once done
+	// a *importRowError only affects that row, and reading can continue
+	next() (ChirpImportRow, int, error)
+}
+
+type importRowError struct {
+	line int
+	err  error
+}
+
+func (e *importRowError) Error() string {
+	return e.err.Error()
+}
+
+// one line per row, blank lines are skipped
+type jsonlImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// a header row naming the columns, in any order, then one record per row
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// the user a row is imported for, and the chirp length their plan allows
+type importAuthor struct {
+	id             uuid.UUID
+	maxChirpLength int
+}
+
+// a validated row, ready to be written
+type pendingImportChirp struct {
+	line   int
+	params database.ImportChirpParams
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+func newJSONLImportReader(r io.Reader) *jsonlImportReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), importMaxLineBytes)
+
+	return &jsonlImportReader{scanner: scanner}
+}
+
+func (j *jsonlImportReader) next() (ChirpImportRow, int, error) {
+	for j.scanner.Scan() {
+		j.line++
+		line := strings.TrimSpace(j.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var row ChirpImportRow
+		err := json.Unmarshal([]byte(line), &row)
+		if err != nil {
+			return ChirpImportRow{}, j.line, &importRowError{j.line, fmt.Errorf("invalid json: %w", err)}
+		}
+
+		return row, j.line, nil
+	}
+
+	err := j.scanner.Err()
+	if err != nil {
+		return ChirpImportRow{}, j.line, fmt.Errorf("line %d: %w", j.line+1, err)
+	}
+
+	return ChirpImportRow{}, j.line, io.EOF
+}
+
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read header row: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"body", "created_at"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("header row is missing the '%s' column", required)
+		}
+	}
+	_, hasUserID := columns["user_id"]
+	_, hasEmail := columns["email"]
+	if !hasUserID && !hasEmail {
+		return nil, errors.New("header row needs a 'user_id' or 'email' column")
+	}
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvImportReader) next() (ChirpImportRow, int, error) {
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return ChirpImportRow{}, 0, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return ChirpImportRow{}, parseErr.StartLine, &importRowError{parseErr.StartLine, parseErr.Err}
+	}
+	if err != nil {
+		return ChirpImportRow{}, 0, err
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	field := func(name string) string {
+		i, ok := c.columns[name]
+		if !ok {
+			return ""
+		}
+		return record[i]
+	}
+
+	return ChirpImportRow{
+		UserID:    strings.TrimSpace(field("user_id")),
+		Email:     strings.TrimSpace(field("email")),
+		Body:      field("body"),
+		CreatedAt: strings.TrimSpace(field("created_at")),
+	}, line, nil
+}
+
+// picks the archive format from the 'format' query parameter, or the content type
+func importFormat(r *http.Request) (string, error) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = importFormatCSV
+		case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+			format = importFormatJSONL
+		}
+	}
+
+	if !slices.Contains([]string{importFormatJSONL, importFormatCSV}, format) {
+		return "", errors.New("format must be 'jsonl' or 'csv'")
+	}
+
+	return format, nil
+}
+
+// validates the body and timestamp of a row
+// the body is censored and length checked by validateChirp, like any other chirp of its author
+func parseChirpImportRow(row ChirpImportRow, maxLength int) (string, time.Time, error) {
+	if strings.TrimSpace(row.Body) == "" {
+		return "", time.Time{}, errors.New("body is empty")
+	}
+
+	body, err := validateChirp(row.Body, false, maxLength)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if row.CreatedAt == "" {
+		return "", time.Time{}, errors.New("created_at is missing")
+	}
+	createdAt, err := time.Parse(time.RFC3339, row.CreatedAt)
+	if err != nil {
+		return "", time.Time{}, errors.New("created_at must be an RFC 3339 timestamp")
+	}
+	if createdAt.After(time.Now()) {
+		return "", time.Time{}, errors.New("created_at is in the future")
+	}
+
+	return body, createdAt.UTC(), nil
+}
+
+// adds a row error to the response
+func (resp *ChirpImportResponse) fail(line int, err error) {
+	resp.Failed++
+	if len(resp.Errors) < importMaxReportedErrors {
+		resp.Errors = append(resp.Errors, ChirpImportError{Row: line, Error: err.Error()})
+	}
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// imports historical chirps from a json lines or csv archive, keeping their created_at
+// rows are written in chunks, each in its own transaction
+// rows that fail are reported by line, and do not stop the rest of the import
+func (cfg *apiConfig) handlerImportChirps(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authenticateAdmin(r)
+	if err != nil {
+		log.Printf("Unable to authenticate admin request: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	format, err := importFormat(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Archive format must be 'jsonl' or 'csv'.")
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, importMaxBytes)
+
+	var reader chirpImportReader
+	if format == importFormatCSV {
+		reader, err = newCSVImportReader(body)
+		if err != nil {
+			log.Printf("Unable to read csv archive: %s", err)
+			respondWithError(w, http.StatusBadRequest, "Invalid csv archive: "+err.Error())
+			return
+		}
+	} else {
+		reader = newJSONLImportReader(body)
+	}
+
+	response := ChirpImportResponse{Errors: make([]ChirpImportError, 0)}
+
+	// authors and their plans are looked up once, by 'id:<uuid>' or 'email:<email>'
+	authors := make(map[string]importAuthor)
+	resolveAuthor := func(row ChirpImportRow) (importAuthor, error) {
+		if row.UserID == "" && row.Email == "" {
+			return importAuthor{}, errors.New("user_id or email is required")
+		}
+
+		key := "email:" + row.Email
+		if row.UserID != "" {
+			key = "id:" + row.UserID
+		}
+		if author, ok := authors[key]; ok {
+			if author.id == uuid.Nil {
+				return importAuthor{}, errors.New("user not found")
+			}
+			return author, nil
+		}
+
+		var userID uuid.UUID
+		var lookupErr error
+		if row.UserID != "" {
+			userID, lookupErr = uuid.Parse(row.UserID)
+			if lookupErr != nil {
+				return importAuthor{}, errors.New("user_id is not a valid uuid")
+			}
+		} else {
+			var userRecord database.GetUserByEmailSafeRow
+			userRecord, lookupErr = cfg.db.GetUserByEmailSafe(r.Context(), row.Email)
+			userID = userRecord.ID
+		}
+
+		// finds no plan when the user does not exist
+		var entitlements database.PlanEntitlement
+		if lookupErr == nil {
+			entitlements, lookupErr = cfg.db.GetEntitlementsByUserID(r.Context(), userID)
+		}
+		if lookupErr != nil {
+			authors[key] = importAuthor{}
+			return importAuthor{}, errors.New("user not found")
+		}
+
+		author := importAuthor{id: userID, maxChirpLength: int(entitlements.MaxChirpLength)}
+		authors[key] = author
+		return author, nil
+	}
+
+	// writes the chunk in one transaction
+	// if it fails, every row in it is reported, since none of them were written
+	chunk := make([]pendingImportChirp, 0, importChunkSize)
+	flush := func() {
+		if len(chunk) == 0 {
+			return
+		}
+		defer func() {
+			chunk = chunk[:0]
+		}()
+
+		err := func() error {
+			tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			qtx := cfg.db.WithTx(tx)
+
+			for _, pending := range chunk {
+				err = qtx.ImportChirp(r.Context(), pending.params)
+				if err != nil {
+					return fmt.Errorf("row %d: %w", pending.line, err)
+				}
+			}
+
+			return tx.Commit()
+		}()
+		if err != nil {
+			log.Printf("Error importing chunk of %d chirps: %s", len(chunk), err)
+			for _, pending := range chunk {
+				response.fail(pending.line, errors.New("chunk was not imported: "+err.Error()))
+			}
+			return
+		}
+
+		response.Imported += len(chunk)
+	}
+
+	for {
+		row, line, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+
+		var rowErr *importRowError
+		if errors.As(err, &rowErr) {
+			response.fail(rowErr.line, rowErr.err)
+			continue
+		}
+		if err != nil {
+			// the rest of the archive can not be read, keep what was imported so far
+			log.Printf("Unable to read import archive: %s", err)
+			response.fail(line, fmt.Errorf("unable to read the rest of the archive: %w", err))
+			break
+		}
+
+		author, err := resolveAuthor(row)
+		if err != nil {
+			response.fail(line, err)
+			continue
+		}
+
+		chirpBody, createdAt, err := parseChirpImportRow(row, author.maxChirpLength)
+		if err != nil {
+			response.fail(line, err)
+			continue
+		}
+
+		chunk = append(chunk, pendingImportChirp{
+			line: line,
+			params: database.ImportChirpParams{
+				CreatedAt: createdAt,
+				Body:      chirpBody,
+				UserID:    author.id,
+			},
+		})
+		if len(chunk) == importChunkSize {
+			flush()
+		}
+	}
+	flush()
+
+	log.Printf("Imported %d chirps, %d rows failed.", response.Imported, response.Failed)
+	respondWithJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type importReadResult struct {
+	row    ChirpImportRow
+	line   int
+	rowErr bool
+}
+
+func readAllImportRows(t *testing.T, reader chirpImportReader) []importReadResult {
+	results := make([]importReadResult, 0)
+	for {
+		row, line, err := reader.next()
+		if err == io.EOF {
+			return results
+		}
+
+		var rowErr *importRowError
+		if err != nil && !errors.As(err, &rowErr) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		results = append(results, importReadResult{row, line, err != nil})
+	}
+}
+
+func TestJSONLImportReader(t *testing.T) {
+	archive := `{"user_id":"a","body":"first","created_at":"2020-01-01T00:00:00Z"}
+
+not json
+{"email":"user@example.com","body":"second","created_at":"2020-01-02T00:00:00Z"}
+`
+	results := readAllImportRows(t, newJSONLImportReader(strings.NewReader(archive)))
+
+	var tests = []importReadResult{
+		{ChirpImportRow{UserID: "a", Body: "first", CreatedAt: "2020-01-01T00:00:00Z"}, 1, false},
+		{ChirpImportRow{}, 3, true},
+		{ChirpImportRow{Email: "user@example.com", Body: "second", CreatedAt: "2020-01-02T00:00:00Z"}, 4, false},
+	}
+
+	if len(results) != len(tests) {
+		t.Fatalf("Expected %d rows, received %d", len(tests), len(results))
+	}
+	for i, test := range tests {
+		if results[i] != test {
+			t.Errorf("Expected '%v', received '%v'", test, results[i])
+		}
+	}
+}
+
+func TestCSVImportReader(t *testing.T) {
+	archive := `created_at,body,email
+2020-01-01T00:00:00Z,"hello, world",user@example.com
+2020-01-02T00:00:00Z,too,many,fields
+2020-01-03T00:00:00Z,"a
+multiline chirp",user@example.com
+`
+	reader, err := newCSVImportReader(strings.NewReader(archive))
+	if err != nil {
+		t.Fatalf("unable to create reader: %s", err)
+	}
+	results := readAllImportRows(t, reader)
+
+	var tests = []importReadResult{
+		{ChirpImportRow{Email: "user@example.com", Body: "hello, world", CreatedAt: "2020-01-01T00:00:00Z"}, 2, false},
+		{ChirpImportRow{}, 3, true},
+		{ChirpImportRow{Email: "user@example.com", Body: "a\nmultiline chirp", CreatedAt: "2020-01-03T00:00:00Z"}, 4, false},
+	}
+
+	if len(results) != len(tests) {
+		t.Fatalf("Expected %d rows, received %d", len(tests), len(results))
+	}
+	for i, test := range tests {
+		if results[i] != test {
+			t.Errorf("Expected '%v', received '%v'", test, results[i])
+		}
+	}
+}
+
+func TestCSVImportReaderHeader(t *testing.T) {
+	var tests = []struct {
+		header    string
+		expectErr bool
+	}{
+		{"user_id,body,created_at", false},
+		{"Email, Body, Created_At", false},
+		{"body,created_at", true},
+		{"user_id,created_at", true},
+		{"user_id,body", true},
+		{"", true},
+	}
+
+	for _, test := range tests {
+		_, err := newCSVImportReader(strings.NewReader(test.header))
+		if (err != nil) != test.expectErr {
+			t.Errorf("Header '%s', expected error: %t, Got: '%v'", test.header, test.expectErr, err)
+		}
+	}
+}
+
+func TestParseChirpImportRow(t *testing.T) {
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	var tests = []struct {
+		row          ChirpImportRow
+		maxLength    int
+		expectedBody string
+		expectErr    bool
+	}{
+		{ChirpImportRow{UserID: "a", Body: "a kerfuffle", CreatedAt: "2020-01-01T00:00:00+02:00"}, maxChirpLength, "a ****", false},
+		{ChirpImportRow{Email: "user@example.com", Body: "hi", CreatedAt: "2020-01-01T00:00:00Z"}, maxChirpLength, "hi", false},
+		{ChirpImportRow{UserID: "a", Body: " ", CreatedAt: "2020-01-01T00:00:00Z"}, maxChirpLength, "", true},
+		{ChirpImportRow{UserID: "a", Body: strings.Repeat("a", 200), CreatedAt: "2020-01-01T00:00:00Z"}, maxChirpLength, "", true},
+		{ChirpImportRow{UserID: "a", Body: strings.Repeat("a", 200), CreatedAt: "2020-01-01T00:00:00Z"}, 500, strings.Repeat("a", 200), false},
+		{ChirpImportRow{UserID: "a", Body: "hi", CreatedAt: ""}, maxChirpLength, "", true},
+		{ChirpImportRow{UserID: "a", Body: "hi", CreatedAt: "2020-01-01"}, maxChirpLength, "", true},
+		{ChirpImportRow{UserID: "a", Body: "hi", CreatedAt: future}, maxChirpLength, "", true},
+	}
+
+	for _, test := range tests {
+		body, createdAt, err := parseChirpImportRow(test.row, test.maxLength)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Row '%v', expected error: %t, Got: '%v'", test.row, test.expectErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if body != test.expectedBody {
+			t.Errorf("Expected '%s', received '%s'", test.expectedBody, body)
+		}
+		if createdAt.Location() != time.UTC {
+			t.Errorf("Expected '%s' to be in UTC", createdAt)
+		}
+	}
+}
+
+func TestImportFormat(t *testing.T) {
+	var tests = []struct {
+		target      string
+		contentType string
+		expected    string
+		expectErr   bool
+	}{
+		{"/admin/chirps/import?format=csv", "", importFormatCSV, false},
+		{"/admin/chirps/import?format=JSONL", "text/csv", importFormatJSONL, false},
+		{"/admin/chirps/import", "text/csv; charset=utf-8", importFormatCSV, false},
+		{"/admin/chirps/import", "application/x-ndjson", importFormatJSONL, false},
+		{"/admin/chirps/import", "application/json", "", true},
+		{"/admin/chirps/import?format=xml", "", "", true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, test.target, nil)
+		r.Header.Set("Content-Type", test.contentType)
+
+		actual, err := importFormat(r)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Target '%s', expected error: %t, Got: '%v'", test.target, test.expectErr, err)
+		}
+		if actual != test.expected {
+			t.Errorf("Expected '%s', received '%s'", test.expected, actual)
+		}
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerImportChirpsRejects(t *testing.T) {
+	var tests = []struct {
+		adminAPIKey  string
+		header       string
+		target       string
+		body         string
+		expectedCode int
+	}{
+		{"", "ApiKey ", "/admin/chirps/import?format=csv", "", http.StatusUnauthorized},
+		{"key", "", "/admin/chirps/import?format=csv", "", http.StatusUnauthorized},
+		{"key", "ApiKey wrong", "/admin/chirps/import?format=csv", "", http.StatusUnauthorized},
+		{"key", "ApiKey key", "/admin/chirps/import", "", http.StatusUnsupportedMediaType},
+		{"key", "ApiKey key", "/admin/chirps/import?format=csv", "body,created_at\n", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		cfg := apiConfig{adminAPIKey: test.adminAPIKey}
+		r := httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(test.body))
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+		w := httptest.NewRecorder()
+
+		cfg.handlerImportChirps(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Target '%s', expected: %d, Got: %d", test.target, test.expectedCode, actualCode)
+		}
+	}
+}
@@ -12,7 +12,6 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // utility functions
@@ -53,34 +52,6 @@ func GetBearerToken(headers http.Header) (string, error) {
 	return tokenString, nil
 }
 
-// password functions
-
-func HashPassword(password string) (string, error) {
-	if password == "" {
-		log.Print("Empty password provided.")
-		return "", fmt.Errorf("unable to hash empty password")
-	}
-
-	hashedData, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		log.Printf("Unable to hash password: %s", err)
-		return "", err
-	}
-
-	return string(hashedData), nil
-}
-
-// password is from a request, hash is from the db
-func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	if err != nil {
-		log.Printf("Unable to compare hash and password: %s", err)
-		return err
-	}
-
-	return nil
-}
-
 // refresh tokens
 
 func MakeRefreshToken() (string, error) {
@@ -96,17 +67,39 @@ func MakeRefreshToken() (string, error) {
 
 // JWT tokens
 
+// claims carried by access tokens
+// scope and client id are only set for tokens issued to oauth clients
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
 // creates and returns a JWT
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeJWT(userID, "", "", tokenSecret, expiresIn)
+}
+
+// creates and returns a JWT for a third-party oauth client,
+// limited to the granted scope
+func MakeScopedJWT(userID, clientID uuid.UUID, scope, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeJWT(userID, clientID.String(), scope, tokenSecret, expiresIn)
+}
+
+func makeJWT(userID uuid.UUID, clientID, scope, tokenSecret string, expiresIn time.Duration) (string, error) {
 	currentTime := time.Now().UTC()
 	expirationTime := currentTime.UTC().Add(expiresIn)
 
 	signingMethod := jwt.SigningMethodHS256
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(currentTime),
-		ExpiresAt: jwt.NewNumericDate(expirationTime),
-		Subject:   userID.String(),
+	claims := AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(currentTime),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			Subject:   userID.String(),
+		},
+		Scope:    scope,
+		ClientID: clientID,
 	}
 	token := jwt.NewWithClaims(signingMethod, claims)
 
@@ -122,9 +115,25 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
+	claims, err := ValidateJWTClaims(tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userUUID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		// log.Printf("Error parsing userID from token claim: %v", err)
+		return uuid.Nil, err
+	}
+
+	return userUUID, nil
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, &claims,
+// validates the JWT and returns all of its claims
+func ValidateJWTClaims(tokenString, tokenSecret string) (AccessClaims, error) {
+	claims := AccessClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims,
 		func(token *jwt.Token) (any, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return uuid.Nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -133,21 +142,86 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		})
 	if err != nil {
 		// log.Printf("Error validating JWT: %v", err)
-		return uuid.Nil, err
+		return AccessClaims{}, err
+	}
+
+	if claims.Subject == "" {
+		return AccessClaims{}, errors.New("token has no subject")
+	}
+
+	// tokens with an audience are for a specific step (e.g. mfa), not api access
+	if len(claims.Audience) > 0 {
+		return AccessClaims{}, errors.New("token is not an access token")
+	}
+
+	return claims, nil
+}
+
+// single purpose tokens
+
+// audiences for tokens that prove one specific step, and are not access tokens
+const (
+	PurposeMFAChallenge      = "chirpy-mfa"
+	PurposeEmailVerification = "chirpy-email-verification"
+	PurposePasswordReset     = "chirpy-password-reset"
+)
+
+// claims carried by single purpose tokens
+// the token id lets the caller make the token single use,
+// and the email binds a verification token to the address it was sent to
+type PurposeClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email,omitempty"`
+}
+
+// creates a JWT that is only valid for the given purpose
+func MakePurposeJWT(userID uuid.UUID, purpose, tokenID, email, tokenSecret string, expiresIn time.Duration) (string, error) {
+	currentTime := time.Now().UTC()
+	claims := PurposeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(currentTime),
+			ExpiresAt: jwt.NewNumericDate(currentTime.Add(expiresIn)),
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{purpose},
+			ID:        tokenID,
+		},
+		Email: email,
 	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	userID, err := token.Claims.GetSubject()
+	return token.SignedString([]byte(tokenSecret))
+}
+
+// validates a single purpose JWT, rejecting tokens made for any other purpose
+func ValidatePurposeJWT(tokenString, purpose, tokenSecret string) (PurposeClaims, error) {
+	claims := PurposeClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims,
+		func(token *jwt.Token) (any, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return uuid.Nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(tokenSecret), nil
+		},
+		jwt.WithAudience(purpose))
 	if err != nil {
-		// log.Printf("Error accessing token subject: %v", err)
-		return uuid.Nil, err
+		return PurposeClaims{}, err
 	}
-	// log.Printf("UserID from token: %s", userID)
 
-	userUUID, err := uuid.Parse(userID)
+	return claims, nil
+}
+
+// creates a short lived JWT proving the password step of login succeeded
+func MakeMFAChallengeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return MakePurposeJWT(userID, PurposeMFAChallenge, "", "", tokenSecret, expiresIn)
+}
+
+func ValidateMFAChallengeJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := ValidatePurposeJWT(tokenString, PurposeMFAChallenge, tokenSecret)
 	if err != nil {
-		// log.Printf("Error parsing userID from token claim: %v", err)
 		return uuid.Nil, err
 	}
 
-	return userUUID, nil
+	return uuid.Parse(claims.Subject)
 }
@@ -56,9 +56,13 @@ func TestHashPassword(t *testing.T) {
 			t.Fatalf("Error in HashPassword function: %s", err)
 		}
 
-		if auth.CheckPasswordHash(test.input, actual) != nil {
+		needsRehash, err := auth.CheckPasswordHash(test.input, actual)
+		if err != nil {
 			t.Error("Hash provided does not match.")
 		}
+		if needsRehash {
+			t.Error("Fresh hash should not need a rehash.")
+		}
 	}
 }
 
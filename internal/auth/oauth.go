@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// oauth scopes
+
+// scopes that can be granted to third-party clients
+// first-party tokens (from POST /api/login) carry no scope and have full access
+const (
+	ScopeChirpsWrite   = "chirps:write"
+	ScopeUsersWrite    = "users:write"
+	ScopeWebhooksWrite = "webhooks:write"
+)
+
+var SupportedScopes = []string{ScopeChirpsWrite, ScopeUsersWrite, ScopeWebhooksWrite}
+
+// splits a space-delimited scope string (RFC 6749, section 3.3)
+// duplicate scopes are removed and the order is preserved
+func ParseScope(scope string) []string {
+	scopes := make([]string, 0)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes
+}
+
+// checks that every requested scope is one chirpy knows about
+func ValidateScope(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("no scope requested")
+	}
+
+	for _, s := range scopes {
+		if !slices.Contains(SupportedScopes, s) {
+			return fmt.Errorf("unsupported scope '%s'", s)
+		}
+	}
+
+	return nil
+}
+
+// reports if every requested scope is within the granted scopes
+func ScopeCovers(granted, requested []string) bool {
+	for _, s := range requested {
+		if !slices.Contains(granted, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PKCE (RFC 7636)
+
+const PKCEMethodS256 = "S256"
+
+// verifies the code verifier against the challenge sent to /authorize
+// only the S256 method is accepted, plain is not
+func VerifyPKCE(verifier, challenge, method string) error {
+	if method != PKCEMethodS256 {
+		return fmt.Errorf("unsupported code challenge method '%s'", method)
+	}
+
+	// verifier must be 43 to 128 characters long (section 4.1)
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return errors.New("code verifier has invalid length")
+	}
+	for _, c := range verifier {
+		if !isUnreservedChar(c) {
+			return errors.New("code verifier contains invalid characters")
+		}
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) != 1 {
+		return errors.New("code verifier does not match challenge")
+	}
+
+	return nil
+}
+
+// ALPHA / DIGIT / "-" / "." / "_" / "~"
+func isUnreservedChar(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c == '-', c == '.', c == '_', c == '~':
+		return true
+	}
+
+	return false
+}
+
+// token hashing
+
+// hashes an opaque token for storage, so a leaked table does not leak usable tokens
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+)
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"chirps:write", []string{"chirps:write"}},
+		{"chirps:write  users:write", []string{"chirps:write", "users:write"}},
+		{"chirps:write chirps:write", []string{"chirps:write"}},
+		{"", []string{}},
+	}
+
+	for _, test := range tests {
+		actual := auth.ParseScope(test.input)
+		if !slices.Equal(actual, test.expected) {
+			t.Errorf("Expected: '%v', Got: '%v'", test.expected, actual)
+		}
+	}
+}
+
+func TestValidateScope(t *testing.T) {
+	tests := []struct {
+		input     []string
+		expectErr bool
+	}{
+		{[]string{auth.ScopeChirpsWrite}, false},
+		{[]string{auth.ScopeChirpsWrite, auth.ScopeUsersWrite}, false},
+		{[]string{"admin"}, true},
+		{[]string{}, true},
+	}
+
+	for _, test := range tests {
+		err := auth.ValidateScope(test.input)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Scope '%v', expected error: %t, Got: '%v'", test.input, test.expectErr, err)
+		}
+	}
+}
+
+func TestScopeCovers(t *testing.T) {
+	tests := []struct {
+		granted   []string
+		requested []string
+		expected  bool
+	}{
+		{[]string{"chirps:write", "users:write"}, []string{"chirps:write"}, true},
+		{[]string{"chirps:write"}, []string{"chirps:write", "users:write"}, false},
+		{[]string{}, []string{"chirps:write"}, false},
+		{[]string{"chirps:write"}, []string{}, true},
+	}
+
+	for _, test := range tests {
+		actual := auth.ScopeCovers(test.granted, test.requested)
+		if actual != test.expected {
+			t.Errorf("Granted '%v', requested '%v'. Expected: %t, Got: %t", test.granted, test.requested, test.expected, actual)
+		}
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		verifier  string
+		challenge string
+		method    string
+		expectErr bool
+	}{
+		{verifier, challenge, "S256", false},
+		// RFC 7636 appendix B example
+		{verifier, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", false},
+		{verifier, challenge, "plain", true},
+		{verifier + "x", challenge, "S256", true},
+		{"short", challenge, "S256", true},
+		{verifier[:42] + "!", challenge, "S256", true},
+	}
+
+	for _, test := range tests {
+		err := auth.VerifyPKCE(test.verifier, test.challenge, test.method)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Verifier '%s', expected error: %t, Got: '%v'", test.verifier, test.expectErr, err)
+		}
+	}
+}
+
+func TestScopedJWT(t *testing.T) {
+	userID := uuid.New()
+	clientID := uuid.New()
+	secret := "secret"
+
+	token, err := auth.MakeScopedJWT(userID, clientID, "chirps:write", secret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+
+	claims, err := auth.ValidateJWTClaims(token, secret)
+	if err != nil {
+		t.Fatalf("unable to validate JWT: %s", err)
+	}
+	if claims.Subject != userID.String() {
+		t.Errorf("Expected subject: '%s', Got: '%s'", userID, claims.Subject)
+	}
+	if claims.ClientID != clientID.String() {
+		t.Errorf("Expected client id: '%s', Got: '%s'", clientID, claims.ClientID)
+	}
+	if claims.Scope != "chirps:write" {
+		t.Errorf("Expected scope: 'chirps:write', Got: '%s'", claims.Scope)
+	}
+
+	// first-party tokens carry no scope or client
+	token, err = auth.MakeJWT(userID, secret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+	claims, err = auth.ValidateJWTClaims(token, secret)
+	if err != nil {
+		t.Fatalf("unable to validate JWT: %s", err)
+	}
+	if claims.ClientID != "" || claims.Scope != "" {
+		t.Errorf("Expected no client or scope, Got: '%s', '%s'", claims.ClientID, claims.Scope)
+	}
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// password functions
+
+// hashes are stored in the PHC string format:
+//   $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+// older bcrypt hashes ($2a$, $2b$, $2y$) are still accepted, and are
+// reported as needing a rehash so they get upgraded on the next login
+
+// argon2id cost parameters
+type Argon2Params struct {
+	// memory in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// OWASP's recommended minimum for argon2id: 19 MiB, 2 iterations, 1 thread
+var DefaultArgon2Params = Argon2Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var (
+	passwordParamsMu sync.RWMutex
+	passwordParams   = DefaultArgon2Params
+)
+
+var ErrInvalidHash = errors.New("password hash is not in a supported format")
+
+// sets the parameters new hashes are made with
+// hashes made with other parameters are reported as needing a rehash
+func SetArgon2Params(params Argon2Params) error {
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return errors.New("argon2 memory must be at least 8 KiB per thread")
+	}
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return errors.New("argon2 iterations and parallelism must be at least 1")
+	}
+	if params.SaltLength < 8 || params.KeyLength < 16 {
+		return errors.New("argon2 salt must be at least 8 bytes and key at least 16 bytes")
+	}
+
+	passwordParamsMu.Lock()
+	defer passwordParamsMu.Unlock()
+	passwordParams = params
+
+	return nil
+}
+
+func currentArgon2Params() Argon2Params {
+	passwordParamsMu.RLock()
+	defer passwordParamsMu.RUnlock()
+
+	return passwordParams
+}
+
+// hashes the password with argon2id and the current parameters
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		log.Print("Empty password provided.")
+		return "", fmt.Errorf("unable to hash empty password")
+	}
+
+	params := currentArgon2Params()
+	salt := make([]byte, params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		log.Printf("Unable to generate salt: %s", err)
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return encodeArgon2Hash(params, salt, key), nil
+}
+
+// password is from a request, hash is from the db
+// needsRehash reports if the hash should be replaced with a new HashPassword,
+// it is only meaningful when err is nil
+func CheckPasswordHash(password, hash string) (needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2Hash(hash)
+		if err != nil {
+			log.Printf("Unable to decode password hash: %s", err)
+			return false, err
+		}
+
+		computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, errors.New("password does not match hash")
+		}
+
+		current := currentArgon2Params()
+		return params.Memory != current.Memory ||
+			params.Iterations != current.Iterations ||
+			params.Parallelism != current.Parallelism ||
+			params.KeyLength != current.KeyLength ||
+			uint32(len(salt)) != current.SaltLength, nil
+
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err != nil {
+			log.Printf("Unable to compare hash and password: %s", err)
+			return false, err
+		}
+
+		// bcrypt only looks at the first 72 bytes, always upgrade
+		return true, nil
+
+	default:
+		return false, ErrInvalidHash
+	}
+}
+
+func encodeArgon2Hash(params Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return Argon2Params{}, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	params := Argon2Params{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,139 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nicholasss/chirpy/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPasswordFormat(t *testing.T) {
+	hash, err := auth.HashPassword("weakPassword")
+	if err != nil {
+		t.Fatalf("Error in HashPassword function: %s", err)
+	}
+
+	expectedPrefix := "$argon2id$v=19$m=19456,t=2,p=1$"
+	if !strings.HasPrefix(hash, expectedPrefix) {
+		t.Errorf("Expected prefix: '%s', Got: '%s'", expectedPrefix, hash)
+	}
+	if len(strings.Split(hash, "$")) != 6 {
+		t.Errorf("Expected 6 PHC sections, Got: '%s'", hash)
+	}
+
+	// salts are random, so hashes of the same password differ
+	other, _ := auth.HashPassword("weakPassword")
+	if hash == other {
+		t.Error("Expected different hashes for the same password")
+	}
+}
+
+func TestCheckPasswordHashWrongPassword(t *testing.T) {
+	hash, err := auth.HashPassword("weakPassword")
+	if err != nil {
+		t.Fatalf("Error in HashPassword function: %s", err)
+	}
+
+	_, err = auth.CheckPasswordHash("wrongPassword", hash)
+	if err == nil {
+		t.Error("Expected error for wrong password")
+	}
+}
+
+func TestLongPasswordNotTruncated(t *testing.T) {
+	// bcrypt would ignore everything after the 72nd byte
+	prefix := strings.Repeat("a", 72)
+	hash, err := auth.HashPassword(prefix + "first")
+	if err != nil {
+		t.Fatalf("Error in HashPassword function: %s", err)
+	}
+
+	_, err = auth.CheckPasswordHash(prefix+"second", hash)
+	if err == nil {
+		t.Error("Expected passwords differing after 72 bytes to not match")
+	}
+}
+
+func TestBcryptHashNeedsRehash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("legacyPassword"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Error generating bcrypt hash: %s", err)
+	}
+
+	needsRehash, err := auth.CheckPasswordHash("legacyPassword", string(bcryptHash))
+	if err != nil {
+		t.Fatalf("Expected legacy bcrypt hash to verify: %s", err)
+	}
+	if !needsRehash {
+		t.Error("Expected bcrypt hash to need a rehash")
+	}
+
+	_, err = auth.CheckPasswordHash("wrongPassword", string(bcryptHash))
+	if err == nil {
+		t.Error("Expected error for wrong password")
+	}
+}
+
+func TestChangedParamsNeedRehash(t *testing.T) {
+	hash, err := auth.HashPassword("weakPassword")
+	if err != nil {
+		t.Fatalf("Error in HashPassword function: %s", err)
+	}
+
+	stronger := auth.DefaultArgon2Params
+	stronger.Iterations = 3
+	if err := auth.SetArgon2Params(stronger); err != nil {
+		t.Fatalf("Error setting params: %s", err)
+	}
+	defer auth.SetArgon2Params(auth.DefaultArgon2Params)
+
+	needsRehash, err := auth.CheckPasswordHash("weakPassword", hash)
+	if err != nil {
+		t.Fatalf("Expected old hash to still verify: %s", err)
+	}
+	if !needsRehash {
+		t.Error("Expected hash with old params to need a rehash")
+	}
+
+	upgraded, _ := auth.HashPassword("weakPassword")
+	if !strings.Contains(upgraded, "t=3") {
+		t.Errorf("Expected new hash to use t=3, Got: '%s'", upgraded)
+	}
+	needsRehash, err = auth.CheckPasswordHash("weakPassword", upgraded)
+	if err != nil || needsRehash {
+		t.Errorf("Expected upgraded hash to verify without rehash, Got: %t, '%v'", needsRehash, err)
+	}
+}
+
+func TestInvalidHashes(t *testing.T) {
+	tests := []string{
+		"unset",
+		"",
+		"$argon2id$v=19$m=19456,t=2,p=1$onlysalt",
+		"$argon2id$v=18$m=19456,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=19456,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+		"$argon2i$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+	}
+
+	for _, test := range tests {
+		_, err := auth.CheckPasswordHash("password", test)
+		if err == nil {
+			t.Errorf("Expected error for hash '%s'", test)
+		}
+	}
+}
+
+func TestSetArgon2ParamsValidation(t *testing.T) {
+	invalid := auth.DefaultArgon2Params
+	invalid.Iterations = 0
+	if err := auth.SetArgon2Params(invalid); err == nil {
+		t.Error("Expected error for zero iterations")
+	}
+
+	invalid = auth.DefaultArgon2Params
+	invalid.Memory = 4
+	if err := auth.SetArgon2Params(invalid); err == nil {
+		t.Error("Expected error for too little memory")
+	}
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// password policy
+
+// names of the rules a password can violate
+const (
+	RuleMinLength  = "min_length"
+	RuleMinEntropy = "min_entropy"
+	RuleNoEmail    = "no_email"
+	RuleBreached   = "breached"
+)
+
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type PasswordPolicy struct {
+	// minimum length in characters (runes)
+	MinLength int
+	// minimum estimated entropy in bits, see EstimateEntropy
+	MinEntropyBits float64
+	// reject passwords containing the user's email or its local part
+	DisallowEmail bool
+	// optional, skipped when nil
+	Breached *BreachedCorpus
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      8,
+	MinEntropyBits: 40,
+	DisallowEmail:  true,
+}
+
+// checks the password against every rule and returns all violations
+// an error is only returned if the breached corpus could not be read
+func (p PasswordPolicy) Check(password, email string) ([]PolicyViolation, error) {
+	violations := make([]PolicyViolation, 0)
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long.", p.MinLength),
+		})
+	}
+
+	if EstimateEntropy(password) < p.MinEntropyBits {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleMinEntropy,
+			Message: "Password is too easy to guess. Try a longer password, or mix in other kinds of characters.",
+		})
+	}
+
+	if p.DisallowEmail && containsEmail(password, email) {
+		violations = append(violations, PolicyViolation{
+			Rule:    RuleNoEmail,
+			Message: "Password must not contain your email.",
+		})
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, PolicyViolation{
+				Rule:    RuleBreached,
+				Message: "Password has appeared in a data breach, please choose another.",
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+func containsEmail(password, email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	lowerPassword := strings.ToLower(password)
+
+	if strings.Contains(lowerPassword, email) {
+		return true
+	}
+
+	// very short local parts (e.g. "al@") would reject too many passwords
+	localPart, _, _ := strings.Cut(email, "@")
+	return utf8.RuneCountInString(localPart) >= 3 && strings.Contains(lowerPassword, localPart)
+}
+
+// estimates the entropy of a password in bits
+// each character is worth log2 of the size of the character classes used,
+// except repeats and runs (e.g. "aaa", "abc", "321") which are worth 1 bit
+func EstimateEntropy(password string) float64 {
+	if password == "" {
+		return 0
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol, hasOther bool
+	for _, c := range password {
+		switch {
+		case c >= 'a' && c <= 'z':
+			hasLower = true
+		case c >= 'A' && c <= 'Z':
+			hasUpper = true
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case c < utf8.RuneSelf && unicode.IsPrint(c):
+			hasSymbol = true
+		default:
+			hasOther = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{
+		{hasLower, 26},
+		{hasUpper, 26},
+		{hasDigit, 10},
+		{hasSymbol, 33},
+		{hasOther, 100},
+	} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	bitsPerChar := math.Log2(float64(pool))
+
+	entropy := 0.0
+	previous := rune(-1)
+	for _, c := range password {
+		delta := c - previous
+		if previous != -1 && (delta == 0 || delta == 1 || delta == -1) {
+			entropy += 1
+		} else {
+			entropy += bitsPerChar
+		}
+		previous = c
+	}
+
+	return entropy
+}
+
+// breached passwords
+
+// a local corpus of breached password SHA-1 hashes, looked up by the
+// first 5 hex characters of the hash like the Pwned Passwords range API
+//
+// the corpus is either:
+//   - a file with one "HASH:COUNT" line per password, loaded into memory
+//   - a directory of range files named "<PREFIX>.txt", each holding
+//     "SUFFIX:COUNT" lines, where only the one range file is read per check
+type BreachedCorpus struct {
+	dir    string
+	ranges map[string]map[string]struct{}
+}
+
+const breachedPrefixLength = 5
+
+func LoadBreachedCorpus(path string) (*BreachedCorpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &BreachedCorpus{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	corpus := &BreachedCorpus{ranges: make(map[string]map[string]struct{})}
+	err = scanBreachedLines(file, func(hash string) {
+		if len(hash) != sha1.Size*2 {
+			return
+		}
+		prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+		if corpus.ranges[prefix] == nil {
+			corpus.ranges[prefix] = make(map[string]struct{})
+		}
+		corpus.ranges[prefix][suffix] = struct{}{}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return corpus, nil
+}
+
+// reports if the password's hash is in the corpus
+func (c *BreachedCorpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+
+	if c.dir == "" {
+		_, ok := c.ranges[prefix][suffix]
+		return ok, nil
+	}
+
+	file, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	found := false
+	err = scanBreachedLines(file, func(lineSuffix string) {
+		if lineSuffix == suffix {
+			found = true
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// calls fn with the uppercased hash of every line
+// lines with a count of 0 are padding and are skipped
+func scanBreachedLines(r io.Reader, fn func(hash string)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, count, _ := strings.Cut(line, ":")
+		if strings.TrimSpace(count) == "0" {
+			continue
+		}
+		fn(strings.ToUpper(strings.TrimSpace(hash)))
+	}
+
+	return scanner.Err()
+}
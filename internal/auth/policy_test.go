@@ -0,0 +1,156 @@
+package auth_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nicholasss/chirpy/internal/auth"
+)
+
+func sha1Upper(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func violatedRules(violations []auth.PolicyViolation) []string {
+	rules := make([]string, 0)
+	for _, violation := range violations {
+		rules = append(rules, violation.Rule)
+	}
+	return rules
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := auth.DefaultPasswordPolicy
+
+	tests := []struct {
+		password string
+		email    string
+		expected []string
+	}{
+		{"Strong32Passw264!-=d", "tim@apple.com", []string{}},
+		{"short", "tim@apple.com", []string{auth.RuleMinLength, auth.RuleMinEntropy}},
+		{"aaaaaaaaaaaaaaaa", "tim@apple.com", []string{auth.RuleMinEntropy}},
+		{"abcdefghijklmnop", "tim@apple.com", []string{auth.RuleMinEntropy}},
+		{"Xq9!timcook#Lz7", "timcook@apple.com", []string{auth.RuleNoEmail}},
+		{"prefix-TIM@APPLE.COM", "tim@apple.com", []string{auth.RuleNoEmail}},
+		// short local parts are not checked on their own
+		{"Xq9!al#Lz7vW2", "al@apple.com", []string{}},
+	}
+
+	for _, test := range tests {
+		violations, err := policy.Check(test.password, test.email)
+		if err != nil {
+			t.Fatalf("Error checking policy: %s", err)
+		}
+
+		actual := violatedRules(violations)
+		if !slices.Equal(actual, test.expected) {
+			t.Errorf("Password '%s'. Expected: '%v', Got: '%v'", test.password, test.expected, actual)
+		}
+	}
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	if auth.EstimateEntropy("") != 0 {
+		t.Error("Expected no entropy for an empty password")
+	}
+
+	// more character classes, more entropy per character
+	if auth.EstimateEntropy("abcxyzqw") >= auth.EstimateEntropy("aBcXy9!w") {
+		t.Error("Expected mixed classes to have more entropy")
+	}
+
+	// runs are only worth 1 bit per character after the first
+	if auth.EstimateEntropy("abcdefgh") > 15 {
+		t.Errorf("Expected a run to have little entropy, Got: %f", auth.EstimateEntropy("abcdefgh"))
+	}
+}
+
+func TestBreachedCorpusFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	corpus := "# pwned passwords\n" +
+		sha1Upper("password123") + ":1024\n" +
+		strings.ToLower(sha1Upper("hunter2")) + ":12\n" +
+		sha1Upper("padding-entry") + ":0\n"
+	if err := os.WriteFile(path, []byte(corpus), 0o600); err != nil {
+		t.Fatalf("Error writing corpus: %s", err)
+	}
+
+	breached, err := auth.LoadBreachedCorpus(path)
+	if err != nil {
+		t.Fatalf("Error loading corpus: %s", err)
+	}
+
+	tests := []struct {
+		password string
+		expected bool
+	}{
+		{"password123", true},
+		{"hunter2", true},
+		{"padding-entry", false},
+		{"Strong32Passw264!-=d", false},
+	}
+
+	for _, test := range tests {
+		actual, err := breached.Contains(test.password)
+		if err != nil {
+			t.Fatalf("Error checking corpus: %s", err)
+		}
+		if actual != test.expected {
+			t.Errorf("Password '%s'. Expected: %t, Got: %t", test.password, test.expected, actual)
+		}
+	}
+}
+
+func TestBreachedCorpusDirectory(t *testing.T) {
+	dir := t.TempDir()
+	hash := sha1Upper("password123")
+	rangeFile := filepath.Join(dir, hash[:5]+".txt")
+	if err := os.WriteFile(rangeFile, []byte(hash[5:]+":1024\r\n"), 0o600); err != nil {
+		t.Fatalf("Error writing range file: %s", err)
+	}
+
+	breached, err := auth.LoadBreachedCorpus(dir)
+	if err != nil {
+		t.Fatalf("Error loading corpus: %s", err)
+	}
+
+	actual, err := breached.Contains("password123")
+	if err != nil || !actual {
+		t.Errorf("Expected 'password123' to be breached, Got: %t, '%v'", actual, err)
+	}
+
+	// no range file for the prefix
+	actual, err = breached.Contains("Strong32Passw264!-=d")
+	if err != nil || actual {
+		t.Errorf("Expected password to not be breached, Got: %t, '%v'", actual, err)
+	}
+}
+
+func TestPasswordPolicyBreached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(sha1Upper("Strong32Passw264!-=d")+":3\n"), 0o600); err != nil {
+		t.Fatalf("Error writing corpus: %s", err)
+	}
+	breached, err := auth.LoadBreachedCorpus(path)
+	if err != nil {
+		t.Fatalf("Error loading corpus: %s", err)
+	}
+
+	policy := auth.DefaultPasswordPolicy
+	policy.Breached = breached
+
+	violations, err := policy.Check("Strong32Passw264!-=d", "tim@apple.com")
+	if err != nil {
+		t.Fatalf("Error checking policy: %s", err)
+	}
+	if !slices.Equal(violatedRules(violations), []string{auth.RuleBreached}) {
+		t.Errorf("Expected only the breached rule, Got: '%v'", violatedRules(violations))
+	}
+}
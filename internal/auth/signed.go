@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signed urls
+
+var (
+	ErrSignatureExpired = errors.New("signature has expired")
+	ErrSignatureInvalid = errors.New("signature is invalid")
+	ErrSignatureMissing = errors.New("signature is missing")
+)
+
+// signs the path and expiry, so a link to the path works without an access token until it expires
+func SignPath(path string, expiresAt time.Time, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	// prefixed so the signature can not be mistaken for any other use of the secret
+	fmt.Fprintf(mac, "chirpy-signed-path\n%s\n%d", path, expiresAt.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checks a signature made by SignPath
+func ValidatePathSignature(path string, expiresAt time.Time, signature, secret string) error {
+	expected := SignPath(path, expiresAt, secret)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrSignatureInvalid
+	}
+
+	if time.Now().After(expiresAt) {
+		return ErrSignatureExpired
+	}
+
+	return nil
+}
+
+// signed webhooks
+
+// the version prefix of webhook signatures, 'v1=<hex hmac-sha256>'
+const webhookSignatureVersion = "v1="
+
+// signs a webhook body sent at the timestamp
+// the timestamp is signed too, so an old delivery can not be sent again with a new one
+func SignWebhook(body []byte, timestamp time.Time, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp.Unix())
+	mac.Write(body)
+	return webhookSignatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// checks the signature header of a webhook against each of the secrets, so a secret can be
+// rotated by accepting the old and new ones for a while
+// the header may carry several comma separated signatures, any one valid signature is enough
+// the timestamp header is in unix seconds, and must be within tolerance of now
+func ValidateWebhookSignature(body []byte, timestampHeader, signatureHeader string, secrets []string, tolerance time.Duration, now time.Time) error {
+	if timestampHeader == "" || signatureHeader == "" {
+		return ErrSignatureMissing
+	}
+
+	seconds, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	timestamp := time.Unix(seconds, 0)
+	if timestamp.Before(now.Add(-tolerance)) || timestamp.After(now.Add(tolerance)) {
+		return ErrSignatureExpired
+	}
+
+	for _, signature := range strings.Split(signatureHeader, ",") {
+		signature = strings.TrimSpace(signature)
+		if !strings.HasPrefix(signature, webhookSignatureVersion) {
+			continue
+		}
+
+		for _, secret := range secrets {
+			expected := SignWebhook(body, timestamp, secret)
+			if hmac.Equal([]byte(expected), []byte(signature)) {
+				return nil
+			}
+		}
+	}
+
+	return ErrSignatureInvalid
+}
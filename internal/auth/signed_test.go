@@ -0,0 +1,77 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nicholasss/chirpy/internal/auth"
+)
+
+func TestValidatePathSignature(t *testing.T) {
+	secret := "secret"
+	path := "/api/exports/123/download"
+	expiresAt := time.Now().Add(time.Minute)
+	signature := auth.SignPath(path, expiresAt, secret)
+
+	expiredAt := time.Now().Add(-time.Minute)
+	expiredSignature := auth.SignPath(path, expiredAt, secret)
+
+	var tests = []struct {
+		path        string
+		expiresAt   time.Time
+		signature   string
+		secret      string
+		expectedErr error
+	}{
+		{path, expiresAt, signature, secret, nil},
+		{"/api/exports/456/download", expiresAt, signature, secret, auth.ErrSignatureInvalid},
+		{path, expiresAt.Add(time.Hour), signature, secret, auth.ErrSignatureInvalid},
+		{path, expiresAt, signature, "other secret", auth.ErrSignatureInvalid},
+		{path, expiresAt, "", secret, auth.ErrSignatureInvalid},
+		{path, expiredAt, expiredSignature, secret, auth.ErrSignatureExpired},
+	}
+
+	for _, test := range tests {
+		err := auth.ValidatePathSignature(test.path, test.expiresAt, test.signature, test.secret)
+		if !errors.Is(err, test.expectedErr) {
+			t.Errorf("Expected: '%v', Got: '%v'", test.expectedErr, err)
+		}
+	}
+}
+
+func TestValidateWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded"}`)
+	now := time.Unix(1700000000, 0)
+	timestamp := "1700000000"
+	secrets := []string{"new secret", "old secret"}
+	signature := auth.SignWebhook(body, now, "old secret")
+	stale := now.Add(-time.Minute * 10)
+
+	var tests = []struct {
+		name        string
+		body        []byte
+		timestamp   string
+		signature   string
+		expectedErr error
+	}{
+		{"valid", body, timestamp, signature, nil},
+		{"one of several", body, timestamp, "v1=deadbeef, " + signature, nil},
+		{"other body", []byte(`{"event":"user.refunded"}`), timestamp, signature, auth.ErrSignatureInvalid},
+		{"other timestamp", body, "1700000001", signature, auth.ErrSignatureInvalid},
+		{"unknown secret", body, timestamp, auth.SignWebhook(body, now, "other secret"), auth.ErrSignatureInvalid},
+		{"no version", body, timestamp, signature[len("v1="):], auth.ErrSignatureInvalid},
+		{"bad timestamp", body, "yesterday", signature, auth.ErrSignatureInvalid},
+		{"too old", body, "1699999400", auth.SignWebhook(body, stale, "new secret"), auth.ErrSignatureExpired},
+		{"too new", body, "1700000600", signature, auth.ErrSignatureExpired},
+		{"no signature", body, timestamp, "", auth.ErrSignatureMissing},
+		{"no timestamp", body, "", signature, auth.ErrSignatureMissing},
+	}
+
+	for _, test := range tests {
+		err := auth.ValidateWebhookSignature(test.body, test.timestamp, test.signature, secrets, time.Minute*5, now)
+		if !errors.Is(err, test.expectedErr) {
+			t.Errorf("%s: Expected: '%v', Got: '%v'", test.name, test.expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package auth_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+)
+
+// RFC 6238 appendix B vectors (SHA1), truncated to 6 digits
+func TestGenerateTOTPCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unixTime int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, test := range tests {
+		actual, err := auth.GenerateTOTPCode(secret, time.Unix(test.unixTime, 0))
+		if err != nil {
+			t.Fatalf("Error generating code: %s", err)
+		}
+		if actual != test.expected {
+			t.Errorf("Time %d. Expected: '%s', Got: '%s'", test.unixTime, test.expected, actual)
+		}
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Error generating secret: %s", err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		codeTime  time.Time
+		expectErr bool
+	}{
+		{now, false},
+		{now.Add(-30 * time.Second), false},
+		{now.Add(30 * time.Second), false},
+		{now.Add(-90 * time.Second), true},
+		{now.Add(90 * time.Second), true},
+	}
+
+	for _, test := range tests {
+		code, err := auth.GenerateTOTPCode(secret, test.codeTime)
+		if err != nil {
+			t.Fatalf("Error generating code: %s", err)
+		}
+
+		step, err := auth.ValidateTOTPCode(secret, code, now)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Code from %s, expected error: %t, Got: '%v'", test.codeTime, test.expectErr, err)
+		}
+		if err == nil && step != test.codeTime.Unix()/30 {
+			t.Errorf("Expected step %d, Got: %d", test.codeTime.Unix()/30, step)
+		}
+	}
+
+	if _, err := auth.ValidateTOTPCode(secret, "12345", now); err == nil {
+		t.Error("Expected error for short code")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := auth.TOTPURI("Chirpy", "tim@apple.com", "JBSWY3DPEHPK3PXP")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:tim@apple.com?") {
+		t.Errorf("Unexpected uri prefix: '%s'", uri)
+	}
+	for _, param := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=Chirpy", "digits=6", "period=30"} {
+		if !strings.Contains(uri, param) {
+			t.Errorf("Expected '%s' in uri '%s'", param, uri)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := auth.GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("Error generating recovery codes: %s", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("Expected 10 codes, Got: %d", len(codes))
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if seen[code] {
+			t.Errorf("Duplicate recovery code: '%s'", code)
+		}
+		seen[code] = true
+
+		normalized := auth.NormalizeRecoveryCode(" " + strings.ToUpper(code) + " ")
+		if normalized != strings.ReplaceAll(code, "-", "") {
+			t.Errorf("Expected: '%s', Got: '%s'", strings.ReplaceAll(code, "-", ""), normalized)
+		}
+	}
+}
+
+func TestEncryptSecret(t *testing.T) {
+	key, err := auth.ParseEncryptionKey(strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatalf("Error parsing key: %s", err)
+	}
+
+	encrypted, err := auth.EncryptSecret("JBSWY3DPEHPK3PXP", key)
+	if err != nil {
+		t.Fatalf("Error encrypting: %s", err)
+	}
+	if strings.Contains(encrypted, "JBSWY3DPEHPK3PXP") {
+		t.Error("Encrypted secret contains the plaintext")
+	}
+
+	decrypted, err := auth.DecryptSecret(encrypted, key)
+	if err != nil {
+		t.Fatalf("Error decrypting: %s", err)
+	}
+	if decrypted != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Expected: 'JBSWY3DPEHPK3PXP', Got: '%s'", decrypted)
+	}
+
+	otherKey, _ := auth.ParseEncryptionKey(strings.Repeat("cd", 32))
+	if _, err := auth.DecryptSecret(encrypted, otherKey); err == nil {
+		t.Error("Expected error decrypting with the wrong key")
+	}
+
+	if _, err := auth.ParseEncryptionKey("abcd"); err == nil {
+		t.Error("Expected error for short key")
+	}
+}
+
+func TestMFAChallengeJWT(t *testing.T) {
+	userID := uuid.New()
+	token, err := auth.MakeMFAChallengeJWT(userID, "secret", time.Minute)
+	if err != nil {
+		t.Fatalf("Error making challenge token: %s", err)
+	}
+
+	actual, err := auth.ValidateMFAChallengeJWT(token, "secret")
+	if err != nil {
+		t.Fatalf("Error validating challenge token: %s", err)
+	}
+	if actual != userID {
+		t.Errorf("Expected: '%v', Got: '%v'", userID, actual)
+	}
+
+	// challenge tokens must not work as access tokens
+	if _, err := auth.ValidateJWT(token, "secret"); err == nil {
+		t.Error("Challenge token was accepted as an access token")
+	}
+
+	// access tokens must not work as challenge tokens
+	accessToken, _ := auth.MakeJWT(userID, "secret", time.Minute)
+	if _, err := auth.ValidateMFAChallengeJWT(accessToken, "secret"); err == nil {
+		t.Error("Access token was accepted as a challenge token")
+	}
+}
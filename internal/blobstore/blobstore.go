@@ -0,0 +1,56 @@
+// stores uploaded files (blobs) by key, on the local filesystem or an s3-compatible service
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+type Info struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+type BlobStore interface {
+	// stores size bytes from r under the key, replacing any blob already there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// the caller must close the reader
+	// if the blob is stored on disk, the reader is also an io.Seeker
+	Get(ctx context.Context, key string) (io.ReadCloser, Info, error)
+	// deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// keys are relative, slash separated paths of letters, digits, '.', '_' and '-'
+// so they are safe as both file paths and urls
+func ValidateKey(key string) error {
+	if key == "" || len(key) > 512 || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return ErrInvalidKey
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+
+	for _, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '-', c == '/':
+		default:
+			return ErrInvalidKey
+		}
+	}
+
+	return nil
+}
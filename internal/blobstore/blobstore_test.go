@@ -0,0 +1,95 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"media/0195a1b2.jpg", true},
+		{"a", true},
+		{"media/thumbs/photo_1-2.png", true},
+		{"", false},
+		{"/media/photo.jpg", false},
+		{"media/", false},
+		{"media//photo.jpg", false},
+		{"media/../secret", false},
+		{"./photo.jpg", false},
+		{"media/photo one.jpg", false},
+		{"media\\photo.jpg", false},
+		{"media/phöto.jpg", false},
+	}
+
+	for _, test := range tests {
+		err := ValidateKey(test.key)
+		if (err == nil) != test.valid {
+			t.Errorf("Expected valid: %t for '%s', received error: %v", test.valid, test.key, err)
+		}
+	}
+}
+
+// runs the same checks against any store
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	data := []byte("GIF89a not really a gif")
+
+	_, _, err := store.Get(ctx, "media/missing.gif")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for a missing blob, received: %v", err)
+	}
+
+	err = store.Put(ctx, "media/test.gif", bytes.NewReader(data), int64(len(data)), "image/gif")
+	if err != nil {
+		t.Fatalf("Error putting blob: %s", err)
+	}
+
+	err = store.Put(ctx, "media/short.gif", bytes.NewReader(data), int64(len(data))+1, "image/gif")
+	if err == nil {
+		t.Errorf("Expected an error when the size does not match")
+	}
+
+	reader, info, err := store.Get(ctx, "media/test.gif")
+	if err != nil {
+		t.Fatalf("Error getting blob: %s", err)
+	}
+	received, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("Error reading blob: %s", err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Errorf("Expected '%s', received '%s'", data, received)
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("Expected size: %d, Got: %d", len(data), info.Size)
+	}
+	if info.ContentType != "image/gif" {
+		t.Errorf("Expected content type 'image/gif', received '%s'", info.ContentType)
+	}
+
+	err = store.Put(ctx, "../escape.gif", bytes.NewReader(data), int64(len(data)), "image/gif")
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey, received: %v", err)
+	}
+
+	err = store.Delete(ctx, "media/test.gif")
+	if err != nil {
+		t.Fatalf("Error deleting blob: %s", err)
+	}
+	_, _, err = store.Get(ctx, "media/test.gif")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after deleting, received: %v", err)
+	}
+
+	err = store.Delete(ctx, "media/test.gif")
+	if err != nil {
+		t.Errorf("Expected deleting a missing blob to succeed, received: %s", err)
+	}
+}
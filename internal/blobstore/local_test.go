@@ -0,0 +1,26 @@
+package blobstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("Error creating local store: %s", err)
+	}
+
+	testBlobStore(t, store)
+
+	// no temporary files should be left behind
+	entries, err := os.ReadDir(filepath.Join(dir, "media"))
+	if err != nil {
+		t.Fatalf("Error reading store directory: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected an empty directory, found %d entries", len(entries))
+	}
+}
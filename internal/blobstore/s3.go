@@ -0,0 +1,308 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service       = "s3"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3TimeFormat    = "20060102T150405Z"
+	s3DateFormat    = "20060102"
+	s3EmptyBodyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+type S3Config struct {
+	// the service's base url, such as https://s3.us-east-1.amazonaws.com or http://localhost:9000
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// puts the bucket in the path rather than the host name, as most self-hosted services need
+	PathStyle bool
+}
+
+// stores blobs in a bucket of an s3-compatible service
+// requests are signed with aws signature version 4
+type S3Store struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	// the current time, swapped out in tests
+	now func() time.Time
+}
+
+func NewS3Store(config S3Config, client *http.Client) (*S3Store, error) {
+	if config.Endpoint == "" || config.Region == "" || config.Bucket == "" {
+		return nil, errors.New("s3 endpoint, region and bucket are required")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("s3 access key id and secret access key are required")
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint '%s'", config.Endpoint)
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &S3Store{
+		config:   config,
+		endpoint: endpoint,
+		client:   client,
+		now:      time.Now,
+	}, nil
+}
+
+// the object's url, in either path or virtual-hosted style
+func (s *S3Store) objectURL(key string) *url.URL {
+	objectURL := *s.endpoint
+	basePath := strings.TrimSuffix(objectURL.Path, "/")
+
+	if s.config.PathStyle {
+		objectURL.Path = basePath + "/" + s.config.Bucket + "/" + key
+	} else {
+		objectURL.Host = s.config.Bucket + "." + objectURL.Host
+		objectURL.Path = basePath + "/" + key
+	}
+
+	return &objectURL
+}
+
+func (s *S3Store) newRequest(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	err := ValidateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bodyReader)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadHash := s3EmptyBodyHash
+	if body != nil {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	signS3Request(req, payloadHash, s.config, s.now())
+
+	return req, nil
+}
+
+// the body is read into memory so its hash can be signed
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	body, err := io.ReadAll(io.LimitReader(r, size+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) != size {
+		return errors.New("blob size does not match")
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	// the content type is not signed, so it can be set after signing
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, Info{}, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, Info{}, s3Error(resp)
+	}
+
+	info := Info{
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err == nil {
+		info.ModTime = modTime
+	}
+
+	return resp.Body, info, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// s3 answers 204 whether or not the object existed, some compatible services answer 404
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+
+	return nil
+}
+
+// includes the start of the error document, which names the problem
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 responded with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// adds the x-amz-date, x-amz-content-sha256 and authorization headers
+// signs the host, any range header and the x-amz-* headers
+func signS3Request(req *http.Request, payloadHash string, config S3Config, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(s3TimeFormat)
+	date := now.Format(s3DateFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3CanonicalPath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + config.Region + "/" + s3Service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+config.SecretAccessKey), date)
+	key = hmacSHA256(key, config.Region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, config.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapes everything but unreserved characters, and '/' unless escapeSlash is set
+func s3Escape(value string, escapeSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		if s3Unreserved(b) || (b == '/' && !escapeSlash) {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
+
+func s3CanonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	return s3Escape(path, false)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+func s3Unreserved(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') ||
+		b == '-' || b == '_' || b == '.' || b == '~'
+}
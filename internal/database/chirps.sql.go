@@ -7,26 +7,47 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countChirpsByUserSince = `-- name: CountChirpsByUserSince :one
+select count(*) from chirps
+where user_id = $1
+  and posted_at > $2
+`
+
+type CountChirpsByUserSinceParams struct {
+	UserID   uuid.UUID `json:"user_id"`
+	PostedAt time.Time `json:"posted_at"`
+}
+
+func (q *Queries) CountChirpsByUserSince(ctx context.Context, arg CountChirpsByUserSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUserSince, arg.UserID, arg.PostedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
 insert into chirps (
-	id, created_at, updated_at, body, user_id
+	id, created_at, updated_at, body, user_id, in_reply_to
 ) values (
-	gen_random_uuid(), now(), now(), $1, $2
+	gen_random_uuid(), now(), now(), $1, $2, $3
 )
-returning id, created_at, updated_at, body, user_id
+returning id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, posted_at
 `
 
 type CreateChirpParams struct {
-	Body   string    `json:"body"`
-	UserID uuid.UUID `json:"user_id"`
+	Body      string        `json:"body"`
+	UserID    uuid.UUID     `json:"user_id"`
+	InReplyTo uuid.NullUUID `json:"in_reply_to"`
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.InReplyTo)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -34,22 +55,18 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.PostedAt,
 	)
 	return i, err
 }
 
-const deleteChirpByID = `-- name: DeleteChirpByID :exec
-delete from chirps
-where id = $1
-`
-
-func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirpByID, id)
-	return err
-}
-
 const getAllChirps = `-- name: GetAllChirps :many
-select id, created_at, updated_at, body, user_id from chirps
+select id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, posted_at from chirps
+where user_id not in (select id from users where delete_after is not null)
+  and id not in (select chirp_id from chirp_schedules)
+  and deleted_at is null
 order by created_at asc
 `
 
@@ -68,6 +85,9 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.PostedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -83,8 +103,11 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getAllChirpsByAuthorID = `-- name: GetAllChirpsByAuthorID :many
-select id, created_at, updated_at, body, user_id from chirps
+select id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, posted_at from chirps
 where user_id = $1
+  and user_id not in (select id from users where delete_after is not null)
+  and id not in (select chirp_id from chirp_schedules)
+  and deleted_at is null
 order by created_at asc
 `
 
@@ -103,6 +126,9 @@ func (q *Queries) GetAllChirpsByAuthorID(ctx context.Context, userID uuid.UUID)
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.PostedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -118,8 +144,11 @@ func (q *Queries) GetAllChirpsByAuthorID(ctx context.Context, userID uuid.UUID)
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-select id, created_at, updated_at, body, user_id from chirps
+select id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, posted_at from chirps
 where id = $1
+  and user_id not in (select id from users where delete_after is not null)
+  and id not in (select chirp_id from chirp_schedules)
+  and deleted_at is null
 `
 
 func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -131,10 +160,222 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.PostedAt,
+	)
+	return i, err
+}
+
+const getThreadChirpByID = `-- name: GetThreadChirpByID :one
+select id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, posted_at from chirps
+where id = $1
+  and id not in (select chirp_id from chirp_schedules)
+`
+
+func (q *Queries) GetThreadChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getThreadChirpByID, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.PostedAt,
 	)
 	return i, err
 }
 
+const importChirp = `-- name: ImportChirp :exec
+insert into chirps (
+	id, created_at, updated_at, body, user_id, posted_at
+) values (
+	gen_random_uuid(), $1, $1, $2, $3, $1
+)
+`
+
+type ImportChirpParams struct {
+	CreatedAt time.Time `json:"created_at"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) ImportChirp(ctx context.Context, arg ImportChirpParams) error {
+	_, err := q.db.ExecContext(ctx, importChirp, arg.CreatedAt, arg.Body, arg.UserID)
+	return err
+}
+
+const listChirpAncestors = `-- name: ListChirpAncestors :many
+with recursive ancestors (id, in_reply_to, depth) as (
+  select chirps.id, chirps.in_reply_to, 0 from chirps
+  where chirps.id = $1
+  union all
+  select chirps.id, chirps.in_reply_to, ancestors.depth + 1 from chirps
+  join ancestors on chirps.id = ancestors.in_reply_to
+  where ancestors.depth < $2::int
+)
+select chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at, chirps.posted_at from chirps
+where chirps.id in (select ancestors.id from ancestors where ancestors.depth > 0)
+order by chirps.created_at asc
+`
+
+type ListChirpAncestorsParams struct {
+	ID       uuid.UUID `json:"id"`
+	MaxDepth int32     `json:"max_depth"`
+}
+
+func (q *Queries) ListChirpAncestors(ctx context.Context, arg ListChirpAncestorsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpAncestors, arg.ID, arg.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.PostedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpReplies = `-- name: ListChirpReplies :many
+select id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, posted_at from chirps
+where in_reply_to = $1
+  and id not in (select chirp_id from chirp_schedules)
+  and (deleted_at is null or id in (select in_reply_to from chirps where in_reply_to is not null))
+order by created_at asc
+`
+
+func (q *Queries) ListChirpReplies(ctx context.Context, inReplyTo uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpReplies, inReplyTo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.PostedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsByUserIDForExport = `-- name: ListChirpsByUserIDForExport :many
+select id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, posted_at from chirps
+where user_id = $1
+  and id not in (select chirp_id from chirp_schedules)
+order by created_at asc
+`
+
+func (q *Queries) ListChirpsByUserIDForExport(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByUserIDForExport, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.PostedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const publishChirp = `-- name: PublishChirp :one
+update chirps
+set
+  created_at = now(),
+  updated_at = now()
+where id = $1
+returning id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, posted_at
+`
+
+func (q *Queries) PublishChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, publishChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.PostedAt,
+	)
+	return i, err
+}
+
+const purgeDeletedChirpsBefore = `-- name: PurgeDeletedChirpsBefore :execrows
+delete from chirps
+where deleted_at < $1
+`
+
+func (q *Queries) PurgeDeletedChirpsBefore(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirpsBefore, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const resetChirps = `-- name: ResetChirps :exec
 delete from chirps
 `
@@ -143,3 +384,73 @@ func (q *Queries) ResetChirps(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, resetChirps)
 	return err
 }
+
+const restoreChirpByID = `-- name: RestoreChirpByID :one
+update chirps
+set deleted_at = null
+where id = $1
+  and deleted_at is not null
+returning id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, posted_at
+`
+
+func (q *Queries) RestoreChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirpByID, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.PostedAt,
+	)
+	return i, err
+}
+
+const softDeleteChirpByID = `-- name: SoftDeleteChirpByID :execrows
+update chirps
+set deleted_at = now()
+where id = $1
+  and deleted_at is null
+`
+
+func (q *Queries) SoftDeleteChirpByID(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteChirpByID, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+update chirps
+set
+  updated_at = now(),
+  body = $2
+where id = $1
+  and deleted_at is null
+returning id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, posted_at
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID `json:"id"`
+	Body string    `json:"body"`
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.PostedAt,
+	)
+	return i, err
+}
@@ -6,33 +6,286 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type Attachment struct {
+	ID          uuid.UUID     `json:"id"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UserID      uuid.UUID     `json:"user_id"`
+	ChirpID     uuid.NullUUID `json:"chirp_id"`
+	StorageKey  string        `json:"storage_key"`
+	ContentType string        `json:"content_type"`
+	SizeBytes   int64         `json:"size_bytes"`
+	Width       int32         `json:"width"`
+	Height      int32         `json:"height"`
+}
+
+type AttachmentVariant struct {
+	AttachmentID uuid.UUID `json:"attachment_id"`
+	Size         int32     `json:"size"`
+	CreatedAt    time.Time `json:"created_at"`
+	StorageKey   string    `json:"storage_key"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int64     `json:"size_bytes"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+}
+
 type Chirp struct {
+	ID        uuid.UUID     `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Body      string        `json:"body"`
+	UserID    uuid.UUID     `json:"user_id"`
+	InReplyTo uuid.NullUUID `json:"in_reply_to"`
+	DeletedAt sql.NullTime  `json:"deleted_at"`
+	PostedAt  time.Time     `json:"posted_at"`
+}
+
+type ChirpPin struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Position  int32     `json:"position"`
+}
+
+type ChirpSchedule struct {
+	ChirpID   uuid.UUID      `json:"chirp_id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	PublishAt time.Time      `json:"publish_at"`
+	TimeZone  sql.NullString `json:"time_zone"`
+}
+
+type ChirpLink struct {
+	ChirpID  uuid.UUID `json:"chirp_id"`
+	Position int32     `json:"position"`
+	Url      string    `json:"url"`
+}
+
+type DataExport struct {
+	ID          uuid.UUID      `json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UserID      uuid.UUID      `json:"user_id"`
+	Status      string         `json:"status"`
+	Archive     []byte         `json:"archive"`
+	Error       sql.NullString `json:"error"`
+	CompletedAt sql.NullTime   `json:"completed_at"`
+	ExpiresAt   sql.NullTime   `json:"expires_at"`
+}
+
+type Draft struct {
+	ID        uuid.UUID     `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	UserID    uuid.UUID     `json:"user_id"`
+	Body      string        `json:"body"`
+	InReplyTo uuid.NullUUID `json:"in_reply_to"`
+}
+
+type EmailToken struct {
+	ID        uuid.UUID    `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UserID    uuid.UUID    `json:"user_id"`
+	Purpose   string       `json:"purpose"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+}
+
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	MaxAttempts int32           `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedUntil sql.NullTime    `json:"locked_until"`
+	LastError   sql.NullString  `json:"last_error"`
+	FinishedAt  sql.NullTime    `json:"finished_at"`
+}
+
+type LinkPreview struct {
+	Url         string         `json:"url"`
+	FetchedAt   time.Time      `json:"fetched_at"`
+	Status      string         `json:"status"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	ImageUrl    string         `json:"image_url"`
+	SiteName    string         `json:"site_name"`
+	Error       sql.NullString `json:"error"`
+}
+
+type LoginEvent struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
 	UserID    uuid.UUID `json:"user_id"`
+	Method    string    `json:"method"`
+	IpAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash            string       `json:"code_hash"`
+	CreatedAt           time.Time    `json:"created_at"`
+	ClientID            uuid.UUID    `json:"client_id"`
+	UserID              uuid.UUID    `json:"user_id"`
+	RedirectUri         string       `json:"redirect_uri"`
+	Scope               string       `json:"scope"`
+	CodeChallenge       string       `json:"code_challenge"`
+	CodeChallengeMethod string       `json:"code_challenge_method"`
+	ExpiresAt           time.Time    `json:"expires_at"`
+	UsedAt              sql.NullTime `json:"used_at"`
+}
+
+type OauthClient struct {
+	ID           uuid.UUID      `json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	UserID       uuid.UUID      `json:"user_id"`
+	Name         string         `json:"name"`
+	HashedSecret sql.NullString `json:"hashed_secret"`
+	RedirectUris []string       `json:"redirect_uris"`
+	Scope        string         `json:"scope"`
+}
+
+type OauthConsent struct {
+	UserID    uuid.UUID `json:"user_id"`
+	ClientID  uuid.UUID `json:"client_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Scope     string    `json:"scope"`
+}
+
+type PlanEntitlement struct {
+	Plan                string    `json:"plan"`
+	UpdatedAt           time.Time `json:"updated_at"`
+	MaxChirpLength      int32     `json:"max_chirp_length"`
+	MaxMediaPerChirp    int32     `json:"max_media_per_chirp"`
+	ChirpsPerHour       int32     `json:"chirps_per_hour"`
+	MediaUploadsPerHour int32     `json:"media_uploads_per_hour"`
+	CanEditChirps       bool      `json:"can_edit_chirps"`
+	CanScheduleChirps   bool      `json:"can_schedule_chirps"`
+	MaxPinnedChirps     int32     `json:"max_pinned_chirps"`
+}
+
+type Profile struct {
+	UserID      uuid.UUID      `json:"user_id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Handle      sql.NullString `json:"handle"`
+	DisplayName string         `json:"display_name"`
+	Bio         string         `json:"bio"`
+	AvatarUrl   string         `json:"avatar_url"`
+	Location    string         `json:"location"`
+	Website     string         `json:"website"`
 }
 
 type RefreshToken struct {
-	ID        string       `json:"id"`
+	ID        string        `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	UserID    uuid.UUID     `json:"user_id"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	RevokedAt sql.NullTime  `json:"revoked_at"`
+	ClientID  uuid.NullUUID `json:"client_id"`
+	Scope     string        `json:"scope"`
+}
+
+type Subscription struct {
+	UserID             uuid.UUID `json:"user_id"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	Plan               string    `json:"plan"`
+	Status             string    `json:"status"`
+	CurrentPeriodStart time.Time `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time `json:"current_period_end"`
+}
+
+type TotpRecoveryCode struct {
+	ID        uuid.UUID    `json:"id"`
 	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at"`
 	UserID    uuid.UUID    `json:"user_id"`
-	ExpiresAt time.Time    `json:"expires_at"`
-	RevokedAt sql.NullTime `json:"revoked_at"`
+	CodeHash  string       `json:"code_hash"`
+	UsedAt    sql.NullTime `json:"used_at"`
+}
+
+type TotpSecret struct {
+	UserID          uuid.UUID    `json:"user_id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	EncryptedSecret string       `json:"encrypted_secret"`
+	ConfirmedAt     sql.NullTime `json:"confirmed_at"`
+	LastUsedStep    int64        `json:"last_used_step"`
 }
 
 type User struct {
-	ID             uuid.UUID `json:"id"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	Email          string    `json:"email"`
-	HashedPassword string    `json:"hashed_password"`
-	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	ID             uuid.UUID    `json:"id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	Email          string       `json:"email"`
+	HashedPassword string       `json:"hashed_password"`
+	IsChirpyRed    bool         `json:"is_chirpy_red"`
+	EmailVerified  bool         `json:"email_verified"`
+	DeleteAfter    sql.NullTime `json:"delete_after"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	DeliveredAt    sql.NullTime    `json:"delivered_at"`
+	LastError      sql.NullString  `json:"last_error"`
+	LockedUntil    sql.NullTime    `json:"locked_until"`
+}
+
+type WebhookDeliveryAttempt struct {
+	ID          uuid.UUID      `json:"id"`
+	DeliveryID  uuid.UUID      `json:"delivery_id"`
+	AttemptedAt time.Time      `json:"attempted_at"`
+	StatusCode  sql.NullInt32  `json:"status_code"`
+	Error       sql.NullString `json:"error"`
+	DurationMs  int32          `json:"duration_ms"`
+}
+
+type WebhookEvent struct {
+	Provider    string          `json:"provider"`
+	ID          string          `json:"id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Error       sql.NullString  `json:"error"`
+	Attempts    int32           `json:"attempts"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt sql.NullTime    `json:"processed_at"`
+}
+
+type WebhookNonce struct {
+	Provider   string    `json:"provider"`
+	Nonce      string    `json:"nonce"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+type WebhookSubscription struct {
+	ID        uuid.UUID     `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	UserID    uuid.UUID     `json:"user_id"`
+	ClientID  uuid.NullUUID `json:"client_id"`
+	Url       string        `json:"url"`
+	Secret    string        `json:"secret"`
+	Events    []string      `json:"events"`
 }
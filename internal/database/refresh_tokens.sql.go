@@ -7,18 +7,58 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const createOAuthRefreshToken = `-- name: CreateOAuthRefreshToken :one
+insert into refresh_tokens (
+  id, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scope
+) values (
+  $1, now(), now(), $2, $3, NULL, $4, $5
+)
+returning id, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scope
+`
+
+type CreateOAuthRefreshTokenParams struct {
+	ID        string        `json:"id"`
+	UserID    uuid.UUID     `json:"user_id"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	ClientID  uuid.NullUUID `json:"client_id"`
+	Scope     string        `json:"scope"`
+}
+
+func (q *Queries) CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthRefreshToken,
+		arg.ID,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.ClientID,
+		arg.Scope,
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		&i.Scope,
+	)
+	return i, err
+}
+
 const createRefreshToken = `-- name: CreateRefreshToken :one
 insert into refresh_tokens (
   id, created_at, updated_at, user_id, expires_at, revoked_at
 ) values (
   $1, now(), now(), $2, $3, NULL
 )
-returning id, created_at, updated_at, user_id, expires_at, revoked_at
+returning id, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scope
 `
 
 type CreateRefreshTokenParams struct {
@@ -37,12 +77,14 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ClientID,
+		&i.Scope,
 	)
 	return i, err
 }
 
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-select id, created_at, updated_at, user_id, expires_at, revoked_at from refresh_tokens
+select id, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scope from refresh_tokens
 where id = $1
 `
 
@@ -56,10 +98,69 @@ func (q *Queries) GetUserFromRefreshToken(ctx context.Context, id string) (Refre
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ClientID,
+		&i.Scope,
 	)
 	return i, err
 }
 
+const listRefreshTokensByUserID = `-- name: ListRefreshTokensByUserID :many
+select created_at, expires_at, revoked_at, client_id, scope from refresh_tokens
+where user_id = $1
+order by created_at asc
+`
+
+type ListRefreshTokensByUserIDRow struct {
+	CreatedAt time.Time     `json:"created_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	RevokedAt sql.NullTime  `json:"revoked_at"`
+	ClientID  uuid.NullUUID `json:"client_id"`
+	Scope     string        `json:"scope"`
+}
+
+func (q *Queries) ListRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]ListRefreshTokensByUserIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, listRefreshTokensByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRefreshTokensByUserIDRow
+	for rows.Next() {
+		var i ListRefreshTokensByUserIDRow
+		if err := rows.Scan(
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.ClientID,
+			&i.Scope,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllRefreshTokensByUserID = `-- name: RevokeAllRefreshTokensByUserID :exec
+update refresh_tokens
+set
+  updated_at = now(),
+  revoked_at = now()
+where user_id = $1
+  and revoked_at is null
+`
+
+func (q *Queries) RevokeAllRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensByUserID, userID)
+	return err
+}
+
 const revokeRefreshTokenWithToken = `-- name: RevokeRefreshTokenWithToken :exec
 update refresh_tokens
 set
@@ -72,3 +173,20 @@ func (q *Queries) RevokeRefreshTokenWithToken(ctx context.Context, id string) er
 	_, err := q.db.ExecContext(ctx, revokeRefreshTokenWithToken, id)
 	return err
 }
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :execrows
+update refresh_tokens
+set
+  updated_at = now(),
+  revoked_at = now()
+where id = $1
+  and revoked_at is null
+`
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rotateRefreshToken, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -7,18 +7,37 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+update users
+set
+  updated_at = now(),
+  delete_after = null
+where id = $1
+  and delete_after is not null
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
 insert into users (
 	id, created_at, updated_at, email, hashed_password, is_chirpy_red
 ) values (
 	gen_random_uuid(), NOW(), NOW(), $1, $2, false
 )
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, delete_after
 `
 
 type CreateUserParams struct {
@@ -36,12 +55,41 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
+const deleteUsersDueForDeletion = `-- name: DeleteUsersDueForDeletion :execrows
+delete from users
+where delete_after is not null
+  and delete_after <= now()
+`
+
+func (q *Queries) DeleteUsersDueForDeletion(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUsersDueForDeletion)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const downgradeUsersByIDs = `-- name: DowngradeUsersByIDs :exec
+update users
+set
+  updated_at = now(),
+  is_chirpy_red = false
+where id = any($1::uuid[])
+`
+
+func (q *Queries) DowngradeUsersByIDs(ctx context.Context, ids []uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, downgradeUsersByIDs, pq.Array(ids))
+	return err
+}
+
 const getUserByEmailRetHashedPassword = `-- name: GetUserByEmailRetHashedPassword :one
-select id, created_at, updated_at, email, hashed_password, is_chirpy_red from users
+select id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, delete_after from users
 where email = $1
 `
 
@@ -55,21 +103,24 @@ func (q *Queries) GetUserByEmailRetHashedPassword(ctx context.Context, email str
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
 const getUserByEmailSafe = `-- name: GetUserByEmailSafe :one
-select id, created_at, updated_at, email, is_chirpy_red from users
+select id, created_at, updated_at, email, is_chirpy_red, email_verified from users
 where email = $1
 `
 
 type GetUserByEmailSafeRow struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
 }
 
 func (q *Queries) GetUserByEmailSafe(ctx context.Context, email string) (GetUserByEmailSafeRow, error) {
@@ -81,21 +132,44 @@ func (q *Queries) GetUserByEmailSafe(ctx context.Context, email string) (GetUser
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.EmailVerified,
+	)
+	return i, err
+}
+
+const getUserByIDRetHashedPassword = `-- name: GetUserByIDRetHashedPassword :one
+select id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified, delete_after from users
+where id = $1
+`
+
+func (q *Queries) GetUserByIDRetHashedPassword(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByIDRetHashedPassword, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerified,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
 const getUserByIDSafe = `-- name: GetUserByIDSafe :one
-select id, created_at, updated_at, email, is_chirpy_red from users
+select id, created_at, updated_at, email, is_chirpy_red, email_verified from users
 where id = $1
 `
 
 type GetUserByIDSafeRow struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
 }
 
 func (q *Queries) GetUserByIDSafe(ctx context.Context, id uuid.UUID) (GetUserByIDSafeRow, error) {
@@ -107,10 +181,83 @@ func (q *Queries) GetUserByIDSafe(ctx context.Context, id uuid.UUID) (GetUserByI
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.EmailVerified,
 	)
 	return i, err
 }
 
+const isUserPendingDeletion = `-- name: IsUserPendingDeletion :one
+select (delete_after is not null)::boolean as pending_deletion
+from users
+where id = $1
+`
+
+func (q *Queries) IsUserPendingDeletion(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isUserPendingDeletion, id)
+	var pending_deletion bool
+	err := row.Scan(&pending_deletion)
+	return pending_deletion, err
+}
+
+const listUserIDsPendingDeletion = `-- name: ListUserIDsPendingDeletion :many
+select id from users
+where id = any($1::uuid[])
+  and delete_after is not null
+`
+
+func (q *Queries) ListUserIDsPendingDeletion(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listUserIDsPendingDeletion, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUserByID = `-- name: LockUserByID :one
+select id from users
+where id = $1
+for update
+`
+
+func (q *Queries) LockUserByID(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, lockUserByID, id)
+	err := row.Scan(&id)
+	return id, err
+}
+
+const markUserEmailVerified = `-- name: MarkUserEmailVerified :exec
+update users
+set
+  updated_at = now(),
+  email_verified = true
+where id = $1 and email = $2
+`
+
+type MarkUserEmailVerifiedParams struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+func (q *Queries) MarkUserEmailVerified(ctx context.Context, arg MarkUserEmailVerifiedParams) error {
+	_, err := q.db.ExecContext(ctx, markUserEmailVerified, arg.ID, arg.Email)
+	return err
+}
+
 const resetUsers = `-- name: ResetUsers :exec
 delete from users
 `
@@ -120,43 +267,80 @@ func (q *Queries) ResetUsers(ctx context.Context) error {
 	return err
 }
 
-const updateUser = `-- name: UpdateUser :one
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :exec
+update users
+set
+  updated_at = now(),
+  delete_after = $2
+where id = $1
+`
+
+type ScheduleUserDeletionParams struct {
+	ID          uuid.UUID    `json:"id"`
+	DeleteAfter sql.NullTime `json:"delete_after"`
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleUserDeletion, arg.ID, arg.DeleteAfter)
+	return err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
 update users
 set
   updated_at = now(),
   email = $2,
-  hashed_password = $3
+  email_verified = false
 where id = $1
-returning id, created_at, updated_at, email, is_chirpy_red
+returning id, created_at, updated_at, email, is_chirpy_red, email_verified
 `
 
-type UpdateUserParams struct {
-	ID             uuid.UUID `json:"id"`
-	Email          string    `json:"email"`
-	HashedPassword string    `json:"hashed_password"`
+type UpdateUserEmailParams struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
 }
 
-type UpdateUserRow struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+type UpdateUserEmailRow struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword)
-	var i UpdateUserRow
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (UpdateUserEmailRow, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmail, arg.ID, arg.Email)
+	var i UpdateUserEmailRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.EmailVerified,
 	)
 	return i, err
 }
 
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+update users
+set
+  updated_at = now(),
+  hashed_password = $2
+where id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID `json:"id"`
+	HashedPassword string    `json:"hashed_password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
 const upgradeUserByID = `-- name: UpgradeUserByID :exec
 update users
 set
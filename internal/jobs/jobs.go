@@ -0,0 +1,403 @@
+// runs background work stored in postgres, so it survives restarts and is shared between instances
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+
+	DefaultMaxAttempts = 5
+
+	// recording how a job went must not be cut short by the runner shutting down
+	finishTimeout = 10 * time.Second
+)
+
+// wrapped by errors a retry can not fix, the job fails without using its remaining attempts
+var ErrPermanent = errors.New("permanent failure")
+
+// the arguments of a job, stored as json
+// the kind picks the handler, and must not change once jobs of it have been enqueued
+type Args interface {
+	Kind() string
+}
+
+type Options struct {
+	// when the job may first run, now when zero
+	RunAt time.Time
+	// DefaultMaxAttempts when zero
+	MaxAttempts int32
+}
+
+type Config struct {
+	// jobs run at the same time
+	Workers int
+	// how often the runner looks for due jobs
+	PollInterval time.Duration
+	// how long a job may run, once it has passed another runner may claim it again
+	VisibilityTimeout time.Duration
+	// delay before the first retry, doubling with each attempt up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// claims due jobs and runs them with the handler registered for their kind
+type Runner struct {
+	db       *database.Queries
+	config   Config
+	handlers map[string]func(ctx context.Context, payload json.RawMessage) error
+	// kinds that run again every interval, rather than once
+	periodic map[string]time.Duration
+
+	mu   sync.Mutex
+	busy int
+	// stops claiming jobs
+	stopPolling context.CancelFunc
+	polling     chan struct{}
+	// cancels the jobs still running once shutdown has waited long enough
+	cancelJobs context.CancelFunc
+	running    sync.WaitGroup
+}
+
+// stores a job to run once it is due
+// pass the transaction's queries to enqueue it only if the rest of the transaction commits
+func Enqueue(ctx context.Context, q *database.Queries, args Args, opts Options) (database.Job, error) {
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return database.Job{}, err
+	}
+
+	runAt, maxAttempts := opts.withDefaults()
+	return q.EnqueueJob(ctx, database.EnqueueJobParams{
+		Kind:        args.Kind(),
+		Payload:     payload,
+		MaxAttempts: maxAttempts,
+		RunAt:       runAt,
+	})
+}
+
+// like Enqueue, but does nothing while a job of the same kind and key is pending or running
+// reports whether the job was enqueued
+func EnqueueUnique(ctx context.Context, q *database.Queries, args Args, key string, opts Options) (bool, error) {
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return false, err
+	}
+
+	runAt, maxAttempts := opts.withDefaults()
+	enqueued, err := q.EnqueueUniqueJob(ctx, database.EnqueueUniqueJobParams{
+		ID:          uniqueJobID(args.Kind(), key),
+		Kind:        args.Kind(),
+		Payload:     payload,
+		MaxAttempts: maxAttempts,
+		RunAt:       runAt,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return enqueued > 0, nil
+}
+
+// when the job may first run and how many attempts it gets, filling in the defaults
+func (o Options) withDefaults() (time.Time, int32) {
+	runAt := o.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	maxAttempts := o.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	return runAt.UTC(), maxAttempts
+}
+
+func NewRunner(db *database.Queries, config Config) *Runner {
+	return &Runner{
+		db:       db,
+		config:   config,
+		handlers: make(map[string]func(ctx context.Context, payload json.RawMessage) error),
+		periodic: make(map[string]time.Duration),
+	}
+}
+
+// sets the handler for jobs of the args' kind, must be called before the runner is started
+// a payload that does not decode fails the job without retrying
+func Register[T Args](r *Runner, work func(ctx context.Context, args T) error) {
+	var zero T
+	r.handlers[zero.Kind()] = func(ctx context.Context, payload json.RawMessage) error {
+		var args T
+		err := json.Unmarshal(payload, &args)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrPermanent, err)
+		}
+		return work(ctx, args)
+	}
+}
+
+// sets the handler for a job that runs every interval, shared by every runner
+// there is a single job of the kind, enqueued when a runner starts, and due again an interval after each run
+// a run that fails is not retried, it waits for the next one
+func RegisterPeriodic[T Args](r *Runner, interval time.Duration, work func(ctx context.Context, args T) error) {
+	Register(r, work)
+
+	var zero T
+	r.periodic[zero.Kind()] = interval
+}
+
+// the same for every runner, so they all share one job of each periodic kind
+func periodicJobID(kind string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("chirpy:jobs:periodic:"+kind))
+}
+
+// the same for every enqueue of the kind and key, so only one such job exists at a time
+func uniqueJobID(kind, key string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("chirpy:jobs:unique:"+kind+":"+key))
+}
+
+// the delay before the job is tried again, after the given number of attempts
+func (c Config) Backoff(attempts int32) time.Duration {
+	delay := c.BaseBackoff
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= c.MaxBackoff {
+			return c.MaxBackoff
+		}
+	}
+
+	return min(delay, c.MaxBackoff)
+}
+
+// the kinds with a handler, only these are claimed
+func (r *Runner) kinds() []string {
+	kinds := make([]string, 0, len(r.handlers))
+	for kind := range r.handlers {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+
+	return kinds
+}
+
+// polls for due jobs in the background until the context is done or the runner is shut down
+// periodic jobs that do not exist yet are enqueued to run straight away
+func (r *Runner) Start(ctx context.Context) {
+	for kind := range r.periodic {
+		err := r.db.EnqueuePeriodicJob(ctx, database.EnqueuePeriodicJobParams{
+			ID:          periodicJobID(kind),
+			Kind:        kind,
+			MaxAttempts: DefaultMaxAttempts,
+			RunAt:       time.Now().UTC(),
+		})
+		if err != nil {
+			log.Printf("Unable to enqueue periodic %s job: %s", kind, err)
+		}
+	}
+
+	pollCtx, stopPolling := context.WithCancel(ctx)
+	// running jobs are only cancelled by shutdown, so they can finish while it waits
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+
+	r.stopPolling = stopPolling
+	r.cancelJobs = cancelJobs
+	r.polling = make(chan struct{})
+
+	go func() {
+		defer close(r.polling)
+
+		ticker := time.NewTicker(r.config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			r.claim(pollCtx, jobCtx)
+
+			select {
+			case <-pollCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stops claiming jobs and waits for those running to finish
+// when the context is done first they are cancelled, and retried once their visibility timeout has passed
+func (r *Runner) Shutdown(ctx context.Context) error {
+	if r.stopPolling == nil {
+		return nil
+	}
+	r.stopPolling()
+	<-r.polling
+
+	finished := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		r.cancelJobs()
+		return nil
+	case <-ctx.Done():
+		r.cancelJobs()
+		return ctx.Err()
+	}
+}
+
+// claims as many due jobs as there are idle workers, and starts them
+func (r *Runner) claim(pollCtx, jobCtx context.Context) {
+	r.mu.Lock()
+	idle := r.config.Workers - r.busy
+	r.mu.Unlock()
+	if idle <= 0 || len(r.handlers) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	claimed, err := r.db.ClaimJobs(pollCtx, database.ClaimJobsParams{
+		LockedUntil: sql.NullTime{Time: now.Add(r.config.VisibilityTimeout), Valid: true},
+		Kinds:       r.kinds(),
+		Now:         now,
+		MaxJobs:     int32(idle),
+	})
+	if err != nil {
+		if pollCtx.Err() == nil {
+			log.Printf("Unable to claim jobs: %s", err)
+		}
+		return
+	}
+
+	for _, job := range claimed {
+		r.mu.Lock()
+		r.busy++
+		r.mu.Unlock()
+		r.running.Add(1)
+
+		go func() {
+			defer func() {
+				r.mu.Lock()
+				r.busy--
+				r.mu.Unlock()
+				r.running.Done()
+			}()
+
+			r.run(jobCtx, job)
+		}()
+	}
+}
+
+// runs a claimed job and records how it went
+func (r *Runner) run(jobCtx context.Context, job database.Job) {
+	var err error
+	if job.Attempts > job.MaxAttempts {
+		// claimed again after its worker stopped without finishing it
+		err = fmt.Errorf("%w: abandoned after %d attempts", ErrPermanent, job.MaxAttempts)
+	} else {
+		ctx, cancel := context.WithTimeout(jobCtx, r.config.VisibilityTimeout)
+		err = r.work(ctx, job)
+		cancel()
+	}
+
+	r.finish(job, err, time.Now().UTC())
+}
+
+// calls the job's handler, turning a panic into an error
+func (r *Runner) work(ctx context.Context, job database.Job) (err error) {
+	handler, ok := r.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("%w: no handler for kind '%s'", ErrPermanent, job.Kind)
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+
+	return handler(ctx, job.Payload)
+}
+
+// marks the job done, failed, or due again after its backoff
+// periodic jobs are always due again after their interval
+// nothing is changed when another runner has claimed the job since, after its visibility timeout passed
+func (r *Runner) finish(job database.Job, jobErr error, now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeout)
+	defer cancel()
+
+	var updated int64
+	var err error
+	interval, periodic := r.periodic[job.Kind]
+	switch {
+	case periodic:
+		runAt := now.Add(interval)
+		lastError := sql.NullString{}
+		if jobErr != nil {
+			lastError = sql.NullString{String: jobErr.Error(), Valid: true}
+		}
+		updated, err = r.db.RescheduleJob(ctx, database.RescheduleJobParams{
+			ID:        job.ID,
+			Attempts:  job.Attempts,
+			RunAt:     runAt,
+			LastError: lastError,
+		})
+		if err == nil && updated > 0 && jobErr != nil {
+			log.Printf("Periodic %s job failed, running again at %s: %s", job.Kind, runAt.Format(time.RFC3339), jobErr)
+		}
+
+	case jobErr == nil:
+		updated, err = r.db.CompleteJob(ctx, database.CompleteJobParams{
+			ID:       job.ID,
+			Attempts: job.Attempts,
+		})
+		if err == nil && updated > 0 {
+			log.Printf("Finished %s job '%s'.", job.Kind, job.ID)
+		}
+
+	case errors.Is(jobErr, ErrPermanent) || job.Attempts >= job.MaxAttempts:
+		updated, err = r.db.FailJob(ctx, database.FailJobParams{
+			ID:        job.ID,
+			Attempts:  job.Attempts,
+			LastError: sql.NullString{String: jobErr.Error(), Valid: true},
+		})
+		if err == nil && updated > 0 {
+			log.Printf("Failed %s job '%s' after %d attempts: %s", job.Kind, job.ID, job.Attempts, jobErr)
+		}
+
+	default:
+		runAt := now.Add(r.config.Backoff(job.Attempts))
+		updated, err = r.db.RetryJob(ctx, database.RetryJobParams{
+			ID:        job.ID,
+			Attempts:  job.Attempts,
+			RunAt:     runAt,
+			LastError: sql.NullString{String: jobErr.Error(), Valid: true},
+		})
+		if err == nil && updated > 0 {
+			log.Printf("Attempt %d of %s job '%s' failed, retrying at %s: %s", job.Attempts, job.Kind, job.ID, runAt.Format(time.RFC3339), jobErr)
+		}
+	}
+
+	if err != nil {
+		log.Printf("Unable to record the result of %s job '%s': %s", job.Kind, job.ID, err)
+		return
+	}
+	if updated == 0 {
+		log.Printf("The %s job '%s' ran past its visibility timeout and was claimed again.", job.Kind, job.ID)
+	}
+}
@@ -0,0 +1,149 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+type greetArgs struct {
+	Name string `json:"name"`
+}
+
+func (greetArgs) Kind() string { return "greet" }
+
+type panicArgs struct{}
+
+func (panicArgs) Kind() string { return "panic" }
+
+func TestBackoff(t *testing.T) {
+	config := Config{BaseBackoff: time.Minute, MaxBackoff: time.Hour}
+
+	var tests = []struct {
+		attempts int32
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{50, time.Hour},
+	}
+
+	for _, test := range tests {
+		received := config.Backoff(test.attempts)
+		if received != test.expected {
+			t.Errorf("Attempts %d, Expected: %s, Got: %s", test.attempts, test.expected, received)
+		}
+	}
+}
+
+func TestRegisterDecodesArgs(t *testing.T) {
+	runner := NewRunner(nil, Config{})
+
+	var received greetArgs
+	Register(runner, func(ctx context.Context, args greetArgs) error {
+		received = args
+		return nil
+	})
+	Register(runner, func(ctx context.Context, args panicArgs) error {
+		panic("boom")
+	})
+
+	if !slices.Equal(runner.kinds(), []string{"greet", "panic"}) {
+		t.Errorf("Expected '%v', received '%v'", []string{"greet", "panic"}, runner.kinds())
+	}
+
+	payload, err := json.Marshal(greetArgs{Name: "chirpy"})
+	if err != nil {
+		t.Fatalf("unable to marshal args: %s", err)
+	}
+
+	var tests = []struct {
+		name            string
+		job             database.Job
+		expectErr       bool
+		expectPermanent bool
+	}{
+		{"decoded", database.Job{Kind: "greet", Payload: payload}, false, false},
+		{"invalid payload", database.Job{Kind: "greet", Payload: json.RawMessage(`[1]`)}, true, true},
+		{"unknown kind", database.Job{Kind: "wave", Payload: payload}, true, true},
+		// a panic is retried like any other error
+		{"panic", database.Job{Kind: "panic", Payload: json.RawMessage(`{}`)}, true, false},
+	}
+
+	for _, test := range tests {
+		err := runner.work(context.Background(), test.job)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: Expected error: %t, received: %v", test.name, test.expectErr, err)
+			continue
+		}
+		if errors.Is(err, ErrPermanent) != test.expectPermanent {
+			t.Errorf("%s: Expected permanent: %t, received: %v", test.name, test.expectPermanent, err)
+		}
+	}
+
+	if received.Name != "chirpy" {
+		t.Errorf("Expected '%s', received '%s'", "chirpy", received.Name)
+	}
+}
+
+func TestRegisterPeriodic(t *testing.T) {
+	runner := NewRunner(nil, Config{})
+	RegisterPeriodic(runner, time.Hour, func(ctx context.Context, args panicArgs) error {
+		return nil
+	})
+	Register(runner, func(ctx context.Context, args greetArgs) error {
+		return nil
+	})
+
+	if !slices.Equal(runner.kinds(), []string{"greet", "panic"}) {
+		t.Errorf("Expected '%v', received '%v'", []string{"greet", "panic"}, runner.kinds())
+	}
+	if runner.periodic["panic"] != time.Hour {
+		t.Errorf("Expected: %s, Got: %s", time.Hour, runner.periodic["panic"])
+	}
+	if _, ok := runner.periodic["greet"]; ok {
+		t.Errorf("Expected '%s' not to be periodic", "greet")
+	}
+
+	// every runner must agree on the job, and kinds must not share one
+	if periodicJobID("panic") != periodicJobID("panic") {
+		t.Errorf("Expected the same id for the same kind")
+	}
+	if periodicJobID("panic") == periodicJobID("greet") {
+		t.Errorf("Expected different ids for different kinds")
+	}
+}
+
+func TestUniqueJobID(t *testing.T) {
+	var tests = []struct {
+		kindA, keyA string
+		kindB, keyB string
+		expectSame  bool
+	}{
+		{"greet", "a", "greet", "a", true},
+		{"greet", "a", "greet", "b", false},
+		{"greet", "a", "panic", "a", false},
+	}
+
+	for _, test := range tests {
+		same := uniqueJobID(test.kindA, test.keyA) == uniqueJobID(test.kindB, test.keyB)
+		if same != test.expectSame {
+			t.Errorf("Kinds '%s' and '%s', keys '%s' and '%s', expected same: %t, Got: %t", test.kindA, test.kindB, test.keyA, test.keyB, test.expectSame, same)
+		}
+	}
+}
+
+func TestShutdownWithoutStart(t *testing.T) {
+	err := NewRunner(nil, Config{}).Shutdown(context.Background())
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
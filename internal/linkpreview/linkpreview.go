@@ -0,0 +1,347 @@
+// finds links in text and fetches open graph and twitter card previews of them
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	userAgent    = "ChirpyLinkPreview/1.0"
+	maxRedirects = 5
+
+	// longest values kept, in characters
+	maxTitle       = 200
+	maxDescription = 500
+	maxSiteName    = 100
+	MaxURLLength   = 2000
+)
+
+var (
+	ErrBlockedAddress = errors.New("address is not public")
+	ErrNotHTML        = errors.New("page is not html")
+	ErrNoMetadata     = errors.New("page has no title or description")
+)
+
+// a url starting with http:// or https://, up to the next space or quote
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'` + "`" + `]+`)
+
+// ranges not covered by netip's own checks that must never be fetched
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+type Preview struct {
+	// the page's canonical url, or where the fetch ended up after redirects
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+}
+
+// fetches previews, refusing to connect to anything but public addresses
+// the address is checked after dns resolution and on every redirect,
+// so a public name pointing at a private address is caught too
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+	// reports if an address may be connected to, swapped out in tests
+	allowAddr func(netip.Addr) bool
+}
+
+// reports if the address is on the public internet
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return addr != netip.MustParseAddr("255.255.255.255")
+}
+
+// returns the distinct http(s) urls in the text, in order, up to the limit
+// punctuation ending a sentence is not part of the url
+func ExtractURLs(text string, limit int) []string {
+	urls := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, span := range FindURLs(text) {
+		if len(urls) >= limit {
+			break
+		}
+
+		match := text[span[0]:span[1]]
+		parsed, err := url.Parse(match)
+		if err != nil || parsed.Hostname() == "" || parsed.User != nil || len(match) > MaxURLLength {
+			continue
+		}
+		parsed.Scheme = strings.ToLower(parsed.Scheme)
+		parsed.Host = strings.ToLower(parsed.Host)
+		parsed.Fragment = ""
+
+		normalized := parsed.String()
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		urls = append(urls, normalized)
+	}
+
+	return urls
+}
+
+// returns where each url in the text starts and ends, in order, as byte offsets
+// punctuation ending a sentence is not part of the url
+func FindURLs(text string) [][2]int {
+	spans := make([][2]int, 0)
+	for _, match := range urlPattern.FindAllStringIndex(text, -1) {
+		trimmed := trimURL(text[match[0]:match[1]])
+		spans = append(spans, [2]int{match[0], match[0] + len(trimmed)})
+	}
+
+	return spans
+}
+
+// drops trailing punctuation, and closing brackets with no opening bracket in the url
+func trimURL(match string) string {
+	for len(match) > 0 {
+		last := match[len(match)-1]
+		switch {
+		case strings.IndexByte(".,;:!?*", last) >= 0:
+			match = match[:len(match)-1]
+		case last == ')' && strings.Count(match, "(") < strings.Count(match, ")"):
+			match = match[:len(match)-1]
+		case last == ']' && strings.Count(match, "[") < strings.Count(match, "]"):
+			match = match[:len(match)-1]
+		default:
+			return match
+		}
+	}
+
+	return match
+}
+
+// collapses whitespace and cuts the value to at most limit characters, on a character boundary
+func truncate(value string, limit int) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if utf8.RuneCountInString(value) <= limit {
+		return value
+	}
+
+	runes := []rune(value)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
+
+// resolves a possibly relative link against the page, keeping only http(s) urls
+func resolveURL(base *url.URL, raw string) string {
+	if strings.TrimSpace(raw) == "" {
+		return ""
+	}
+
+	parsed, err := base.Parse(strings.TrimSpace(raw))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ""
+	}
+
+	resolved := parsed.String()
+	if len(resolved) > MaxURLLength {
+		return ""
+	}
+	return resolved
+}
+
+// reads the preview from the page's head
+// open graph tags are preferred, then twitter card tags, then the title and description
+func parse(r io.Reader, pageURL *url.URL) Preview {
+	meta := make(map[string]string)
+	var title strings.Builder
+	inTitle := false
+
+	tokenizer := html.NewTokenizer(r)
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		token := tokenizer.Token()
+		if tokenType == html.EndTagToken && token.Data == "head" {
+			break
+		}
+		if tokenType == html.StartTagToken && token.Data == "body" {
+			break
+		}
+
+		switch {
+		case tokenType == html.StartTagToken && token.Data == "title":
+			inTitle = true
+		case tokenType == html.EndTagToken && token.Data == "title":
+			inTitle = false
+		case tokenType == html.TextToken && inTitle:
+			title.WriteString(token.Data)
+		case (tokenType == html.StartTagToken || tokenType == html.SelfClosingTagToken) && token.Data == "meta":
+			var key, content string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "property", "name":
+					key = strings.ToLower(strings.TrimSpace(attr.Val))
+				case "content":
+					content = attr.Val
+				}
+			}
+			// the first of each tag wins
+			if _, ok := meta[key]; key != "" && !ok {
+				meta[key] = content
+			}
+		}
+	}
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if value := strings.TrimSpace(meta[key]); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	preview := Preview{
+		URL:         pageURL.String(),
+		Title:       truncate(first("og:title", "twitter:title"), maxTitle),
+		Description: truncate(first("og:description", "twitter:description", "description"), maxDescription),
+		ImageURL:    resolveURL(pageURL, first("og:image", "og:image:url", "og:image:secure_url", "twitter:image", "twitter:image:src")),
+		SiteName:    truncate(first("og:site_name"), maxSiteName),
+	}
+	if preview.Title == "" {
+		preview.Title = truncate(title.String(), maxTitle)
+	}
+	if canonical := resolveURL(pageURL, first("og:url")); canonical != "" {
+		preview.URL = canonical
+	}
+
+	return preview
+}
+
+// every fetch, including redirects, must finish within the timeout
+// only the first maxBytes of a page are read
+func NewFetcher(timeout time.Duration, maxBytes int64) *Fetcher {
+	fetcher := &Fetcher{
+		maxBytes:  maxBytes,
+		allowAddr: IsPublicAddr,
+	}
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// runs after dns resolution, with the address about to be connected to
+		Control: func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !fetcher.allowAddr(addr) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		// a proxy would connect on our behalf, skipping the address check
+		Proxy:                  nil,
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    timeout,
+		ResponseHeaderTimeout:  timeout,
+		MaxResponseHeaderBytes: 64 << 10,
+		MaxIdleConns:           10,
+		IdleConnTimeout:        30 * time.Second,
+	}
+
+	fetcher.client = &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("redirect to a non-http url")
+			}
+			return nil
+		},
+	}
+
+	return fetcher
+}
+
+// fetches the page and reads its preview
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return Preview{}, errors.New("url must be http or https")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return Preview{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("page responded with %s", resp.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return Preview{}, ErrNotHTML
+	}
+
+	preview := parse(io.LimitReader(resp.Body, f.maxBytes), resp.Request.URL)
+	if preview.Title == "" && preview.Description == "" {
+		return Preview{}, ErrNoMetadata
+	}
+
+	return preview, nil
+}
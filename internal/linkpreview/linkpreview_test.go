@@ -0,0 +1,279 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPage = `<!doctype html>
+<html>
+<head>
+  <title>Fallback title</title>
+  <meta property="og:title" content="  The   Title ">
+  <meta property="og:description" content="A description.">
+  <meta property="og:image" content="/images/card.png">
+  <meta property="og:site_name" content="Example">
+  <meta name="twitter:title" content="Twitter title">
+</head>
+<body><meta property="og:title" content="Ignored, in the body"></body>
+</html>`
+
+// a fetcher allowed to reach the local test server
+func newTestFetcher(timeout time.Duration, maxBytes int64) *Fetcher {
+	fetcher := NewFetcher(timeout, maxBytes)
+	fetcher.allowAddr = func(addr netip.Addr) bool { return true }
+	return fetcher
+}
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		text     string
+		limit    int
+		expected []string
+	}{
+		{"no links here", 3, []string{}},
+		{"see https://example.com/a.", 3, []string{"https://example.com/a"}},
+		{"(https://example.com/a) and HTTP://Example.COM/b?q=1#top!", 3, []string{"https://example.com/a", "http://example.com/b?q=1"}},
+		{"https://en.wikipedia.org/wiki/Go_(programming_language)", 3, []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}},
+		{"https://a.com https://a.com https://b.com https://c.com", 2, []string{"https://a.com", "https://b.com"}},
+		{"ftp://example.com javascript:alert(1) https://user:pw@example.com", 3, []string{}},
+		{`<a href="https://example.com/x">`, 3, []string{"https://example.com/x"}},
+	}
+
+	for _, test := range tests {
+		received := ExtractURLs(test.text, test.limit)
+		if !slices.Equal(received, test.expected) {
+			t.Errorf("'%s': Expected '%v', received '%v'", test.text, test.expected, received)
+		}
+	}
+}
+
+func TestFindURLs(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"no links here", []string{}},
+		{"see https://example.com/a.", []string{"https://example.com/a"}},
+		{"https://a.com https://a.com", []string{"https://a.com", "https://a.com"}},
+		{"ftp://example.com (http://b.com/x)!", []string{"http://b.com/x"}},
+	}
+
+	for _, test := range tests {
+		received := make([]string, 0)
+		for _, span := range FindURLs(test.text) {
+			received = append(received, test.text[span[0]:span[1]])
+		}
+		if !slices.Equal(received, test.expected) {
+			t.Errorf("'%s': Expected '%v', received '%v'", test.text, test.expected, received)
+		}
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+
+	for _, test := range tests {
+		received := IsPublicAddr(netip.MustParseAddr(test.addr))
+		if received != test.expected {
+			t.Errorf("%s: Expected %t, received %t", test.addr, test.expected, received)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(testPage))
+	})
+	mux.HandleFunc("/twitter", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<head><meta name="twitter:title" content="Card"><meta name="twitter:image" content="https://cdn.example.com/x.jpg"><meta name="description" content="Plain"></head>`))
+	})
+	mux.HandleFunc("/title-only", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Just a title</title></head></html>`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/og", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := newTestFetcher(2*time.Second, 64<<10)
+
+	tests := []struct {
+		path     string
+		expected Preview
+	}{
+		{"/og", Preview{
+			URL:         server.URL + "/og",
+			Title:       "The Title",
+			Description: "A description.",
+			ImageURL:    server.URL + "/images/card.png",
+			SiteName:    "Example",
+		}},
+		{"/twitter", Preview{
+			URL:         server.URL + "/twitter",
+			Title:       "Card",
+			Description: "Plain",
+			ImageURL:    "https://cdn.example.com/x.jpg",
+		}},
+		{"/title-only", Preview{
+			URL:   server.URL + "/title-only",
+			Title: "Just a title",
+		}},
+		// the preview's url is where the redirect ended up
+		{"/redirect", Preview{
+			URL:         server.URL + "/og",
+			Title:       "The Title",
+			Description: "A description.",
+			ImageURL:    server.URL + "/images/card.png",
+			SiteName:    "Example",
+		}},
+	}
+
+	for _, test := range tests {
+		received, err := fetcher.Fetch(context.Background(), server.URL+test.path)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.path, err)
+			continue
+		}
+		if received != test.expected {
+			t.Errorf("%s: Expected '%+v', received '%+v'", test.path, test.expected, received)
+		}
+	}
+}
+
+func TestFetchRejects(t *testing.T) {
+	padding := strings.Repeat("<!-- padding -->", 1000)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG"))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head></head><body>hi</body></html>"))
+	})
+	// the metadata is past the size cap, so it is never read
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head>" + padding + `<meta property="og:title" content="Too far"></head></html>`))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := newTestFetcher(200*time.Millisecond, 1024)
+
+	tests := []struct {
+		path     string
+		expected error
+	}{
+		{"/image", ErrNotHTML},
+		{"/missing", nil},
+		{"/empty", ErrNoMetadata},
+		{"/huge", ErrNoMetadata},
+		{"/slow", nil},
+		{"/loop", nil},
+	}
+
+	for _, test := range tests {
+		_, err := fetcher.Fetch(context.Background(), server.URL+test.path)
+		if err == nil {
+			t.Errorf("%s: Expected an error", test.path)
+			continue
+		}
+		if test.expected != nil && !errors.Is(err, test.expected) {
+			t.Errorf("%s: Expected '%v', received '%v'", test.path, test.expected, err)
+		}
+	}
+
+	_, err := fetcher.Fetch(context.Background(), "file:///etc/passwd")
+	if err == nil {
+		t.Errorf("Expected non-http urls to be rejected")
+	}
+}
+
+// the real fetcher refuses the local test server, and redirects from a public page to it
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(testPage))
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(time.Second, 64<<10)
+	_, err := fetcher.Fetch(context.Background(), server.URL+"/og")
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Expected '%v', received '%v'", ErrBlockedAddress, err)
+	}
+
+	// the redirecting server is allowed, the one it redirects to is not
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("unable to listen on a second loopback address: %s", err)
+	}
+	blocked := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the redirect target to never be reached")
+	}))
+	blocked.Listener.Close()
+	blocked.Listener = listener
+	blocked.Start()
+	defer blocked.Close()
+
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, blocked.URL, http.StatusFound)
+	}))
+	defer redirecting.Close()
+
+	fetcher.allowAddr = func(addr netip.Addr) bool {
+		return addr == netip.MustParseAddr("127.0.0.1")
+	}
+	_, err = fetcher.Fetch(context.Background(), redirecting.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Expected '%v', received '%v'", ErrBlockedAddress, err)
+	}
+}
@@ -0,0 +1,174 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// an outgoing plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// sends email, implemented by SMTPMailer and WriterMailer
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// formats the message as RFC 5322 text
+// header values may not contain line breaks, to prevent header injection
+func formatMessage(from string, msg Message, date time.Time) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, errors.New("header value contains a line break")
+		}
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "From: %s\r\n", from)
+	fmt.Fprintf(&builder, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&builder, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&builder, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	builder.WriteString("\r\n")
+
+	return []byte(builder.String()), nil
+}
+
+// SMTP
+
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// credentials are optional, without them no AUTH is attempted
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := formatMessage(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// dialing ourselves lets the context bound the whole exchange
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.host, m.port))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(nil)
+		if err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		err = client.Auth(smtp.PlainAuth("", m.username, m.password, m.host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(m.from)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(msg.To)
+	if err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// file and log
+
+// writes each message to a writer instead of sending it
+// used for local development without a mail server
+type WriterMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewWriterMailer(w io.Writer, from string) *WriterMailer {
+	return &WriterMailer{w: w, from: from}
+}
+
+// appends messages to the file at path
+func NewFileMailer(path, from string) (*WriterMailer, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterMailer(file, from), nil
+}
+
+// writes messages to the standard logger's output
+func NewLogMailer(from string) *WriterMailer {
+	return NewWriterMailer(log.Writer(), from)
+}
+
+func (m *WriterMailer) Send(ctx context.Context, msg Message) error {
+	data, err := formatMessage(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = fmt.Fprintf(m.w, "----- email -----\n%s----- end email -----\n", strings.ReplaceAll(string(data), "\r\n", "\n"))
+	return err
+}
@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatMessage(t *testing.T) {
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg := Message{To: "tim@apple.com", Subject: "Hello", Body: "line one\nline two"}
+
+	data, err := formatMessage("Chirpy <no-reply@chirpy.local>", msg, date)
+	if err != nil {
+		t.Fatalf("Error formatting message: %s", err)
+	}
+
+	expected := "From: Chirpy <no-reply@chirpy.local>\r\n" +
+		"To: tim@apple.com\r\n" +
+		"Subject: Hello\r\n" +
+		"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"line one\r\nline two\r\n"
+	if string(data) != expected {
+		t.Errorf("Expected '%q', Got: '%q'", expected, string(data))
+	}
+}
+
+func TestFormatMessageHeaderInjection(t *testing.T) {
+	tests := []Message{
+		{To: "tim@apple.com\r\nBcc: everyone@apple.com", Subject: "Hello"},
+		{To: "tim@apple.com", Subject: "Hello\nBcc: everyone@apple.com"},
+	}
+
+	for _, msg := range tests {
+		_, err := formatMessage("no-reply@chirpy.local", msg, time.Now())
+		if err == nil {
+			t.Errorf("Expected error for message '%+v'", msg)
+		}
+	}
+}
+
+func TestWriterMailer(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	m := NewWriterMailer(buffer, "no-reply@chirpy.local")
+
+	err := m.Send(context.Background(), Message{To: "tim@apple.com", Subject: "Reset", Body: "token: abc"})
+	if err != nil {
+		t.Fatalf("Error sending message: %s", err)
+	}
+
+	output := buffer.String()
+	for _, expected := range []string{"To: tim@apple.com\n", "Subject: Reset\n", "token: abc"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected '%s' in output '%s'", expected, output)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m, err := NewFileMailer(path, "no-reply@chirpy.local")
+	if err != nil {
+		t.Fatalf("Error creating file mailer: %s", err)
+	}
+
+	for _, subject := range []string{"first", "second"} {
+		err = m.Send(context.Background(), Message{To: "tim@apple.com", Subject: subject, Body: "hi"})
+		if err != nil {
+			t.Fatalf("Error sending message: %s", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading mail file: %s", err)
+	}
+	if strings.Count(string(data), "----- email -----") != 2 {
+		t.Errorf("Expected two messages in file, Got: '%s'", string(data))
+	}
+}
@@ -0,0 +1,131 @@
+package media
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+const exifOrientationTag = 0x0112
+
+// reads the orientation (1 to 8) from a jpeg's exif data
+// returns 1, meaning upright, when there is none or it can not be read
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// walk the segments until the start of the image data
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		// start of scan, no more metadata follows
+		if marker == 0xDA {
+			return 1
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+length]
+
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+
+		pos += 2 + length
+	}
+
+	return 1
+}
+
+// finds the orientation tag in the first image file directory of the tiff header
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := range entries {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+
+	return 1
+}
+
+// rotates and flips the pixels so the image is upright, as exif orientation describes
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// orientations 5 to 8 turn the image on its side
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for dy := range dstHeight {
+		for dx := range dstWidth {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = width-1-dx, dy
+			case 3: // upside down
+				sx, sy = width-1-dx, height-1-dy
+			case 4: // upside down and mirrored
+				sx, sy = dx, height-1-dy
+			case 5: // on its side and mirrored
+				sx, sy = dy, dx
+			case 6: // needs turning clockwise
+				sx, sy = dy, height-1-dx
+			case 7: // on its side, mirrored the other way
+				sx, sy = width-1-dy, height-1-dx
+			case 8: // needs turning anticlockwise
+				sx, sy = width-1-dy, dx
+			}
+
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
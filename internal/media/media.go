@@ -0,0 +1,343 @@
+// checks and cleans uploaded images before they are stored
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	TypeJPEG = "image/jpeg"
+	TypePNG  = "image/png"
+	TypeGIF  = "image/gif"
+
+	// images with more pixels than this are rejected before decoding
+	// a small file can claim huge dimensions, and decoding it would use gigabytes
+	MaxPixels = 40_000_000
+	// animated gifs are decoded a frame at a time, so the frames are limited too,
+	// and so are their pixels added up over every frame
+	MaxGIFFrames = 500
+
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrInvalidImage    = errors.New("invalid image")
+	ErrTooManyPixels   = errors.New("image has too many pixels")
+	ErrTooManyFrames   = errors.New("animation has too many frames")
+)
+
+type Image struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// the content type found from the data itself, the client's claimed type is never trusted
+func Sniff(data []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return mediaType
+}
+
+func IsSupported(contentType string) bool {
+	return contentType == TypeJPEG || contentType == TypePNG || contentType == TypeGIF
+}
+
+// the file extension used in storage keys
+func Extension(contentType string) string {
+	switch contentType {
+	case TypeJPEG:
+		return ".jpg"
+	case TypePNG:
+		return ".png"
+	case TypeGIF:
+		return ".gif"
+	}
+	return ""
+}
+
+// decodes an uploaded image and encodes it again
+// re-encoding drops every piece of metadata, such as exif location data and comments
+// jpeg orientation is applied to the pixels first, so the image still displays upright
+// images larger than maxDimension on either side are scaled down, every frame of an animated gif alike
+func Process(data []byte, maxDimension int) (Image, error) {
+	contentType := Sniff(data)
+	if !IsSupported(contentType) {
+		return Image{}, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return Image{}, ErrInvalidImage
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return Image{}, ErrTooManyPixels
+	}
+
+	if contentType == TypeGIF {
+		return processGIF(data, maxDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+
+	if contentType == TypeJPEG {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	img = Resize(img, maxDimension)
+
+	encoded, err := Encode(img, contentType)
+	if err != nil {
+		return Image{}, err
+	}
+
+	return Image{
+		Data:        encoded,
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}, nil
+}
+
+// keeps every frame and the loop count, but none of the comment or application extensions
+// the frames are counted from the file before any are decoded
+func processGIF(data []byte, maxDimension int) (Image, error) {
+	frames, pixels, err := scanGIF(data)
+	if err != nil {
+		return Image{}, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+	if frames > MaxGIFFrames {
+		return Image{}, ErrTooManyFrames
+	}
+	if pixels > MaxPixels {
+		return Image{}, ErrTooManyPixels
+	}
+
+	animation, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+
+	config := animation.Config
+	frameImages := animation.Image
+	width, height := config.Width, config.Height
+	if maxDimension > 0 && (width > maxDimension || height > maxDimension) {
+		frameImages, width, height = resizeGIF(animation, maxDimension)
+		config.Width, config.Height = width, height
+	}
+
+	var encoded bytes.Buffer
+	err = gif.EncodeAll(&encoded, &gif.GIF{
+		Image:           frameImages,
+		Delay:           animation.Delay,
+		LoopCount:       animation.LoopCount,
+		Disposal:        animation.Disposal,
+		Config:          config,
+		BackgroundIndex: animation.BackgroundIndex,
+	})
+	if err != nil {
+		return Image{}, err
+	}
+
+	return Image{
+		Data:        encoded.Bytes(),
+		ContentType: TypeGIF,
+		Width:       width,
+		Height:      height,
+	}, nil
+}
+
+// counts the frames of a gif, and adds up their pixels, by walking its blocks without decoding any
+func scanGIF(data []byte) (frames int, pixels int64, err error) {
+	errTruncated := errors.New("gif is truncated")
+
+	// header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, 0, errTruncated
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << ((data[10] & 0x07) + 1)
+	}
+
+	// data sub-blocks, each led by its length, up to one of length zero
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return errTruncated
+			}
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+
+	for {
+		if pos >= len(data) {
+			return 0, 0, errTruncated
+		}
+
+		switch data[pos] {
+		case 0x21: // extension
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, 0, err
+			}
+		case 0x2C: // image descriptor
+			if pos+10 > len(data) {
+				return 0, 0, errTruncated
+			}
+			width := int64(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int64(binary.LittleEndian.Uint16(data[pos+7:]))
+			packed := data[pos+9]
+			pos += 10
+			if packed&0x80 != 0 {
+				pos += 3 << ((packed & 0x07) + 1)
+			}
+			// lzw minimum code size, then the image data
+			pos++
+			if err := skipSubBlocks(); err != nil {
+				return 0, 0, err
+			}
+
+			frames++
+			pixels += width * height
+			// no need to read on once either is over its limit
+			if frames > MaxGIFFrames || pixels > MaxPixels {
+				return frames, pixels, nil
+			}
+		case 0x3B: // trailer
+			return frames, pixels, nil
+		default:
+			return 0, 0, fmt.Errorf("unknown gif block 0x%02x", data[pos])
+		}
+	}
+}
+
+// scales every frame by the same amount, so the longest side of the animation is at most maxDimension
+// frames keep their palettes, nearest neighbour scaling only ever picks colours already in them
+func resizeGIF(animation *gif.GIF, maxDimension int) ([]*image.Paletted, int, int) {
+	width, height := animation.Config.Width, animation.Config.Height
+	newWidth, newHeight := maxDimension, maxDimension
+	if width > height {
+		newHeight = max(1, height*maxDimension/width)
+	} else {
+		newWidth = max(1, width*maxDimension/height)
+	}
+
+	scale := func(v, from, to int) int {
+		return v * to / from
+	}
+
+	frames := make([]*image.Paletted, 0, len(animation.Image))
+	for _, frame := range animation.Image {
+		bounds := frame.Bounds()
+		scaled := image.Rect(
+			scale(bounds.Min.X, width, newWidth),
+			scale(bounds.Min.Y, height, newHeight),
+			max(scale(bounds.Max.X, width, newWidth), scale(bounds.Min.X, width, newWidth)+1),
+			max(scale(bounds.Max.Y, height, newHeight), scale(bounds.Min.Y, height, newHeight)+1),
+		).Intersect(image.Rect(0, 0, newWidth, newHeight))
+
+		resized := image.NewPaletted(scaled, frame.Palette)
+		draw.NearestNeighbor.Scale(resized, scaled, frame, bounds, draw.Src, nil)
+		frames = append(frames, resized)
+	}
+
+	return frames, newWidth, newHeight
+}
+
+// scales the image down so neither side is longer than maxDimension, keeping its aspect ratio
+// smaller images, and a maxDimension of zero, leave it unchanged
+func Resize(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxDimension <= 0 || (width <= maxDimension && height <= maxDimension) {
+		return img
+	}
+
+	newWidth, newHeight := maxDimension, maxDimension
+	if width > height {
+		newHeight = max(1, height*maxDimension/width)
+	} else {
+		newWidth = max(1, width*maxDimension/height)
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+
+	return resized
+}
+
+// encodes a still image in one of the supported types
+// gifs are encoded as a single frame
+func Encode(img image.Image, contentType string) ([]byte, error) {
+	var encoded bytes.Buffer
+	var err error
+
+	switch contentType {
+	case TypeJPEG:
+		err = jpeg.Encode(&encoded, img, &jpeg.Options{Quality: jpegQuality})
+	case TypePNG:
+		err = png.Encode(&encoded, img)
+	case TypeGIF:
+		err = gif.Encode(&encoded, img, nil)
+	default:
+		return nil, ErrUnsupportedType
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return encoded.Bytes(), nil
+}
+
+// the type a thumbnail of the content type is stored as
+// gif thumbnails are a png of the first frame, since scaling every frame is slow and rarely wanted
+func ThumbnailType(contentType string) string {
+	if contentType == TypeGIF {
+		return TypePNG
+	}
+	return contentType
+}
+
+// scales a decoded image so its longest side is at most size
+func Thumbnail(img image.Image, contentType string, size int) (Image, error) {
+	resized := Resize(img, size)
+	thumbnailType := ThumbnailType(contentType)
+
+	encoded, err := Encode(resized, thumbnailType)
+	if err != nil {
+		return Image{}, err
+	}
+
+	return Image{
+		Data:        encoded,
+		ContentType: thumbnailType,
+		Width:       resized.Bounds().Dx(),
+		Height:      resized.Bounds().Dy(),
+	}, nil
+}
@@ -0,0 +1,313 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+func encodeTestImage(t *testing.T, img image.Image, contentType string) []byte {
+	data, err := Encode(img, contentType)
+	if err != nil {
+		t.Fatalf("Error encoding test image: %s", err)
+	}
+	return data
+}
+
+// adds an app1 segment with the given orientation after the jpeg's start of image marker
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, exifOrientationTag)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // short
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{encodeTestImage(t, testImage(4, 4), TypePNG), TypePNG},
+		{encodeTestImage(t, testImage(4, 4), TypeJPEG), TypeJPEG},
+		{encodeTestImage(t, testImage(4, 4), TypeGIF), TypeGIF},
+		{[]byte("<html><script>alert(1)</script></html>"), "text/html"},
+		{[]byte("just text"), "text/plain"},
+	}
+
+	for _, test := range tests {
+		received := Sniff(test.data)
+		if received != test.expected {
+			t.Errorf("Expected '%s', received '%s'", test.expected, received)
+		}
+	}
+}
+
+func TestProcessResizes(t *testing.T) {
+	tests := []struct {
+		contentType    string
+		width          int
+		height         int
+		maxDimension   int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{TypePNG, 400, 200, 100, 100, 50},
+		{TypeJPEG, 200, 400, 100, 50, 100},
+		{TypePNG, 80, 60, 100, 80, 60},
+		{TypeJPEG, 80, 60, 0, 80, 60},
+	}
+
+	for _, test := range tests {
+		data := encodeTestImage(t, testImage(test.width, test.height), test.contentType)
+
+		processed, err := Process(data, test.maxDimension)
+		if err != nil {
+			t.Fatalf("Error processing image: %s", err)
+		}
+		if processed.ContentType != test.contentType {
+			t.Errorf("Expected '%s', received '%s'", test.contentType, processed.ContentType)
+		}
+		if processed.Width != test.expectedWidth || processed.Height != test.expectedHeight {
+			t.Errorf("Expected %dx%d, Got: %dx%d", test.expectedWidth, test.expectedHeight, processed.Width, processed.Height)
+		}
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(processed.Data))
+		if err != nil {
+			t.Fatalf("Error decoding processed image: %s", err)
+		}
+		if config.Width != processed.Width || config.Height != processed.Height {
+			t.Errorf("Expected encoded size %dx%d, Got: %dx%d", processed.Width, processed.Height, config.Width, config.Height)
+		}
+	}
+}
+
+func TestProcessStripsExif(t *testing.T) {
+	data := withOrientation(encodeTestImage(t, testImage(40, 20), TypeJPEG), 6)
+	if jpegOrientation(data) != 6 {
+		t.Fatalf("Expected test image to have orientation 6")
+	}
+
+	processed, err := Process(data, 0)
+	if err != nil {
+		t.Fatalf("Error processing image: %s", err)
+	}
+
+	if bytes.Contains(processed.Data, []byte("Exif")) {
+		t.Errorf("Expected exif data to be removed")
+	}
+	// turned on its side to be upright
+	if processed.Width != 20 || processed.Height != 40 {
+		t.Errorf("Expected 20x40, Got: %dx%d", processed.Width, processed.Height)
+	}
+}
+
+// an animation of the given number of frames, each covering the whole width by height
+func encodeTestGIF(t *testing.T, frames, width, height int) []byte {
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{}
+	for range frames {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, width, height), palette))
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	var data bytes.Buffer
+	err := gif.EncodeAll(&data, animation)
+	if err != nil {
+		t.Fatalf("Error encoding test gif: %s", err)
+	}
+	return data.Bytes()
+}
+
+func TestProcessKeepsGIFFrames(t *testing.T) {
+	tests := []struct {
+		width          int
+		height         int
+		maxDimension   int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{10, 10, 5, 5, 5},
+		{40, 20, 10, 10, 5},
+		{8, 6, 10, 8, 6},
+		{8, 6, 0, 8, 6},
+	}
+
+	for _, test := range tests {
+		processed, err := Process(encodeTestGIF(t, 2, test.width, test.height), test.maxDimension)
+		if err != nil {
+			t.Fatalf("Error processing gif: %s", err)
+		}
+		if processed.Width != test.expectedWidth || processed.Height != test.expectedHeight {
+			t.Errorf("Expected %dx%d, Got: %dx%d", test.expectedWidth, test.expectedHeight, processed.Width, processed.Height)
+		}
+
+		decoded, err := gif.DecodeAll(bytes.NewReader(processed.Data))
+		if err != nil {
+			t.Fatalf("Error decoding processed gif: %s", err)
+		}
+		if len(decoded.Image) != 2 {
+			t.Errorf("Expected: %d frames, Got: %d", 2, len(decoded.Image))
+		}
+		if decoded.Config.Width != test.expectedWidth || decoded.Config.Height != test.expectedHeight {
+			t.Errorf("Expected encoded size %dx%d, Got: %dx%d", test.expectedWidth, test.expectedHeight, decoded.Config.Width, decoded.Config.Height)
+		}
+		for _, frame := range decoded.Image {
+			if !frame.Bounds().In(image.Rect(0, 0, test.expectedWidth, test.expectedHeight)) {
+				t.Errorf("Expected frame within %dx%d, Got: %v", test.expectedWidth, test.expectedHeight, frame.Bounds())
+			}
+		}
+	}
+}
+
+func TestScanGIF(t *testing.T) {
+	frames, pixels, err := scanGIF(encodeTestGIF(t, 3, 20, 10))
+	if err != nil {
+		t.Fatalf("Error scanning gif: %s", err)
+	}
+	if frames != 3 || pixels != 600 {
+		t.Errorf("Expected: 3 frames of 600 pixels, Got: %d frames of %d pixels", frames, pixels)
+	}
+
+	_, _, err = scanGIF([]byte("GIF89a\x0a\x00\x0a\x00\x00\x00\x00"))
+	if err == nil {
+		t.Errorf("Expected an error for a gif without a trailer")
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	// a gif header claiming to be 65535 by 65535 pixels
+	pixelBomb := []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00\x3b")
+	// each frame is small, but there are enough of them to add up to too many pixels
+	framePixelBomb := encodeTestGIF(t, 20, 2000, 1001)
+
+	tests := []struct {
+		data     []byte
+		expected error
+	}{
+		{[]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), ErrUnsupportedType},
+		{[]byte("%PDF-1.4"), ErrUnsupportedType},
+		{append([]byte("\x89PNG\r\n\x1a\n"), []byte("truncated")...), ErrInvalidImage},
+		{pixelBomb, ErrTooManyPixels},
+		{framePixelBomb, ErrTooManyPixels},
+		{encodeTestGIF(t, MaxGIFFrames+1, 1, 1), ErrTooManyFrames},
+	}
+
+	for _, test := range tests {
+		_, err := Process(test.data, 100)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("Expected '%v', received '%v'", test.expected, err)
+		}
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// a 2x1 image, red on the left and blue on the right
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		// the top-left pixel after orienting, and the size
+		topLeft color.RGBA
+		width   int
+		height  int
+	}{
+		{1, red, 2, 1},
+		{2, blue, 2, 1},
+		{3, blue, 2, 1},
+		{4, red, 2, 1},
+		{5, red, 1, 2},
+		{6, red, 1, 2},
+		{7, blue, 1, 2},
+		{8, blue, 1, 2},
+	}
+
+	for _, test := range tests {
+		oriented := applyOrientation(img, test.orientation)
+		bounds := oriented.Bounds()
+		if bounds.Dx() != test.width || bounds.Dy() != test.height {
+			t.Errorf("Orientation %d, Expected %dx%d, Got: %dx%d", test.orientation, test.width, test.height, bounds.Dx(), bounds.Dy())
+			continue
+		}
+		received := color.RGBAModel.Convert(oriented.At(0, 0)).(color.RGBA)
+		if received != test.topLeft {
+			t.Errorf("Orientation %d, Expected top left %v, received %v", test.orientation, test.topLeft, received)
+		}
+	}
+}
+
+func TestJPEGOrientationIgnoresGarbage(t *testing.T) {
+	tests := [][]byte{
+		nil,
+		[]byte("not a jpeg"),
+		{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF},
+		{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x0A, 'E', 'x', 'i', 'f', 0, 0, 'X', 'X'},
+	}
+
+	for _, test := range tests {
+		received := jpegOrientation(test)
+		if received != 1 {
+			t.Errorf("Expected: %d, Got: %d", 1, received)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		contentType    string
+		size           int
+		expectedType   string
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{TypeJPEG, 160, TypeJPEG, 160, 80},
+		{TypePNG, 100, TypePNG, 100, 50},
+		{TypeGIF, 160, TypePNG, 160, 80},
+	}
+
+	img := testImage(320, 160)
+	for _, test := range tests {
+		thumbnail, err := Thumbnail(img, test.contentType, test.size)
+		if err != nil {
+			t.Fatalf("Error making thumbnail: %s", err)
+		}
+		if thumbnail.ContentType != test.expectedType {
+			t.Errorf("Expected '%s', received '%s'", test.expectedType, thumbnail.ContentType)
+		}
+		if thumbnail.Width != test.expectedWidth || thumbnail.Height != test.expectedHeight {
+			t.Errorf("Expected %dx%d, Got: %dx%d", test.expectedWidth, test.expectedHeight, thumbnail.Width, thumbnail.Height)
+		}
+		if Sniff(thumbnail.Data) != test.expectedType {
+			t.Errorf("Expected data of type '%s', received '%s'", test.expectedType, Sniff(thumbnail.Data))
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// delivers signed webhooks to the urls integrators subscribe with
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/linkpreview"
+)
+
+const (
+	userAgent = "ChirpyWebhooks/1.0"
+
+	EventHeader     = "Chirpy-Event"
+	DeliveryHeader  = "Chirpy-Delivery"
+	TimestampHeader = "Webhook-Timestamp"
+	SignatureHeader = "Webhook-Signature"
+
+	MaxURLLength = 2000
+	// only the start of a receiver's response is read, the rest is discarded
+	maxResponseBytes = 1 << 10
+)
+
+var ErrBlockedAddress = errors.New("address is not public")
+
+// a webhook to send
+type Delivery struct {
+	ID    string
+	Event string
+	Body  []byte
+}
+
+// what the receiver responded with
+type Result struct {
+	// zero when no response was received
+	StatusCode int
+	Duration   time.Duration
+}
+
+// sends webhooks, refusing to connect to anything but public addresses
+// redirects are not followed, a receiver must respond itself
+type Sender struct {
+	client *http.Client
+	// reports if an address may be connected to, swapped out in tests
+	allowAddr func(netip.Addr) bool
+}
+
+// checks that a subscriber's url is an absolute http(s) url
+// the address it points at is only checked when a webhook is sent, as it may change
+func ValidateURL(rawURL string) error {
+	if len(rawURL) > MaxURLLength {
+		return fmt.Errorf("url is longer than %d characters", MaxURLLength)
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return errors.New("url must start with http:// or https://")
+	}
+	if parsed.Hostname() == "" {
+		return errors.New("url has no host")
+	}
+	if parsed.User != nil {
+		return errors.New("url must not contain credentials")
+	}
+
+	return nil
+}
+
+// every delivery must finish within the timeout
+func NewSender(timeout time.Duration) *Sender {
+	sender := &Sender{allowAddr: linkpreview.IsPublicAddr}
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// runs after dns resolution, with the address about to be connected to
+		Control: func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !sender.allowAddr(addr) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		// a proxy would connect on our behalf, skipping the address check
+		Proxy:                  nil,
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    timeout,
+		ResponseHeaderTimeout:  timeout,
+		MaxResponseHeaderBytes: 64 << 10,
+		MaxIdleConns:           10,
+		IdleConnTimeout:        30 * time.Second,
+	}
+
+	sender.client = &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return sender
+}
+
+// posts the delivery, signed with the subscriber's secret the same way chirpy checks inbound webhooks
+// any status other than 2xx is an error, with the status in the result
+func (s *Sender) Send(ctx context.Context, rawURL, secret string, delivery Delivery, now time.Time) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, auth.SignWebhook(delivery.Body, now, secret))
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Result{Duration: time.Since(start)}, err
+	}
+	defer resp.Body.Close()
+	// drained so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	result := Result{StatusCode: resp.StatusCode, Duration: time.Since(start)}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+
+	return result, nil
+}
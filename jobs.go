@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/nicholasss/chirpy/internal/jobs"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	jobPollInterval = time.Duration(time.Second * 2)
+	// longer than any job should take, one still running by then may be claimed again
+	jobVisibilityTimeout = time.Duration(time.Minute * 10)
+	jobRetryBaseDelay    = time.Duration(time.Second * 30)
+	jobRetryMaxDelay     = time.Duration(time.Hour * 1)
+	// finished jobs are kept this long, to look into failures
+	jobRetention = time.Duration(time.Hour * 24 * 7)
+	// how long running jobs get to finish on shutdown, before they are cancelled and left to be retried
+	jobShutdownTimeout = time.Duration(time.Second * 30)
+)
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// the runner for every kind of background job, one worker per cpu
+// link previews spend most of their time waiting on other servers, so there are at least 4 workers
+func (cfg *apiConfig) newJobRunner() *jobs.Runner {
+	runner := jobs.NewRunner(cfg.db, jobs.Config{
+		Workers:           max(runtime.NumCPU(), 4),
+		PollInterval:      jobPollInterval,
+		VisibilityTimeout: jobVisibilityTimeout,
+		BaseBackoff:       jobRetryBaseDelay,
+		MaxBackoff:        jobRetryMaxDelay,
+	})
+
+	jobs.Register(runner, cfg.deliverEmail)
+	jobs.Register(runner, cfg.buildDataExport)
+	jobs.Register(runner, cfg.publishScheduledChirp)
+	jobs.Register(runner, func(ctx context.Context, job thumbnailJob) error {
+		return cfg.generateThumbnails(ctx, job)
+	})
+	jobs.Register(runner, func(ctx context.Context, job linkPreviewJob) error {
+		return cfg.refreshLinkPreview(ctx, job.URL)
+	})
+
+	// periodic jobs, one run at a time across every instance
+	jobs.RegisterPeriodic(runner, accountReaperInterval, cfg.reapAccounts)
+	jobs.RegisterPeriodic(runner, subscriptionExpiryInterval, func(ctx context.Context, job subscriptionExpiryJob) error {
+		cfg.expireLapsedSubscriptions(ctx)
+		return nil
+	})
+	jobs.RegisterPeriodic(runner, webhookDeliveryInterval, func(ctx context.Context, job webhookDeliveryJob) error {
+		cfg.deliverDueWebhooks(ctx)
+		return nil
+	})
+
+	return runner
+}
+
+// deletes jobs that finished, or failed for good, before the retention period
+func (cfg *apiConfig) purgeFinishedJobs(ctx context.Context) {
+	cutoff := time.Now().UTC().Add(-jobRetention)
+	deleted, err := cfg.db.DeleteFinishedJobsBefore(ctx, sql.NullTime{Time: cutoff, Valid: true})
+	if err != nil {
+		log.Printf("Unable to delete finished jobs: %s", err)
+		return
+	}
+
+	if deleted > 0 {
+		log.Printf("Deleted %d finished jobs.", deleted)
+	}
+}
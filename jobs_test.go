@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/jobs"
+)
+
+func TestJobArgs(t *testing.T) {
+	var tests = []jobs.Args{
+		emailJob{To: "walt@breakingbad.com", Subject: "Hello", Body: "Line one\nLine two"},
+		dataExportJob{ExportID: uuid.New(), UserID: uuid.New()},
+		thumbnailJob{AttachmentID: uuid.New(), Sizes: []int32{320}},
+		linkPreviewJob{URL: "https://example.com/a?b=c"},
+		accountReaperJob{},
+		subscriptionExpiryJob{},
+		webhookDeliveryJob{},
+	}
+
+	kinds := make(map[string]bool)
+	for _, test := range tests {
+		if kinds[test.Kind()] {
+			t.Errorf("Kind '%s' is used by more than one job", test.Kind())
+		}
+		kinds[test.Kind()] = true
+
+		// jobs are stored as json, and must come back the same
+		payload, err := json.Marshal(test)
+		if err != nil {
+			t.Fatalf("unable to marshal '%s': %s", test.Kind(), err)
+		}
+		received := reflect.New(reflect.TypeOf(test))
+		err = json.Unmarshal(payload, received.Interface())
+		if err != nil {
+			t.Fatalf("unable to unmarshal '%s': %s", test.Kind(), err)
+		}
+		if !reflect.DeepEqual(received.Elem().Interface(), test) {
+			t.Errorf("Expected '%+v', received '%+v'", test, received.Elem().Interface())
+		}
+	}
+}
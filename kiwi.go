@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	// holds the timestamp and signatures, as 't=<unix>,v1=<hex>,v1=<hex>'
+	kiwiSignatureHeader = "Kiwi-Signature"
+
+	kiwiEventSubscriptionCreated  = "subscription.created"
+	kiwiEventSubscriptionCanceled = "subscription.canceled"
+	kiwiEventInvoicePaid          = "invoice.paid"
+	kiwiEventInvoicePaymentFailed = "invoice.payment_failed"
+	kiwiEventChargeRefunded       = "charge.refunded"
+)
+
+// ================
+// GLOBAL VARIABLES
+// ================
+
+// the subscription event each kiwi event is
+var kiwiSubscriptionEvents = map[string]string{
+	kiwiEventSubscriptionCreated:  subscriptionEventStarted,
+	kiwiEventInvoicePaid:          subscriptionEventRenewed,
+	kiwiEventInvoicePaymentFailed: subscriptionEventPaymentFailed,
+	kiwiEventSubscriptionCanceled: subscriptionEventCanceled,
+	kiwiEventChargeRefunded:       subscriptionEventRefunded,
+}
+
+// =====
+// TYPES
+// =====
+
+type KiwiWebhookRequest struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// unix seconds
+	Created int64 `json:"created"`
+	Data    struct {
+		Object struct {
+			ID string `json:"id"`
+			// the chirpy user id, set when the checkout was started
+			ClientReferenceID string `json:"client_reference_id"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// kiwi, a second payment processor chirpy red can be sold through
+type kiwiProvider struct {
+	secrets []string
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// splits a Kiwi-Signature header into its timestamp, and its signatures as a comma separated list
+func parseKiwiSignature(header string) (string, string) {
+	timestamp := ""
+	signatures := make([]string, 0)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if value, ok := strings.CutPrefix(part, "t="); ok {
+			timestamp = value
+		} else if strings.HasPrefix(part, "v1=") {
+			signatures = append(signatures, part)
+		}
+	}
+
+	return timestamp, strings.Join(signatures, ",")
+}
+
+func (p kiwiProvider) Name() string {
+	return webhookProviderKiwi
+}
+
+// kiwi always signs its webhooks, the same way polka does, with the timestamp and signatures
+// in one header
+func (p kiwiProvider) Verify(headers http.Header, body []byte, now time.Time) (string, error) {
+	if len(p.secrets) == 0 {
+		return "", errors.New("KIWI_WEBHOOK_SECRETS is not set")
+	}
+
+	timestamp, signatures := parseKiwiSignature(headers.Get(kiwiSignatureHeader))
+	err := auth.ValidateWebhookSignature(body, timestamp, signatures, p.secrets, webhookTimestampTolerance, now)
+	if err != nil {
+		return "", err
+	}
+
+	return webhookNonce(timestamp, body), nil
+}
+
+func (p kiwiProvider) Parse(body []byte) (webhookEvent, error) {
+	var webhookRequest KiwiWebhookRequest
+	err := json.Unmarshal(body, &webhookRequest)
+	if err != nil {
+		return webhookEvent{}, err
+	}
+
+	event := webhookEvent{
+		ID:           webhookRequest.ID,
+		ProviderType: webhookRequest.Type,
+		Type:         kiwiSubscriptionEvents[webhookRequest.Type],
+	}
+	// the other events may be about something else, and have no user
+	if event.Type == "" {
+		return event, nil
+	}
+
+	event.UserID, err = uuid.Parse(webhookRequest.Data.Object.ClientReferenceID)
+	if err != nil {
+		return webhookEvent{}, fmt.Errorf("invalid client_reference_id: %w", err)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+)
+
+func TestKiwiProviderParse(t *testing.T) {
+	userID := uuid.MustParse("3f2b8c1e-6d4a-4b7e-9a35-2c1d0e8f7a61")
+
+	var tests = []struct {
+		fixture  string
+		expected webhookEvent
+	}{
+		{"subscription_created", webhookEvent{"evt_kiwi_subscription_created", kiwiEventSubscriptionCreated, subscriptionEventStarted, userID}},
+		{"invoice_paid", webhookEvent{"evt_kiwi_invoice_paid", kiwiEventInvoicePaid, subscriptionEventRenewed, userID}},
+		{"invoice_payment_failed", webhookEvent{"evt_kiwi_invoice_payment_failed", kiwiEventInvoicePaymentFailed, subscriptionEventPaymentFailed, userID}},
+		{"subscription_canceled", webhookEvent{"evt_kiwi_subscription_canceled", kiwiEventSubscriptionCanceled, subscriptionEventCanceled, userID}},
+		{"charge_refunded", webhookEvent{"evt_kiwi_charge_refunded", kiwiEventChargeRefunded, subscriptionEventRefunded, userID}},
+		// not about a subscription, so it has no user
+		{"customer_updated", webhookEvent{"evt_kiwi_customer_updated", "customer.updated", "", uuid.Nil}},
+	}
+
+	for _, test := range tests {
+		received, err := kiwiProvider{}.Parse(readWebhookFixture(t, webhookProviderKiwi, test.fixture))
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", test.fixture, err)
+			continue
+		}
+		if received != test.expected {
+			t.Errorf("%s: Expected '%+v', received '%+v'", test.fixture, test.expected, received)
+		}
+	}
+
+	_, err := kiwiProvider{}.Parse(readWebhookFixture(t, webhookProviderKiwi, "invalid_reference"))
+	if err == nil {
+		t.Errorf("Expected an error for a client_reference_id that is not a user id")
+	}
+}
+
+func TestParseKiwiSignature(t *testing.T) {
+	var tests = []struct {
+		header             string
+		expectedTimestamp  string
+		expectedSignatures string
+	}{
+		{"t=1740830400,v1=abc", "1740830400", "v1=abc"},
+		{"t=1740830400, v1=abc, v0=old, v1=def", "1740830400", "v1=abc,v1=def"},
+		{"v1=abc", "", "v1=abc"},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		timestamp, signatures := parseKiwiSignature(test.header)
+		if timestamp != test.expectedTimestamp || signatures != test.expectedSignatures {
+			t.Errorf("Header '%s', expected '%s' and '%s', received '%s' and '%s'", test.header, test.expectedTimestamp, test.expectedSignatures, timestamp, signatures)
+		}
+	}
+}
+
+func TestKiwiProviderVerify(t *testing.T) {
+	body := readWebhookFixture(t, webhookProviderKiwi, "invoice_paid")
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	signed := func(header string) http.Header {
+		headers := http.Header{}
+		headers.Set(kiwiSignatureHeader, header)
+		return headers
+	}
+
+	configured := kiwiProvider{secrets: []string{"new", "old"}}
+
+	var tests = []struct {
+		name          string
+		provider      kiwiProvider
+		headers       http.Header
+		expectErr     bool
+		expectedNonce string
+	}{
+		{"signed", configured, signed("t=" + timestamp + "," + auth.SignWebhook(body, now, "new")), false, webhookNonce(timestamp, body)},
+		{"rotating", configured, signed("t=" + timestamp + "," + auth.SignWebhook(body, now, "other") + "," + auth.SignWebhook(body, now, "old")), false, webhookNonce(timestamp, body)},
+		{"unknown secret", configured, signed("t=" + timestamp + "," + auth.SignWebhook(body, now, "other")), true, ""},
+		{"expired", configured, signed("t=1700000000," + auth.SignWebhook(body, time.Unix(1700000000, 0), "new")), true, ""},
+		{"unsigned", configured, http.Header{}, true, ""},
+		{"unset", kiwiProvider{}, signed("t=" + timestamp + "," + auth.SignWebhook(body, now, "new")), true, ""},
+	}
+
+	for _, test := range tests {
+		nonce, err := test.provider.Verify(test.headers, body, now)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: Expected error: %t, received: %v", test.name, test.expectErr, err)
+			continue
+		}
+		if nonce != test.expectedNonce {
+			t.Errorf("%s: Expected '%s', received '%s'", test.name, test.expectedNonce, nonce)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nicholasss/chirpy/internal/database"
+	"github.com/nicholasss/chirpy/internal/media"
+)
+
+// =====
+// TYPES
+// =====
+
+type LimitsResponse struct {
+	Chirp ChirpLimits `json:"chirp"`
+	Media MediaLimits `json:"media"`
+	// the limits that depend on the user's plan
+	Plans []EntitlementsResponse `json:"plans"`
+}
+type ChirpLimits struct {
+	// what a character is, always 'grapheme_cluster'
+	CountingUnit string `json:"counting_unit"`
+	// characters each link counts as, however long it is
+	URLWeight int `json:"url_weight"`
+	// reports if the @mentions a reply starts with are left out of its length
+	ReplyMentionsExcluded bool `json:"reply_mentions_excluded"`
+}
+type MediaLimits struct {
+	MaxBytes     int64    `json:"max_bytes"`
+	MaxDimension int      `json:"max_dimension"`
+	ContentTypes []string `json:"content_types"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+func newLimitsResponse(mediaMaxBytes int64, plans []database.PlanEntitlement) LimitsResponse {
+	planResponses := make([]EntitlementsResponse, 0, len(plans))
+	for _, plan := range plans {
+		planResponses = append(planResponses, newEntitlementsResponse(plan))
+	}
+
+	return LimitsResponse{
+		Chirp: ChirpLimits{
+			CountingUnit:          "grapheme_cluster",
+			URLWeight:             chirpURLWeight,
+			ReplyMentionsExcluded: true,
+		},
+		Media: MediaLimits{
+			MaxBytes:     mediaMaxBytes,
+			MaxDimension: mediaMaxDimension,
+			ContentTypes: []string{media.TypeJPEG, media.TypePNG, media.TypeGIF},
+		},
+		Plans: planResponses,
+	}
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// the rules chirps are checked against, so clients can count characters the same way
+func (cfg *apiConfig) handlerGetLimits(w http.ResponseWriter, r *http.Request) {
+	plans, err := cfg.db.ListPlanEntitlements(r.Context())
+	if err != nil {
+		log.Printf("Error listing plan entitlements: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newLimitsResponse(cfg.mediaMaxBytes, plans))
+}
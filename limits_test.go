@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+func TestNewLimitsResponse(t *testing.T) {
+	plans := []database.PlanEntitlement{
+		{Plan: "chirpy_red", MaxChirpLength: 500, MaxMediaPerChirp: 8, CanEditChirps: true},
+		{Plan: "free", MaxChirpLength: 140, MaxMediaPerChirp: 4},
+	}
+
+	limits := newLimitsResponse(defaultMediaMaxBytes, plans)
+	if limits.Chirp.URLWeight != chirpURLWeight || limits.Chirp.CountingUnit != "grapheme_cluster" {
+		t.Errorf("Unexpected chirp limits: %+v", limits.Chirp)
+	}
+	if limits.Media.MaxBytes != defaultMediaMaxBytes || len(limits.Media.ContentTypes) != 3 {
+		t.Errorf("Unexpected media limits: %+v", limits.Media)
+	}
+	if len(limits.Plans) != 2 {
+		t.Fatalf("Expected: %d, Got: %d", 2, len(limits.Plans))
+	}
+	if limits.Plans[0].Plan != "chirpy_red" || limits.Plans[0].MaxChirpLength != 500 || !limits.Plans[0].CanEditChirps {
+		t.Errorf("Unexpected plan: %+v", limits.Plans[0])
+	}
+}
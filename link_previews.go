@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/database"
+	"github.com/nicholasss/chirpy/internal/jobs"
+	"github.com/nicholasss/chirpy/internal/linkpreview"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	// links after these in a chirp get no preview
+	maxLinksPerChirp = 3
+	// whole fetch, including redirects
+	linkPreviewTimeout = time.Duration(time.Second * 5)
+	// only the start of a page is read, the metadata is in its head
+	linkPreviewMaxBytes = 512 << 10
+	// a failed fetch is cached as failed rather than retried, only database errors are
+	linkPreviewMaxAttempts = 3
+	// previews are fetched again once they are this old
+	linkPreviewMaxAge = time.Duration(time.Hour * 24 * 7)
+	// failed fetches are not tried again for this long
+	linkPreviewRetryAfter = time.Duration(time.Hour * 24)
+
+	linkPreviewStatusOK     = "ok"
+	linkPreviewStatusFailed = "failed"
+)
+
+// =====
+// TYPES
+// =====
+
+// fetches the preview of a link in a new or edited chirp
+type linkPreviewJob struct {
+	URL string `json:"url"`
+}
+
+func (linkPreviewJob) Kind() string { return "link_previews.fetch" }
+
+type LinkPreviewResponse struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
+	SiteName    string `json:"site_name"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// reports if the cached preview can be used as it is
+func linkPreviewIsFresh(preview database.LinkPreview, now time.Time) bool {
+	maxAge := linkPreviewMaxAge
+	if preview.Status != linkPreviewStatusOK {
+		maxAge = linkPreviewRetryAfter
+	}
+
+	return now.Sub(preview.FetchedAt) < maxAge
+}
+
+// fetches the link's preview, unless the cached one is still fresh
+// a failed fetch is cached too, so a broken link is not fetched for every chirp
+func (cfg *apiConfig) refreshLinkPreview(ctx context.Context, url string) error {
+	cached, err := cfg.db.GetLinkPreviewByURL(ctx, url)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && linkPreviewIsFresh(cached, time.Now().UTC()) {
+		return nil
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, linkPreviewTimeout)
+	defer cancel()
+
+	preview, err := cfg.linkFetcher.Fetch(fetchCtx, url)
+	if err != nil {
+		log.Printf("Unable to fetch link preview for '%s': %s", url, err)
+		return cfg.db.UpsertLinkPreview(ctx, database.UpsertLinkPreviewParams{
+			Url:    url,
+			Status: linkPreviewStatusFailed,
+			Error:  sql.NullString{String: err.Error(), Valid: true},
+		})
+	}
+
+	log.Printf("Fetched link preview for '%s'.", url)
+	return cfg.db.UpsertLinkPreview(ctx, database.UpsertLinkPreviewParams{
+		Url:         url,
+		Status:      linkPreviewStatusOK,
+		Title:       preview.Title,
+		Description: preview.Description,
+		ImageUrl:    preview.ImageURL,
+		SiteName:    preview.SiteName,
+	})
+}
+
+// saves the links in the chirp's body, in order, and enqueues fetching their previews
+// nothing is fetched unless the transaction commits
+func saveChirpLinks(ctx context.Context, qtx *database.Queries, chirpID uuid.UUID, body string) error {
+	links := linkpreview.ExtractURLs(body, maxLinksPerChirp)
+	for i, link := range links {
+		err := qtx.CreateChirpLink(ctx, database.CreateChirpLinkParams{
+			ChirpID:  chirpID,
+			Position: int32(i),
+			Url:      link,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = jobs.Enqueue(ctx, qtx, linkPreviewJob{URL: link}, jobs.Options{MaxAttempts: linkPreviewMaxAttempts})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// the previews of each chirp's links, in the order the links appear
+// links without a preview yet, or whose fetch failed, are left out
+func (cfg *apiConfig) linkPreviewsByChirp(ctx context.Context, chirpIDs []uuid.UUID) (map[uuid.UUID][]LinkPreviewResponse, error) {
+	previews, err := cfg.db.ListLinkPreviewsByChirpIDs(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byChirp := make(map[uuid.UUID][]LinkPreviewResponse)
+	for _, preview := range previews {
+		byChirp[preview.ChirpID] = append(byChirp[preview.ChirpID], LinkPreviewResponse{
+			URL:         preview.Url,
+			Title:       preview.Title,
+			Description: preview.Description,
+			ImageURL:    preview.ImageUrl,
+			SiteName:    preview.SiteName,
+		})
+	}
+
+	return byChirp, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+func TestLinkPreviewIsFresh(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		status    string
+		fetchedAt time.Time
+		expected  bool
+	}{
+		{linkPreviewStatusOK, now.Add(-time.Hour), true},
+		{linkPreviewStatusOK, now.Add(-linkPreviewMaxAge - time.Minute), false},
+		// failed fetches are tried again sooner
+		{linkPreviewStatusFailed, now.Add(-time.Hour), true},
+		{linkPreviewStatusFailed, now.Add(-linkPreviewRetryAfter - time.Minute), false},
+	}
+
+	for _, test := range tests {
+		received := linkPreviewIsFresh(database.LinkPreview{Status: test.status, FetchedAt: test.fetchedAt}, now)
+		if received != test.expected {
+			t.Errorf("%s fetched at %s, Expected %t, received %t", test.status, test.fetchedAt, test.expected, received)
+		}
+	}
+}
@@ -1,23 +1,34 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
-	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/blobstore"
 	"github.com/nicholasss/chirpy/internal/database"
+	"github.com/nicholasss/chirpy/internal/linkpreview"
+	"github.com/nicholasss/chirpy/internal/mailer"
+	"github.com/nicholasss/chirpy/internal/outbound"
+	"github.com/rivo/uniseg"
 )
 
 // =========
@@ -25,8 +36,14 @@ import (
 // =========
 
 const (
-	port          = "8080"
-	maxChirpRunes = 140
+	port = "8080"
+	// how long in-flight requests get to finish once the server is asked to stop
+	serverShutdownTimeout = time.Duration(time.Second * 15)
+	// longest chirp on the free plan out of the box, in characters as a person would count them
+	// chirps are limited by their author's plan entitlements, this is only what the tests check against
+	maxChirpLength = 140
+	// every link counts as this many characters, however long it is
+	chirpURLWeight = 23
 )
 
 // ================
@@ -45,27 +62,62 @@ var adminMetricsPage = `<html>
 // words that need to be censored in the chirps
 var censoredWords = []string{"kerfuffle", "sharbert", "fornax"}
 
+// the @handles a reply starts with, which do not count towards its length
+var leadingMentionsPattern = regexp.MustCompile(`^(@[A-Za-z0-9_]{3,15}\s+)+`)
+
+// returned when a third-party access token lacks the scope an endpoint needs
+var errInsufficientScope = errors.New("access token does not carry the required scope")
+
+// returned when an access token belongs to an account that is pending deletion
+var errAccountPendingDeletion = errors.New("account is pending deletion")
+
+// returned when media ids cannot be attached to a new chirp
+var errMediaNotAttachable = errors.New("media is not the user's own upload, or is already attached to a chirp")
+
 // ============
 // GLOBAL TYPES
 // ============
 
+// tells if a user's account is pending deletion, *database.Queries outside of tests
+type pendingDeletionChecker interface {
+	IsUserPendingDeletion(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
 type apiConfig struct {
 	platform       string
 	fileserverHits atomic.Int32
+	dbConn         *sql.DB
 	db             *database.Queries
-	jwtSecret      string
+	// checked on every authenticated request, access tokens stay valid after an account is scheduled for deletion
+	pendingDeletions pendingDeletionChecker
+	jwtSecret        string
+	totpKey          []byte
+	mfaAttempts      *attemptLimiter
+	mailer           mailer.Mailer
+	publicBaseURL    string
+	passwordPolicy   auth.PasswordPolicy
+	deletionGrace    time.Duration
+	chirpRetention   time.Duration
+	adminAPIKey      string
+	// the payment providers webhooks are accepted from, by name
+	webhookProviders map[string]WebhookProvider
+	webhookSender    *outbound.Sender
+	blobs            blobstore.BlobStore
+	mediaMaxBytes    int64
+	linkFetcher      *linkpreview.Fetcher
 }
 
 // API types
 
 type UserLoginResponse struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
-	AccessToken  string    `json:"access_token"`
-	RefreshToken string    `json:"refresh_token"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	AccessToken   string    `json:"access_token"`
+	RefreshToken  string    `json:"refresh_token"`
 }
 type UserLoginRequest struct {
 	RawPassword string `json:"password"`
@@ -75,16 +127,6 @@ type UserCreateRequest struct {
 	RawPassword string `json:"password"`
 	Email       string `json:"email"`
 }
-type UserUpdateRequest struct {
-	RawPassword string `json:"password"`
-	Email       string `json:"email"`
-}
-type UserUpgradeRequest struct {
-	Event string `json:"event"`
-	Data  struct {
-		UserID uuid.UUID `json:"user_id"`
-	} `json:"data"`
-}
 
 // non-user
 
@@ -92,6 +134,26 @@ type AccessTokenResponse struct {
 	AccessToken string `json:"access_token"`
 }
 type Chirp struct {
+	Body      string      `json:"body"`
+	MediaIDs  []uuid.UUID `json:"media_ids"`
+	InReplyTo *uuid.UUID  `json:"in_reply_to"`
+	// schedules the chirp rather than posting it now, see ChirpScheduleRequest
+	PublishAt *string `json:"publish_at"`
+	TimeZone  string  `json:"time_zone"`
+}
+type ChirpResponse struct {
+	database.Chirp
+	// only on chirps that are scheduled and not yet published
+	PublishAt    *time.Time            `json:"publish_at,omitempty"`
+	TimeZone     string                `json:"time_zone,omitempty"`
+	Attachments  []MediaResponse       `json:"attachments"`
+	LinkPreviews []LinkPreviewResponse `json:"link_previews"`
+	// hides the embedded deleted_at, a deleted chirp is only ever shown as a ChirpTombstone
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// only when listing an author's chirps, on those they have pinned
+	Pinned bool `json:"pinned,omitempty"`
+}
+type ChirpUpdateRequest struct {
 	Body string `json:"body"`
 }
 type CleanedChirp struct {
@@ -101,24 +163,65 @@ type CleanedChirp struct {
 
 // Internal types
 
+// a chirp that has been checked and is ready to be saved
+type newChirp struct {
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	MediaIDs  []uuid.UUID
+	// a scheduled chirp is announced to subscribers once it is published
+	Scheduled bool
+}
+
+// what checking a chirp found, without rejecting it
+type chirpCheck struct {
+	cleanedBody string
+	length      int
+	maxLength   int
+	// the words that were censored, as they were written
+	censored []string
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 type ValidResponse struct {
 	Valid bool `json:"valid"`
 }
+type PasswordPolicyErrorResponse struct {
+	Error      string                 `json:"error"`
+	Violations []auth.PolicyViolation `json:"violations"`
+}
 
 // =================
 // UTILITY FUNCTIONS
 // =================
 
-// censors the following words: kerfuffle, sharbert, fornax
+// the length of a chirp as it counts against its limit
+// characters are grapheme clusters, so an emoji or an accented letter counts once,
+// every link counts as chirpURLWeight, and the mentions a reply starts with are free
+func chirpLength(text string, isReply bool) int {
+	if isReply {
+		text = text[len(leadingMentionsPattern.FindString(text)):]
+	}
+
+	length := 0
+	end := 0
+	for _, span := range linkpreview.FindURLs(text) {
+		length += uniseg.GraphemeClusterCount(text[end:span[0]]) + chirpURLWeight
+		end = span[1]
+	}
+
+	return length + uniseg.GraphemeClusterCount(text[end:])
+}
+
+// measures the chirp, and censors the following words: kerfuffle, sharbert, fornax
 // replaces them with **** (four asterisks)
-func validateChirp(text string) (string, error) {
-	chirpLen := utf8.RuneCountInString(text)
-	if chirpLen >= maxChirpRunes {
-		fmt.Printf("Chirp too long: %d, %d chars too many.\n", chirpLen, maxChirpRunes-chirpLen)
-		return "", fmt.Errorf("chirp is too long. %d chars too many", maxChirpRunes-chirpLen)
+// never rejects the chirp, drafts report what it found as warnings instead
+func checkChirp(text string, isReply bool, maxLength int) chirpCheck {
+	check := chirpCheck{
+		length:    chirpLength(text, isReply),
+		maxLength: maxLength,
 	}
 
 	cleanedWords := make([]string, 0)
@@ -128,13 +231,138 @@ func validateChirp(text string) (string, error) {
 		testWord := strings.ToLower(word)
 		if slices.Contains(censoredWords, testWord) {
 			cleanedWords = append(cleanedWords, "****")
+			check.censored = append(check.censored, word)
 			continue
 		}
 		cleanedWords = append(cleanedWords, word)
 	}
 
-	censoredString := strings.Join(cleanedWords, " ")
-	return censoredString, nil
+	check.cleanedBody = strings.Join(cleanedWords, " ")
+	return check
+}
+
+// checks the chirp's length, and censors the following words: kerfuffle, sharbert, fornax
+// replaces them with **** (four asterisks)
+func validateChirp(text string, isReply bool, maxLength int) (string, error) {
+	check := checkChirp(text, isReply, maxLength)
+	if check.length > maxLength {
+		fmt.Printf("Chirp too long: %d, %d chars too many.\n", check.length, check.length-maxLength)
+		return "", fmt.Errorf("chirp is too long. %d chars too many", check.length-maxLength)
+	}
+
+	return check.cleanedBody, nil
+}
+
+// saves the chirp with its links and attachments, and queues its webhooks, as part of the caller's transaction
+func saveNewChirp(ctx context.Context, qtx *database.Queries, chirp newChirp) (database.Chirp, error) {
+	chirpRecord, err := qtx.CreateChirp(ctx, database.CreateChirpParams{
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		InReplyTo: chirp.InReplyTo,
+	})
+	if err != nil {
+		return database.Chirp{}, fmt.Errorf("unable to create chirp: %w", err)
+	}
+
+	// a scheduled chirp's webhooks and links wait until it is published,
+	// fetching its links any earlier would let the sites know of it before then
+	if !chirp.Scheduled {
+		err = enqueueOutboundWebhook(ctx, qtx, chirp.UserID, outboundEventChirpCreated, newChirpWebhookData(chirpRecord))
+		if err != nil {
+			return database.Chirp{}, fmt.Errorf("unable to queue chirp webhooks: %w", err)
+		}
+
+		// previews are fetched once the chirp is saved
+		err = saveChirpLinks(ctx, qtx, chirpRecord.ID, chirpRecord.Body)
+		if err != nil {
+			return database.Chirp{}, fmt.Errorf("unable to save chirp links: %w", err)
+		}
+	}
+
+	if len(chirp.MediaIDs) > 0 {
+		// only the user's own uploads that are not already on a chirp can be attached
+		attached, err := qtx.AttachMediaToChirp(ctx, database.AttachMediaToChirpParams{
+			ChirpID: uuid.NullUUID{UUID: chirpRecord.ID, Valid: true},
+			Ids:     chirp.MediaIDs,
+			UserID:  chirp.UserID,
+		})
+		if err != nil {
+			return database.Chirp{}, fmt.Errorf("unable to attach media to chirp: %w", err)
+		}
+		if attached != int64(len(chirp.MediaIDs)) {
+			return database.Chirp{}, errMediaNotAttachable
+		}
+	}
+
+	return chirpRecord, nil
+}
+
+// reads ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM,
+// falling back to the defaults for any that are unset
+func argon2ParamsFromEnv() (auth.Argon2Params, error) {
+	params := auth.DefaultArgon2Params
+
+	for _, setting := range []struct {
+		key   string
+		value *uint32
+	}{
+		{"ARGON2_MEMORY_KIB", &params.Memory},
+		{"ARGON2_ITERATIONS", &params.Iterations},
+	} {
+		raw := os.Getenv(setting.key)
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return auth.Argon2Params{}, fmt.Errorf("%s: %w", setting.key, err)
+		}
+		*setting.value = uint32(parsed)
+	}
+
+	if raw := os.Getenv("ARGON2_PARALLELISM"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil {
+			return auth.Argon2Params{}, fmt.Errorf("ARGON2_PARALLELISM: %w", err)
+		}
+		params.Parallelism = uint8(parsed)
+	}
+
+	return params, nil
+}
+
+// reads PASSWORD_MIN_LENGTH, PASSWORD_MIN_ENTROPY and BREACHED_PASSWORDS_PATH,
+// falling back to the default policy for any that are unset
+func passwordPolicyFromEnv() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+
+	if raw := os.Getenv("PASSWORD_MIN_LENGTH"); raw != "" {
+		minLength, err := strconv.Atoi(raw)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("PASSWORD_MIN_LENGTH: %w", err)
+		}
+		policy.MinLength = minLength
+	}
+
+	if raw := os.Getenv("PASSWORD_MIN_ENTROPY"); raw != "" {
+		minEntropy, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("PASSWORD_MIN_ENTROPY: %w", err)
+		}
+		policy.MinEntropyBits = minEntropy
+	}
+
+	if path := os.Getenv("BREACHED_PASSWORDS_PATH"); path != "" {
+		corpus, err := auth.LoadBreachedCorpus(path)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("BREACHED_PASSWORDS_PATH: %w", err)
+		}
+		policy.Breached = corpus
+	} else {
+		log.Print("BREACHED_PASSWORDS_PATH is not set, breached password check is off.")
+	}
+
+	return policy, nil
 }
 
 func newErrorData(cause string) []byte {
@@ -168,6 +396,176 @@ func respondWithJSON(w http.ResponseWriter, code int, payload any) {
 	w.Write(payloadData)
 }
 
+// validates the access token (JWT) in the authorization header and returns its user id
+// tokens issued to third-party oauth clients must carry the required scope,
+// an empty scope means the endpoint is only available to first-party tokens
+func (cfg *apiConfig) authenticateRequest(r *http.Request, requiredScope string) (uuid.UUID, error) {
+	userID, _, err := cfg.authenticateRequestClient(r, requiredScope)
+	return userID, err
+}
+
+// like authenticateRequest, also returning the third-party client the token was issued to,
+// which is null for first-party tokens
+func (cfg *apiConfig) authenticateRequestClient(r *http.Request, requiredScope string) (uuid.UUID, uuid.NullUUID, error) {
+	accessToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, uuid.NullUUID{}, err
+	}
+
+	claims, err := auth.ValidateJWTClaims(accessToken, cfg.jwtSecret)
+	if err != nil {
+		return uuid.Nil, uuid.NullUUID{}, err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, uuid.NullUUID{}, err
+	}
+
+	clientID := uuid.NullUUID{}
+	if claims.ClientID != "" {
+		if requiredScope == "" || !slices.Contains(auth.ParseScope(claims.Scope), requiredScope) {
+			return uuid.Nil, uuid.NullUUID{}, errInsufficientScope
+		}
+		clientID.UUID, err = uuid.Parse(claims.ClientID)
+		if err != nil {
+			return uuid.Nil, uuid.NullUUID{}, err
+		}
+		clientID.Valid = true
+	}
+
+	// logging back in cancels the deletion, and issues new tokens
+	pending, err := cfg.pendingDeletions.IsUserPendingDeletion(r.Context(), userID)
+	if err != nil {
+		return uuid.Nil, uuid.NullUUID{}, err
+	}
+	if pending {
+		return uuid.Nil, uuid.NullUUID{}, errAccountPendingDeletion
+	}
+
+	return userID, clientID, nil
+}
+
+// generates an access token (JWT) and a refresh token for the user
+// and returns them with the user record
+func (cfg *apiConfig) issueLoginTokens(r *http.Request, userID uuid.UUID) (UserLoginResponse, error) {
+	// retrieve userRecord without password
+	safeUserRecord, err := cfg.db.GetUserByIDSafe(r.Context(), userID)
+	if err != nil {
+		return UserLoginResponse{}, err
+	}
+
+	cfg.cancelPendingDeletion(r.Context(), safeUserRecord.ID)
+
+	// generate jwt token for user with 1 hour accessTokenExpiry
+	durationHour := time.Duration(time.Hour * 1)
+	accessToken, err := auth.MakeJWT(safeUserRecord.ID, cfg.jwtSecret, durationHour)
+	if err != nil {
+		return UserLoginResponse{}, err
+	}
+
+	// generate refresh token for user
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return UserLoginResponse{}, err
+	}
+
+	// add refresh token to database which expires in 60 days
+	// only its hash is stored, like oauth refresh tokens
+	sixtyDayExpiry := time.Duration(time.Hour * 24 * 60)
+	refreshTokenExpiry := time.Now().UTC().Add(sixtyDayExpiry)
+	_, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		ID:        auth.HashToken(refreshToken),
+		UserID:    safeUserRecord.ID,
+		ExpiresAt: refreshTokenExpiry,
+	})
+	if err != nil {
+		return UserLoginResponse{}, err
+	}
+
+	return UserLoginResponse{
+		ID:            safeUserRecord.ID,
+		CreatedAt:     safeUserRecord.CreatedAt,
+		UpdatedAt:     safeUserRecord.UpdatedAt,
+		Email:         safeUserRecord.Email,
+		EmailVerified: safeUserRecord.EmailVerified,
+		IsChirpyRed:   safeUserRecord.IsChirpyRed,
+		AccessToken:   accessToken,
+		RefreshToken:  refreshToken,
+	}, nil
+}
+
+// checks the password against the password policy
+// if it fails, responds with a 422 listing every violated rule and returns false
+func (cfg *apiConfig) enforcePasswordPolicy(w http.ResponseWriter, rawPassword, email string) bool {
+	violations, err := cfg.passwordPolicy.Check(rawPassword, email)
+	if err != nil {
+		log.Printf("Unable to check password policy: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return false
+	}
+
+	if len(violations) > 0 {
+		log.Printf("Password rejected by %d policy rules.", len(violations))
+		respondWithJSON(w, http.StatusUnprocessableEntity, PasswordPolicyErrorResponse{
+			Error:      "Password does not meet the password policy.",
+			Violations: violations,
+		})
+		return false
+	}
+
+	return true
+}
+
+// replaces the user's stored hash with one using the current hashing parameters
+func (cfg *apiConfig) rehashPassword(ctx context.Context, userID uuid.UUID, rawPassword string) {
+	newHashedPassword, err := auth.HashPassword(rawPassword)
+	if err != nil {
+		log.Printf("Unable to rehash password for '%s': %s", userID, err)
+		return
+	}
+
+	err = cfg.db.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: newHashedPassword,
+	})
+	if err != nil {
+		log.Printf("Unable to store rehashed password for '%s': %s", userID, err)
+		return
+	}
+
+	log.Printf("Upgraded password hash for user '%s'.", userID)
+}
+
+// checks the admin api key (ADMIN_API_KEY) in the authorization header
+// admin endpoints that need the key are disabled when it is not set
+func (cfg *apiConfig) authenticateAdmin(r *http.Request) error {
+	if cfg.adminAPIKey == "" {
+		return errors.New("ADMIN_API_KEY is not set")
+	}
+
+	keyString, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(keyString), []byte(cfg.adminAPIKey)) != 1 {
+		return errors.New("invalid admin api key")
+	}
+
+	return nil
+}
+
+// responds with 403 for scope errors, otherwise 401
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInsufficientScope) {
+		respondWithError(w, http.StatusForbidden, "Insufficient scope.")
+		return
+	}
+
+	respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+}
+
 // ====================
 // MIDDLEWARE FUNCTIONS
 // ====================
@@ -217,19 +615,11 @@ func (cfg *apiConfig) handlerCreateChirps(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// get JWT from headers
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("Error getting request token: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
-		return
-	}
-
-	// validate token
-	userIDFromToken, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
+	// validate JWT from headers
+	userIDFromToken, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
 	if err != nil {
 		log.Printf("Error validating request token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		respondWithAuthError(w, err)
 		return
 	}
 
@@ -248,8 +638,56 @@ func (cfg *apiConfig) handlerCreateChirps(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// limits come from the user's plan
+	entitlements, err := cfg.db.GetEntitlementsByUserID(r.Context(), userRecord.ID)
+	if err != nil {
+		log.Printf("Error getting entitlements of user '%s': %s", userRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	// a chirp with a publish_at is scheduled, and stays hidden until then
+	scheduled := createChirpRequest.PublishAt != nil
+	var publishAt time.Time
+	var timeZone sql.NullString
+	if !scheduled && createChirpRequest.TimeZone != "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid time_zone: only used with publish_at.")
+		return
+	}
+	if scheduled {
+		if !entitlements.CanScheduleChirps {
+			respondWithError(w, http.StatusForbidden, "Scheduling chirps is not included in your plan.")
+			return
+		}
+
+		publishAt, timeZone, err = parseChirpSchedule(ChirpScheduleRequest{
+			PublishAt: *createChirpRequest.PublishAt,
+			TimeZone:  createChirpRequest.TimeZone,
+		}, time.Now().UTC())
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid publish_at: "+err.Error()+".")
+			return
+		}
+	}
+
+	// a reply must be to a chirp that can be seen
+	inReplyTo := uuid.NullUUID{}
+	if createChirpRequest.InReplyTo != nil {
+		parentRecord, err := cfg.db.GetChirpByID(r.Context(), *createChirpRequest.InReplyTo)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid in_reply_to: chirp not found.")
+			return
+		}
+		if err != nil {
+			log.Printf("Error getting chirp replied to: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parentRecord.ID, Valid: true}
+	}
+
 	// validate the body and censor words
-	validBody, err := validateChirp(createChirpRequest.Body)
+	validBody, err := validateChirp(createChirpRequest.Body, inReplyTo.Valid, int(entitlements.MaxChirpLength))
 	if err != nil {
 		log.Printf("Chirp is too long. %s\n", err)
 		respondWithError(w, http.StatusBadRequest, "Chirp is too long.")
@@ -257,20 +695,95 @@ func (cfg *apiConfig) handlerCreateChirps(w http.ResponseWriter, r *http.Request
 	}
 	createChirpRequest.Body = validBody
 
-	// insert into database
-	chirpRecord, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   createChirpRequest.Body,
-		UserID: userRecord.ID,
+	mediaIDs, err := parseMediaIDs(createChirpRequest.MediaIDs, int(entitlements.MaxMediaPerChirp))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid media_ids: "+err.Error()+".")
+		return
+	}
+
+	// the chirp and its attachments are saved together, and counted towards the rate limit with them
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	allowed, err := canPostChirp(r.Context(), qtx, userRecord.ID, entitlements)
+	if err != nil {
+		log.Printf("Error counting recent chirps of user '%s': %s", userRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusTooManyRequests, "Too many chirps, please try again later.")
+		return
+	}
+
+	// the user's row is locked by now, so the scheduled chirps are counted one request at a time
+	if scheduled {
+		pending, err := qtx.CountChirpSchedulesByUserID(r.Context(), userRecord.ID)
+		if err != nil {
+			log.Printf("Error counting scheduled chirps of user '%s': %s", userRecord.ID, err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		if pending >= maxScheduledChirpsPerUser {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("You can have at most %d scheduled chirps.", maxScheduledChirpsPerUser))
+			return
+		}
+	}
+
+	chirpRecord, err := saveNewChirp(r.Context(), qtx, newChirp{
+		Body:      createChirpRequest.Body,
+		UserID:    userRecord.ID,
+		InReplyTo: inReplyTo,
+		MediaIDs:  mediaIDs,
+		Scheduled: scheduled,
 	})
+	if errors.Is(err, errMediaNotAttachable) {
+		respondWithError(w, http.StatusBadRequest, "Invalid media_ids: each must be your own upload, not yet attached to a chirp.")
+		return
+	}
 	if err != nil {
-		log.Printf("Chirp table error: %s", err)
+		log.Printf("Unable to save chirp: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
 		return
 	}
 
+	// subscribers hear of a scheduled chirp once it is published
+	var schedule database.ChirpSchedule
+	if scheduled {
+		schedule, err = scheduleChirp(r.Context(), qtx, chirpRecord.ID, publishAt, timeZone)
+		if err != nil {
+			log.Printf("Unable to schedule chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Unable to commit chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	chirpResponses, err := cfg.newChirpResponses(r.Context(), []database.Chirp{chirpRecord})
+	if err != nil {
+		log.Printf("Unable to get chirp attachments: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if scheduled {
+		setChirpSchedule(&chirpResponses[0], schedule)
+	}
+
 	// respond with a 201 (status created) and the full record
 	log.Print("Processed create chirp successfuly.")
-	respondWithJSON(w, http.StatusCreated, chirpRecord)
+	respondWithJSON(w, http.StatusCreated, chirpResponses[0])
 }
 
 // optional query param of 'author_id' will return only that authors chirps
@@ -292,8 +805,15 @@ func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request
 			return
 		}
 
+		chirpResponses, err := cfg.newChirpResponses(r.Context(), chirpRecords)
+		if err != nil {
+			log.Printf("Error getting chirp attachments: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+
 		log.Print("Providing response with all chirps.")
-		respondWithJSON(w, http.StatusOK, chirpRecords)
+		respondWithJSON(w, http.StatusOK, chirpResponses)
 	} else {
 		// looking for specific author
 		chirpRecords, err := cfg.db.GetAllChirpsByAuthorID(r.Context(), authorToSearch)
@@ -303,8 +823,23 @@ func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request
 			return
 		}
 
+		chirpResponses, err := cfg.newChirpResponses(r.Context(), chirpRecords)
+		if err != nil {
+			log.Printf("Error getting chirp attachments: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+
+		pins, err := cfg.db.ListChirpPinsByUserID(r.Context(), authorToSearch)
+		if err != nil {
+			log.Printf("Error listing pinned chirps of author '%s': %s", authorToSearch, err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		markPinnedChirps(chirpResponses, pins)
+
 		log.Printf("Providing response with all chirps by author: %s", authorToSearch)
-		respondWithJSON(w, http.StatusOK, chirpRecords)
+		respondWithJSON(w, http.StatusOK, chirpResponses)
 	}
 }
 
@@ -323,22 +858,138 @@ func (cfg *apiConfig) handlerGetChirpByID(w http.ResponseWriter, r *http.Request
 		return // needs to return after error?
 	}
 
+	chirpResponses, err := cfg.newChirpResponses(r.Context(), []database.Chirp{chirpRecord})
+	if err != nil {
+		log.Printf("Error getting chirp attachments: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
 	log.Printf("Providing response with chirp id: %s", chirpID.String())
-	respondWithJSON(w, http.StatusOK, chirpRecord)
+	respondWithJSON(w, http.StatusOK, chirpResponses[0])
 }
 
-// delete a chirp by id with authentication and authorization
-func (cfg *apiConfig) handlerDeleteChirpByID(w http.ResponseWriter, r *http.Request) {
-	accessToken, err := auth.GetBearerToken(r.Header)
+// edits the body of a chirp, for authors whose plan allows it
+// the links are found again, attachments and replies are kept as they are
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("id"))
 	if err != nil {
-		log.Printf("Error getting request token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		respondWithError(w, http.StatusNotFound, "Chirp not found.")
+		return
+	}
+
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	var updateRequest ChirpUpdateRequest
+	err = json.NewDecoder(r.Body).Decode(&updateRequest)
+	if err != nil {
+		log.Printf("Error decoding update chirp request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	chirpRecord, err := cfg.db.GetChirpByID(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting chirp '%s': %s", chirpID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if chirpRecord.UserID != tokenUUID {
+		log.Printf("User '%s' attempted to edit chirp '%s' of another user.", tokenUUID, chirpID)
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	entitlements, err := cfg.db.GetEntitlementsByUserID(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error getting entitlements of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if !entitlements.CanEditChirps {
+		respondWithError(w, http.StatusForbidden, "Editing chirps is not included in your plan.")
 		return
 	}
-	tokenUUID, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
+
+	validBody, err := validateChirp(updateRequest.Body, chirpRecord.InReplyTo.Valid, int(entitlements.MaxChirpLength))
+	if err != nil {
+		log.Printf("Chirp is too long. %s\n", err)
+		respondWithError(w, http.StatusBadRequest, "Chirp is too long.")
+		return
+	}
+
+	// the body and its links change together
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// a chirp deleted since it was read above is not brought back by editing it
+	chirpRecord, err = qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   chirpID,
+		Body: validBody,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to update chirp '%s': %s", chirpID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = qtx.DeleteChirpLinksByChirpID(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("Unable to delete links of chirp '%s': %s", chirpID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = saveChirpLinks(r.Context(), qtx, chirpID, chirpRecord.Body)
+	if err != nil {
+		log.Printf("Unable to save chirp link: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Unable to commit chirp update: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	chirpResponses, err := cfg.newChirpResponses(r.Context(), []database.Chirp{chirpRecord})
+	if err != nil {
+		log.Printf("Error getting chirp attachments: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("Updated chirp '%s'.", chirpID)
+	respondWithJSON(w, http.StatusOK, chirpResponses[0])
+}
+
+// delete a chirp by id with authentication and authorization
+func (cfg *apiConfig) handlerDeleteChirpByID(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
 	if err != nil {
 		log.Printf("Error validating UUID from token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		respondWithAuthError(w, err)
 		return
 	}
 	// requestor has a valid JWT
@@ -363,13 +1014,53 @@ func (cfg *apiConfig) handlerDeleteChirpByID(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// the chirp is deleted and its webhooks queued together
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
 	// user has been authenticated and is authorized to delete chirp
-	err = cfg.db.DeleteChirpByID(r.Context(), chirpRecord.ID)
+	// the row is kept as a tombstone, so replies still point at it, until it is purged
+	deleted, err := qtx.SoftDeleteChirpByID(r.Context(), chirpRecord.ID)
 	if err != nil {
 		log.Printf("Unable to delete chirp by id '%s'. Error: %s", chirpRecord.ID, err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
 		return
 	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Chirp not found.")
+		return
+	}
+
+	// a deleted chirp is no longer pinned, even if it is restored
+	err = qtx.DeleteChirpPinByChirpID(r.Context(), chirpRecord.ID)
+	if err != nil {
+		log.Printf("Unable to unpin chirp '%s': %s", chirpRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = enqueueOutboundWebhook(r.Context(), qtx, chirpRecord.UserID, outboundEventChirpDeleted, ChirpDeletedWebhookData{
+		ID:     chirpRecord.ID,
+		UserID: chirpRecord.UserID,
+	})
+	if err != nil {
+		log.Printf("Unable to queue chirp webhooks: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Unable to commit chirp deletion: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
 
 	// chirp was deleted and user was authorized
 	log.Printf("Chirp ID '%s' was successfully deleted by '%s'", chirpRecord.ID, tokenUUID)
@@ -387,13 +1078,21 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check refreshToken in the db
-	refreshTokenRecord, err := cfg.db.GetUserFromRefreshToken(r.Context(), refreshToken)
+	refreshTokenRecord, err := cfg.db.GetUserFromRefreshToken(r.Context(), auth.HashToken(refreshToken))
 	if err != nil {
 		log.Printf("Could not find refresh token in database: %s", err)
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
+	// oauth refresh tokens must go through POST /api/oauth/token,
+	// otherwise a scoped grant could be traded for an unscoped token
+	if refreshTokenRecord.ClientID.Valid {
+		log.Printf("OAuth refresh token sent to POST /api/refresh.")
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
 	refreshTokenUserID := refreshTokenRecord.UserID
 	refreshTokenExpiry := refreshTokenRecord.ExpiresAt
 	refreshTokenRevocation := refreshTokenRecord.RevokedAt
@@ -450,7 +1149,7 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check refresh token table
-	err = cfg.db.RevokeRefreshTokenWithToken(r.Context(), refreshToken)
+	err = cfg.db.RevokeRefreshTokenWithToken(r.Context(), auth.HashToken(refreshToken))
 	if err != nil {
 		log.Printf("Database does not contain submitted refresh token: %s", err)
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
@@ -483,110 +1182,60 @@ func (cfg *apiConfig) handlerLoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = auth.CheckPasswordHash(loginUserRecord.RawPassword, unsafeUserRecord.HashedPassword)
+	needsRehash, err := auth.CheckPasswordHash(loginUserRecord.RawPassword, unsafeUserRecord.HashedPassword)
 	if err != nil {
 		log.Printf("User login with wrong password attempted for '%s'", loginUserRecord.Email)
 		respondWithError(w, http.StatusUnauthorized, "Wrong email or password.")
 		return
 	}
+
+	// upgrade bcrypt or outdated argon2id hashes while we have the raw password
+	// a failure here should not block the login
+	if needsRehash {
+		cfg.rehashPassword(r.Context(), unsafeUserRecord.ID, loginUserRecord.RawPassword)
+	}
+
 	// set raw password to zeroval, now that we have verified it
 	loginUserRecord.RawPassword = ""
 
-	// retrieve userRecord without password
-	safeUserRecord, err := cfg.db.GetUserByEmailSafe(r.Context(), loginUserRecord.Email)
-	if err != nil {
-		log.Printf("Error getting user record by email: %s", err)
+	// users with two-factor authentication get a challenge instead of tokens
+	// tokens are issued by POST /api/login/mfa once a valid code is submitted
+	totpRecord, err := cfg.db.GetTOTPSecretByUserID(r.Context(), unsafeUserRecord.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting totp record: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
 		return
 	}
+	if err == nil && totpRecord.ConfirmedAt.Valid {
+		mfaToken, err := auth.MakeMFAChallengeJWT(unsafeUserRecord.ID, cfg.jwtSecret, mfaChallengeExpiry)
+		if err != nil {
+			log.Printf("Error making mfa challenge token: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
 
-	// generate jwt token for user with 1 hour accessTokenExpiry
-	durationHour := time.Duration(time.Hour * 1)
-	accessToken, err := auth.MakeJWT(safeUserRecord.ID, cfg.jwtSecret, durationHour)
-	if err != nil {
-		log.Printf("Error making JWT: %s", err)
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		log.Printf("User '%s' passed the password step, awaiting mfa code.", unsafeUserRecord.Email)
+		respondWithJSON(w, http.StatusOK, MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		})
 		return
 	}
 
-	// generate refresh token for user
-	refreshToken, err := auth.MakeRefreshToken()
+	loginResponseRecord, err := cfg.issueLoginTokens(r, unsafeUserRecord.ID)
 	if err != nil {
-		log.Printf("Error making refresh token: %s", err)
+		log.Printf("Error issuing login tokens: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
 		return
 	}
 
-	// add refresh token to database which expires in 60 days
-	sixtyDayExpiry := time.Duration(time.Hour * 24 * 60)
-	refreshTokenExpiry := time.Now().UTC().Add(sixtyDayExpiry)
-	cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		ID:        refreshToken,
-		UserID:    safeUserRecord.ID,
-		ExpiresAt: refreshTokenExpiry,
-	})
+	cfg.recordLogin(r, loginResponseRecord.ID, loginMethodPassword)
 
 	// send response and log it
-	loginResponseRecord := UserLoginResponse{
-		ID:           safeUserRecord.ID,
-		CreatedAt:    safeUserRecord.CreatedAt,
-		UpdatedAt:    safeUserRecord.UpdatedAt,
-		Email:        safeUserRecord.Email,
-		IsChirpyRed:  safeUserRecord.IsChirpyRed,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	}
-	log.Printf("User '%s' logged in successfuly.", safeUserRecord.Email)
+	log.Printf("User '%s' logged in successfuly.", loginResponseRecord.Email)
 	respondWithJSON(w, http.StatusOK, loginResponseRecord)
 }
 
-func (cfg *apiConfig) handlerUpgradeUser(w http.ResponseWriter, r *http.Request) {
-	var userUpgradeRequest UserUpgradeRequest
-	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&userUpgradeRequest)
-	if err != nil {
-		log.Printf("Error decoding create user request: %s", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	// check for api key
-	keyString, err := auth.GetAPIKey(r.Header)
-	if err != nil {
-		log.Printf("Error finding API key in webhook request: %s", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	// check api key
-	envAPIKey := os.Getenv("POLKA_KEY")
-	if keyString != envAPIKey {
-		log.Printf("webhook request used invalid API Key: %s", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-	// api key is valid
-
-	// check for user.upgraded event
-	eventType := userUpgradeRequest.Event
-	if eventType != "user.upgraded" {
-		log.Print("recieved event of non-user.upgraded type")
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-	// event is user.upgraded
-
-	userID := userUpgradeRequest.Data.UserID
-	err = cfg.db.UpgradeUserByID(r.Context(), userID)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	log.Printf("User id: '%s' was upgraded", userID)
-	w.WriteHeader(http.StatusNoContent)
-}
-
 // creates users with a specified email
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
 	var createUserRequest UserCreateRequest
@@ -605,6 +1254,10 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !cfg.enforcePasswordPolicy(w, createUserRequest.RawPassword, createUserRequest.Email) {
+		return
+	}
+
 	hashedPassword, err := auth.HashPassword(createUserRequest.RawPassword)
 	if err != nil {
 		log.Printf("Error hashing provided password: %s", err)
@@ -624,82 +1277,30 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// failing to send the email should not fail sign up,
+	// the user can ask for another with POST /api/email/verify/resend
+	err = cfg.sendVerificationEmail(r.Context(), userRecord.ID, userRecord.Email)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+
 	// response to creating account
 	// need to POST /api/login for access token and refresh token
 	safeUserRecord := UserLoginResponse{
-		ID:           userRecord.ID,
-		CreatedAt:    userRecord.CreatedAt,
-		UpdatedAt:    userRecord.UpdatedAt,
-		Email:        userRecord.Email,
-		IsChirpyRed:  userRecord.IsChirpyRed,
-		AccessToken:  "",
-		RefreshToken: "",
+		ID:            userRecord.ID,
+		CreatedAt:     userRecord.CreatedAt,
+		UpdatedAt:     userRecord.UpdatedAt,
+		Email:         userRecord.Email,
+		EmailVerified: userRecord.EmailVerified,
+		IsChirpyRed:   userRecord.IsChirpyRed,
+		AccessToken:   "",
+		RefreshToken:  "",
 	}
 
 	log.Printf("New user created with '%s'.", userRecord.Email)
 	respondWithJSON(w, http.StatusCreated, safeUserRecord)
 }
 
-// updates users email or password using credential
-func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
-	// check access token
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("No authentication token was presented: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-	tokenUUID, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
-	if err != nil {
-		log.Printf("Unable to validate presented token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-
-	// decoding body json to struct
-	userUpdateRequest := UserUpdateRequest{}
-	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&userUpdateRequest)
-	if err != nil {
-		log.Printf("Unable to decode body to json: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-
-	safeUserRecord, err := cfg.db.GetUserByIDSafe(r.Context(), tokenUUID)
-	if err != nil {
-		// token is valid with the user ID not in database is an issue
-		log.Printf("!!! potential bug, check PUT /api/users")
-		log.Printf("Unable to find email in user database: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-
-	// hash password for storage
-	newHashedPassword, err := auth.HashPassword(userUpdateRequest.RawPassword)
-	if err != nil {
-		log.Printf("Unable to hash presented new password")
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-	newEmail := userUpdateRequest.Email
-
-	updatedSafeUserRecord, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             safeUserRecord.ID,
-		Email:          newEmail,
-		HashedPassword: newHashedPassword,
-	})
-	if err != nil {
-		log.Printf("Unable to complete user update for id '%s'", safeUserRecord.ID.String())
-		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
-		return
-	}
-
-	// updated successfuly
-	log.Printf("Updated user id '%s' successfuly with new email and password", safeUserRecord.ID.String())
-	respondWithJSON(w, http.StatusOK, updatedSafeUserRecord)
-}
-
 func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -785,44 +1386,216 @@ func main() {
 		log.Fatal("Unable to load JWT token. Proceding would be insecure.")
 	}
 
+	// key for encrypting totp secrets at rest
+	// 32 bytes, hex encoded
+	totpKey, err := auth.ParseEncryptionKey(os.Getenv("TOTP_ENCRYPTION_KEY"))
+	if err != nil {
+		log.Fatalf("Unable to load TOTP encryption key: %s", err)
+	}
+
+	// argon2id password hashing cost, optional
+	argon2Params, err := argon2ParamsFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to load argon2 parameters: %s", err)
+	}
+	err = auth.SetArgon2Params(argon2Params)
+	if err != nil {
+		log.Fatalf("Invalid argon2 parameters: %s", err)
+	}
+
+	passwordPolicy, err := passwordPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to load password policy: %s", err)
+	}
+
+	// outgoing email
+	mailSender, err := newMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to set up mailer: %s", err)
+	}
+
+	deletionGracePeriod, err := deletionGracePeriodFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to load account deletion grace period: %s", err)
+	}
+
+	deletedChirpRetention, err := deletedChirpRetentionFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to load deleted chirp retention: %s", err)
+	}
+
+	// where uploaded media is stored
+	blobStore, err := blobStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to set up blob store: %s", err)
+	}
+
+	mediaMaxBytes, err := mediaMaxBytesFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to load media size limit: %s", err)
+	}
+
+	// base url used for links in emails
+	publicBaseURL := os.Getenv("PUBLIC_BASE_URL")
+	if publicBaseURL == "" {
+		publicBaseURL = defaultPublicBaseURL
+	}
+
+	// the payment providers chirpy red subscription webhooks are accepted from
+	webhookProviders := newWebhookProviders(
+		polkaProvider{key: os.Getenv("POLKA_KEY"), secrets: webhookSecretsFromEnv("POLKA_WEBHOOK_SECRETS")},
+		kiwiProvider{secrets: webhookSecretsFromEnv("KIWI_WEBHOOK_SECRETS")},
+	)
+
 	apiCfg := &apiConfig{
-		platform:       platform,
-		fileserverHits: atomic.Int32{},
-		db:             dbQueries,
-		jwtSecret:      JWTSecret,
+		platform:         platform,
+		fileserverHits:   atomic.Int32{},
+		dbConn:           db,
+		db:               dbQueries,
+		pendingDeletions: dbQueries,
+		jwtSecret:        JWTSecret,
+		totpKey:          totpKey,
+		mfaAttempts:      newAttemptLimiter(mfaMaxAttempts, mfaChallengeExpiry),
+		mailer:           mailSender,
+		publicBaseURL:    strings.TrimSuffix(publicBaseURL, "/"),
+		passwordPolicy:   passwordPolicy,
+		deletionGrace:    deletionGracePeriod,
+		chirpRetention:   deletedChirpRetention,
+		adminAPIKey:      os.Getenv("ADMIN_API_KEY"),
+		webhookProviders: webhookProviders,
+		webhookSender:    outbound.NewSender(webhookDeliveryTimeout),
+		blobs:            blobStore,
+		mediaMaxBytes:    mediaMaxBytes,
+		linkFetcher:      linkpreview.NewFetcher(linkPreviewTimeout, linkPreviewMaxBytes),
 	}
 
+	// runs the jobs handlers enqueue: emails, data exports, thumbnails, link previews and scheduled chirps
+	// and the periodic ones: account cleanup, subscription expiry and outbound webhook deliveries
+	jobRunner := apiCfg.newJobRunner()
+	jobRunner.Start(context.Background())
+
 	mux := http.NewServeMux()
 
 	// generic endpoints
 	mux.Handle("/app/", apiCfg.mwLog(apiCfg.mwMetricsInc(handlerFS("/app/"))))
 	mux.Handle("GET /api/healthz", apiCfg.mwLog(http.HandlerFunc(handlerReady)))
+	mux.Handle("GET /api/config/limits", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetLimits)))
+	mux.Handle("GET /media/", apiCfg.mwLog(apiCfg.handlerMedia("/media/", apiCfg.db)))
 
 	// users endpoints
 	mux.Handle("POST /api/users", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerCreateUser)))
-	mux.Handle("PUT /api/users", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerUpdateUser)))
+	mux.Handle("PATCH /api/users/me", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerPatchUser)))
+	mux.Handle("DELETE /api/users/me", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerDeleteUser)))
+
+	// public profiles
+	mux.Handle("GET /api/users/me/entitlements", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetEntitlements)))
+	mux.Handle("GET /api/users/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetUserProfile)))
+	mux.Handle("GET /api/users/{id}/pinned", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetPinnedChirps)))
+	mux.Handle("PUT /api/users/me/pinned", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerSetPinnedChirps)))
+	mux.Handle("GET /api/users/by-handle/{handle}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetUserProfileByHandle)))
+	mux.Handle("PATCH /api/users/me/profile", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerUpdateProfile)))
+
+	// outbound webhooks
+	mux.Handle("POST /api/users/me/webhooks", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerCreateWebhookSubscription)))
+	mux.Handle("GET /api/users/me/webhooks", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerListWebhookSubscriptions)))
+	mux.Handle("DELETE /api/users/me/webhooks/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerDeleteWebhookSubscription)))
+	mux.Handle("GET /api/users/me/webhooks/{id}/deliveries", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerListWebhookDeliveries)))
+	mux.Handle("POST /api/users/me/webhooks/{id}/deliveries/{delivery_id}/redeliver", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerRedeliverWebhook)))
+
+	// personal data export
+	mux.Handle("POST /api/users/me/export", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerCreateDataExport)))
+	mux.Handle("GET /api/users/me/export/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetDataExport)))
+	mux.Handle("GET /api/exports/{id}/download", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerDownloadDataExport)))
 	mux.Handle("POST /api/login", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerLoginUser)))
-	mux.Handle("POST /api/polka/webhooks", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerUpgradeUser)))
+	mux.Handle("POST /api/login/mfa", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerLoginMFA)))
+	mux.Handle("POST /api/webhooks/{provider}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerWebhook)))
+	mux.Handle("POST /api/polka/webhooks", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerPolkaWebhook)))
+
+	// email verification and password reset
+	mux.Handle("POST /api/email/verify", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerVerifyEmail)))
+	mux.Handle("POST /api/email/verify/resend", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerResendVerification)))
+	mux.Handle("POST /api/password/forgot", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerForgotPassword)))
+	mux.Handle("POST /api/password/reset", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerResetPassword)))
+
+	// two-factor authentication
+	mux.Handle("POST /api/users/me/totp", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerEnrollTOTP)))
+	mux.Handle("POST /api/users/me/totp/confirm", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerConfirmTOTP)))
+	mux.Handle("DELETE /api/users/me/totp", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerDisableTOTP)))
 
 	// refresh token specific
 	mux.Handle("POST /api/refresh", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerRefresh)))
 	mux.Handle("POST /api/revoke", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerRevoke)))
 
+	// oauth endpoints
+	mux.Handle("POST /api/oauth/clients", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerCreateOAuthClient)))
+	mux.Handle("GET /api/oauth/authorize", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerOAuthAuthorize)))
+	mux.Handle("POST /api/oauth/authorize", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerOAuthConsent)))
+	mux.Handle("POST /api/oauth/token", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerOAuthToken)))
+	mux.Handle("POST /api/oauth/revoke", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerOAuthRevoke)))
+	mux.Handle("POST /api/oauth/introspect", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerOAuthIntrospect)))
+
 	// chirp endpoints
 	mux.Handle("POST /api/chirps", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerCreateChirps)))
 	mux.Handle("GET /api/chirps", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetAllChirps)))
 	mux.Handle("GET /api/chirps/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetChirpByID)))
+	mux.Handle("GET /api/chirps/{id}/thread", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetChirpThread)))
+	mux.Handle("GET /api/chirps/scheduled", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerListScheduledChirps)))
+	mux.Handle("PATCH /api/chirps/scheduled/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerRescheduleChirp)))
+	mux.Handle("DELETE /api/chirps/scheduled/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerCancelScheduledChirp)))
+	mux.Handle("PUT /api/chirps/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerUpdateChirp)))
 	mux.Handle("DELETE /api/chirps/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerDeleteChirpByID)))
+	mux.Handle("POST /api/drafts", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerCreateDraft)))
+	mux.Handle("GET /api/drafts", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerListDrafts)))
+	mux.Handle("GET /api/drafts/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetDraft)))
+	mux.Handle("PUT /api/drafts/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerUpdateDraft)))
+	mux.Handle("DELETE /api/drafts/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerDeleteDraft)))
+	mux.Handle("POST /api/drafts/{id}/publish", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerPublishDraft)))
+	mux.Handle("POST /api/media", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerUploadMedia)))
+	mux.Handle("GET /api/media/{id}", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerGetMedia)))
 
 	// Admin endpoints
 	mux.Handle("GET /admin/metrics", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerMetrics)))
 	mux.Handle("POST /admin/reset", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerReset)))
+	mux.Handle("POST /admin/chirps/import", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerImportChirps)))
+	mux.Handle("POST /admin/chirps/{id}/restore", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerRestoreChirp)))
+	mux.Handle("GET /admin/webhooks/events", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerListWebhookEvents)))
+	mux.Handle("POST /admin/webhooks/events/{provider}/{id}/replay", apiCfg.mwLog(http.HandlerFunc(apiCfg.handlerReplayWebhookEvent)))
 
 	server := http.Server{
 		Addr:    ":" + port,
 		Handler: mux,
 	}
 
-	log.Printf("Listening and Serving on port: '%s'\n", port)
-	log.Fatal(server.ListenAndServe()) // server can return error
+	// stops on ctrl-c, or when the host asks the process to stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Listening and Serving on port: '%s'\n", port)
+		err := server.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err) // server can return error
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Printf("Shutting down.")
+
+	// requests first, as they may still enqueue jobs
+	serverCtx, cancelServer := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancelServer()
+	err = server.Shutdown(serverCtx)
+	if err != nil {
+		log.Printf("Unable to finish every request: %s", err)
+	}
+
+	jobsCtx, cancelJobs := context.WithTimeout(context.Background(), jobShutdownTimeout)
+	defer cancelJobs()
+	err = jobRunner.Shutdown(jobsCtx)
+	if err != nil {
+		log.Printf("Unable to finish every running job, they will be retried: %s", err)
+	}
+
+	log.Printf("Shut down.")
 }
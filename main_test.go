@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
 )
 
 // TestMain build up and tear down
@@ -46,6 +51,13 @@ func readResponse(r *httptest.ResponseRecorder, t *testing.T) (string, int) {
 	return responseBody, responseCode
 }
 
+// the users in the map are pending deletion, any other user is not
+type fakePendingDeletions map[uuid.UUID]bool
+
+func (f fakePendingDeletions) IsUserPendingDeletion(ctx context.Context, id uuid.UUID) (bool, error) {
+	return f[id], nil
+}
+
 // Function Testing
 
 func TestCensorString(t *testing.T) {
@@ -62,7 +74,7 @@ func TestCensorString(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		actual, err := validateChirp(test.input)
+		actual, err := validateChirp(test.input, false, maxChirpLength)
 		if err != nil {
 			t.Errorf("Body was too long: %s", err)
 		}
@@ -72,6 +84,55 @@ func TestCensorString(t *testing.T) {
 	}
 }
 
+func TestChirpLength(t *testing.T) {
+	var tests = []struct {
+		input    string
+		isReply  bool
+		expected int
+	}{
+		{"hello", false, 5},
+		{strings.Repeat("a", 140), false, 140},
+		{"see https://example.com/a/very/long/path/indeed?with=query.", false, 4 + chirpURLWeight + 1},
+		{"https://a.com https://a.com", false, 2*chirpURLWeight + 1},
+		{"café", false, 4},
+		{"cafe\u0301", false, 4},
+		{"👍🏽 🇳🇿 👨‍👩‍👧", false, 5},
+		{"@alice @bob_2 thanks!", true, 7},
+		{"@alice @bob_2 thanks!", false, 21},
+		{"thanks @alice", true, 13},
+		{"@alice", true, 6},
+	}
+
+	for _, test := range tests {
+		actual := chirpLength(test.input, test.isReply)
+		if actual != test.expected {
+			t.Errorf("'%s': Expected: %d, Got: %d", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestValidateChirpLength(t *testing.T) {
+	var tests = []struct {
+		input     string
+		isReply   bool
+		expectErr bool
+	}{
+		{strings.Repeat("a", maxChirpLength), false, false},
+		{strings.Repeat("a", maxChirpLength+1), false, true},
+		{strings.Repeat("é", maxChirpLength), false, false},
+		{"https://example.com/" + strings.Repeat("a", 200), false, false},
+		{"@alice " + strings.Repeat("a", maxChirpLength), true, false},
+		{"@alice " + strings.Repeat("a", maxChirpLength), false, true},
+	}
+
+	for _, test := range tests {
+		_, err := validateChirp(test.input, test.isReply, maxChirpLength)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Expected error: %t, received: %v", test.expectErr, err)
+		}
+	}
+}
+
 func TestNewErrorData(t *testing.T) {
 	var tests = []struct {
 		input    string
@@ -378,3 +439,47 @@ func TestHandlerMetrics(t *testing.T) {
 // 		}
 // 	}
 // }
+
+func TestEnforcePasswordPolicy(t *testing.T) {
+	cfg := apiConfig{passwordPolicy: auth.DefaultPasswordPolicy}
+
+	var tests = []struct {
+		inputPassword string
+		expectedOK    bool
+		expectedCode  int
+		expectedMsg   string
+	}{
+		{
+			"Strong32Passw264!-=d",
+			true,
+			http.StatusOK,
+			"",
+		},
+		{
+			"tim",
+			false,
+			http.StatusUnprocessableEntity,
+			`{"error":"Password does not meet the password policy.","violations":[` +
+				`{"rule":"min_length","message":"Password must be at least 8 characters long."},` +
+				`{"rule":"min_entropy","message":"Password is too easy to guess. Try a longer password, or mix in other kinds of characters."},` +
+				`{"rule":"no_email","message":"Password must not contain your email."}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		actualOK := cfg.enforcePasswordPolicy(w, test.inputPassword, "tim@apple.com")
+
+		actualMsg, actualCode := readResponse(w, t)
+
+		if actualOK != test.expectedOK {
+			t.Errorf("Expected '%t', recieved '%t'", test.expectedOK, actualOK)
+		}
+		if actualCode != test.expectedCode {
+			t.Errorf("Expected '%d', recieved '%d'", test.expectedCode, actualCode)
+		}
+		if actualMsg != test.expectedMsg {
+			t.Errorf("Expected '%s', received '%s'", test.expectedMsg, actualMsg)
+		}
+	}
+}
@@ -0,0 +1,804 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	oauthCodeExpiry         = time.Duration(time.Minute * 10)
+	oauthAccessTokenExpiry  = time.Duration(time.Hour * 1)
+	oauthRefreshTokenExpiry = time.Duration(time.Hour * 24 * 60)
+)
+
+// =====
+// TYPES
+// =====
+
+type OAuthClientCreateRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scope        string   `json:"scope"`
+	Confidential bool     `json:"confidential"`
+}
+type OAuthClientResponse struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scope        string    `json:"scope"`
+}
+
+// parameters of the authorization request (RFC 6749, section 4.1.1)
+// with the PKCE extension (RFC 7636, section 4.3)
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+type OAuthConsentRequest struct {
+	OAuthAuthorizeRequest
+	Approve bool `json:"approve"`
+}
+type OAuthConsentPrompt struct {
+	ClientID    uuid.UUID `json:"client_id"`
+	ClientName  string    `json:"client_name"`
+	Scope       []string  `json:"scope"`
+	RedirectURI string    `json:"redirect_uri"`
+	State       string    `json:"state"`
+}
+type OAuthRedirectResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// introspection response (RFC 7662, section 2.2)
+type OAuthIntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+// error response (RFC 6749, section 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// an authorization request error that can be sent back to the client's redirect uri
+type oauthRedirectError struct {
+	code        string
+	description string
+}
+
+func (e *oauthRedirectError) Error() string {
+	return e.code + ": " + e.description
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// responds with an oauth error payload
+func respondWithOAuthError(w http.ResponseWriter, code int, errCode, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, code, OAuthErrorResponse{
+		Error:            errCode,
+		ErrorDescription: description,
+	})
+}
+
+// redirect uris must be absolute, without a fragment,
+// and use https unless they point at a loopback address
+func validateRedirectURI(rawURI string) error {
+	parsedURI, err := url.Parse(rawURI)
+	if err != nil {
+		return err
+	}
+	if !parsedURI.IsAbs() || parsedURI.Host == "" {
+		return errors.New("redirect uri must be absolute")
+	}
+	if parsedURI.Fragment != "" {
+		return errors.New("redirect uri must not contain a fragment")
+	}
+
+	switch parsedURI.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := parsedURI.Hostname()
+		if host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+		return errors.New("redirect uri must use https")
+	default:
+		return errors.New("redirect uri must use https")
+	}
+}
+
+// appends the query params to the redirect uri
+func buildRedirectURI(redirectURI string, params url.Values) string {
+	parsedURI, err := url.Parse(redirectURI)
+	if err != nil {
+		// redirect uris are validated at registration
+		log.Printf("!!! potential bug, stored redirect uri does not parse: %s", err)
+		return redirectURI
+	}
+
+	query := parsedURI.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	parsedURI.RawQuery = query.Encode()
+
+	return parsedURI.String()
+}
+
+func authorizeRequestFromQuery(query url.Values) OAuthAuthorizeRequest {
+	return OAuthAuthorizeRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// validates the client and redirect uri of an authorization request
+// errors from here must not be redirected, as the redirect uri is not trusted yet
+func (cfg *apiConfig) lookupAuthorizeClient(r *http.Request, req OAuthAuthorizeRequest) (database.OauthClient, error) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("invalid client_id")
+	}
+
+	client, err := cfg.db.GetOAuthClientByID(r.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client_id")
+	}
+
+	// the redirect uri must exactly match a registered one
+	for _, registeredURI := range client.RedirectUris {
+		if registeredURI == req.RedirectURI {
+			return client, nil
+		}
+	}
+
+	return database.OauthClient{}, errors.New("redirect_uri is not registered for client")
+}
+
+// validates the remaining parameters of an authorization request
+// and returns the requested scopes
+func validateAuthorizeParams(client database.OauthClient, req OAuthAuthorizeRequest) ([]string, error) {
+	if req.ResponseType != "code" {
+		return nil, &oauthRedirectError{"unsupported_response_type", "only the 'code' response type is supported"}
+	}
+
+	scopes := auth.ParseScope(req.Scope)
+	if err := auth.ValidateScope(scopes); err != nil {
+		return nil, &oauthRedirectError{"invalid_scope", err.Error()}
+	}
+	if !auth.ScopeCovers(auth.ParseScope(client.Scope), scopes) {
+		return nil, &oauthRedirectError{"invalid_scope", "scope exceeds what the client registered"}
+	}
+
+	// PKCE is required for every client
+	if req.CodeChallenge == "" {
+		return nil, &oauthRedirectError{"invalid_request", "code_challenge is required"}
+	}
+	if req.CodeChallengeMethod != auth.PKCEMethodS256 {
+		return nil, &oauthRedirectError{"invalid_request", "code_challenge_method must be S256"}
+	}
+
+	return scopes, nil
+}
+
+// issues a single use authorization code and returns the uri to redirect the user to
+func (cfg *apiConfig) issueAuthorizationCode(r *http.Request, userID uuid.UUID, client database.OauthClient, req OAuthAuthorizeRequest, scopes []string) (string, error) {
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = cfg.db.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:            auth.HashToken(code),
+		ClientID:            client.ID,
+		UserID:              userID,
+		RedirectUri:         req.RedirectURI,
+		Scope:               strings.Join(scopes, " "),
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           time.Now().UTC().Add(oauthCodeExpiry),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	return buildRedirectURI(req.RedirectURI, params), nil
+}
+
+func redirectErrorURI(req OAuthAuthorizeRequest, redirectErr *oauthRedirectError) string {
+	params := url.Values{
+		"error":             {redirectErr.code},
+		"error_description": {redirectErr.description},
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	return buildRedirectURI(req.RedirectURI, params)
+}
+
+// authenticates the client with either HTTP basic auth,
+// or client_id and client_secret form parameters
+// public clients (no secret) only present their client_id
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	rawClientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		rawClientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(rawClientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("invalid client_id")
+	}
+
+	client, err := cfg.db.GetOAuthClientByID(r.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client_id")
+	}
+
+	if client.HashedSecret.Valid {
+		if clientSecret == "" {
+			return database.OauthClient{}, errors.New("client secret is required")
+		}
+		_, err = auth.CheckPasswordHash(clientSecret, client.HashedSecret.String)
+		if err != nil {
+			return database.OauthClient{}, errors.New("client secret does not match")
+		}
+	}
+
+	return client, nil
+}
+
+// issues an access token (JWT) and a refresh token to the client
+// only the refresh token's hash is stored, like authorization codes
+// pass the transaction's queries, so the tokens only exist if the grant they replace is used up
+func (cfg *apiConfig) issueOAuthTokens(ctx context.Context, q *database.Queries, userID, clientID uuid.UUID, scope string) (OAuthTokenResponse, error) {
+	accessToken, err := auth.MakeScopedJWT(userID, clientID, scope, cfg.jwtSecret, oauthAccessTokenExpiry)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	_, err = q.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+		ID:        auth.HashToken(refreshToken),
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(oauthRefreshTokenExpiry),
+		ClientID:  uuid.NullUUID{UUID: clientID, Valid: true},
+		Scope:     scope,
+	})
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	return OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenExpiry.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	}, nil
+}
+
+// reports if the refresh token is usable right now
+func refreshTokenIsActive(refreshTokenRecord database.RefreshToken) bool {
+	if refreshTokenRecord.RevokedAt.Valid {
+		return false
+	}
+
+	return time.Now().UTC().Before(refreshTokenRecord.ExpiresAt)
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// registers a new third-party client owned by the requesting user
+func (cfg *apiConfig) handlerCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	// only first-party tokens may register clients
+	userID, err := cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Unable to authenticate client registration: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var createClientRequest OAuthClientCreateRequest
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&createClientRequest)
+	if err != nil {
+		log.Printf("Error decoding create oauth client request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	if strings.TrimSpace(createClientRequest.Name) == "" {
+		respondWithError(w, http.StatusBadRequest, "A client name is required.")
+		return
+	}
+	if len(createClientRequest.RedirectURIs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one redirect uri is required.")
+		return
+	}
+	for _, redirectURI := range createClientRequest.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			log.Printf("Invalid redirect uri '%s': %s", redirectURI, err)
+			respondWithError(w, http.StatusBadRequest, "Invalid redirect uri.")
+			return
+		}
+	}
+
+	scopes := auth.ParseScope(createClientRequest.Scope)
+	if err := auth.ValidateScope(scopes); err != nil {
+		log.Printf("Invalid client scope: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid scope.")
+		return
+	}
+
+	// confidential clients get a secret, which is only shown once
+	var clientSecret string
+	hashedSecret := sql.NullString{}
+	if createClientRequest.Confidential {
+		clientSecret, err = auth.MakeRefreshToken()
+		if err != nil {
+			log.Printf("Error making client secret: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		hashed, err := auth.HashPassword(clientSecret)
+		if err != nil {
+			log.Printf("Error hashing client secret: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		hashedSecret = sql.NullString{String: hashed, Valid: true}
+	}
+
+	clientRecord, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		UserID:       userID,
+		Name:         createClientRequest.Name,
+		HashedSecret: hashedSecret,
+		RedirectUris: createClientRequest.RedirectURIs,
+		Scope:        strings.Join(scopes, " "),
+	})
+	if err != nil {
+		log.Printf("Error creating oauth client record: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("User '%s' registered oauth client '%s'.", userID, clientRecord.ID)
+	respondWithJSON(w, http.StatusCreated, OAuthClientResponse{
+		ClientID:     clientRecord.ID,
+		ClientSecret: clientSecret,
+		CreatedAt:    clientRecord.CreatedAt,
+		Name:         clientRecord.Name,
+		RedirectURIs: clientRecord.RedirectUris,
+		Scope:        clientRecord.Scope,
+	})
+}
+
+// starts the authorization code flow for the logged in user
+// if the user already consented to the scopes, it redirects with a code
+// otherwise it responds with what the user is being asked to consent to
+func (cfg *apiConfig) handlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Unable to authenticate authorization request: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	authorizeRequest := authorizeRequestFromQuery(r.URL.Query())
+	client, err := cfg.lookupAuthorizeClient(r, authorizeRequest)
+	if err != nil {
+		log.Printf("Invalid authorization request: %s", err)
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	scopes, err := validateAuthorizeParams(client, authorizeRequest)
+	if err != nil {
+		var redirectErr *oauthRedirectError
+		errors.As(err, &redirectErr)
+		http.Redirect(w, r, redirectErrorURI(authorizeRequest, redirectErr), http.StatusFound)
+		return
+	}
+
+	// skip the consent prompt if the user already granted these scopes
+	consentRecord, err := cfg.db.GetOAuthConsent(r.Context(), database.GetOAuthConsentParams{
+		UserID:   userID,
+		ClientID: client.ID,
+	})
+	if err == nil && auth.ScopeCovers(auth.ParseScope(consentRecord.Scope), scopes) {
+		redirectTo, err := cfg.issueAuthorizationCode(r, userID, client, authorizeRequest, scopes)
+		if err != nil {
+			log.Printf("Error issuing authorization code: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+
+		log.Printf("Issued authorization code to client '%s' for user '%s'.", client.ID, userID)
+		http.Redirect(w, r, redirectTo, http.StatusFound)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, OAuthConsentPrompt{
+		ClientID:    client.ID,
+		ClientName:  client.Name,
+		Scope:       scopes,
+		RedirectURI: authorizeRequest.RedirectURI,
+		State:       authorizeRequest.State,
+	})
+}
+
+// records the user's consent decision
+// responds with the uri the user agent should be sent to
+func (cfg *apiConfig) handlerOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Unable to authenticate consent request: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var consentRequest OAuthConsentRequest
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&consentRequest)
+	if err != nil {
+		log.Printf("Error decoding consent request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+	authorizeRequest := consentRequest.OAuthAuthorizeRequest
+
+	client, err := cfg.lookupAuthorizeClient(r, authorizeRequest)
+	if err != nil {
+		log.Printf("Invalid consent request: %s", err)
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	scopes, err := validateAuthorizeParams(client, authorizeRequest)
+	if err != nil {
+		var redirectErr *oauthRedirectError
+		errors.As(err, &redirectErr)
+		respondWithJSON(w, http.StatusOK, OAuthRedirectResponse{redirectErrorURI(authorizeRequest, redirectErr)})
+		return
+	}
+
+	if !consentRequest.Approve {
+		log.Printf("User '%s' denied consent to client '%s'.", userID, client.ID)
+		redirectErr := &oauthRedirectError{"access_denied", "the user denied the request"}
+		respondWithJSON(w, http.StatusOK, OAuthRedirectResponse{redirectErrorURI(authorizeRequest, redirectErr)})
+		return
+	}
+
+	// keep previously granted scopes alongside the new ones
+	grantedScopes := scopes
+	consentRecord, err := cfg.db.GetOAuthConsent(r.Context(), database.GetOAuthConsentParams{
+		UserID:   userID,
+		ClientID: client.ID,
+	})
+	if err == nil {
+		grantedScopes = auth.ParseScope(consentRecord.Scope + " " + strings.Join(scopes, " "))
+	}
+
+	err = cfg.db.UpsertOAuthConsent(r.Context(), database.UpsertOAuthConsentParams{
+		UserID:   userID,
+		ClientID: client.ID,
+		Scope:    strings.Join(grantedScopes, " "),
+	})
+	if err != nil {
+		log.Printf("Error saving consent: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	redirectTo, err := cfg.issueAuthorizationCode(r, userID, client, authorizeRequest, scopes)
+	if err != nil {
+		log.Printf("Error issuing authorization code: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("User '%s' granted '%s' to client '%s'.", userID, strings.Join(scopes, " "), client.ID)
+	respondWithJSON(w, http.StatusOK, OAuthRedirectResponse{redirectTo})
+}
+
+// exchanges an authorization code or refresh token for new tokens
+// the request body is form encoded (RFC 6749, section 4.1.3 and 6)
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "unable to parse form body")
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		log.Printf("Unable to authenticate oauth client: %s", err)
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	// the grant is used up and the new tokens stored together, so neither happens without the other
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	var tokenResponse OAuthTokenResponse
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		// the code is locked while it is checked, and only consumed once every check has passed,
+		// so a request from the wrong client, or with the wrong redirect_uri, does not use it up
+		codeRecord, err := qtx.GetOAuthAuthorizationCodeForUpdate(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+		if err != nil {
+			log.Printf("Authorization code is unknown or already used: %s", err)
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+			return
+		}
+
+		if codeRecord.ClientID != client.ID {
+			log.Printf("Client '%s' presented a code issued to '%s'", client.ID, codeRecord.ClientID)
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+			return
+		}
+		if time.Now().UTC().After(codeRecord.ExpiresAt) {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code is expired")
+			return
+		}
+		if r.PostForm.Get("redirect_uri") != codeRecord.RedirectUri {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+			return
+		}
+
+		err = auth.VerifyPKCE(r.PostForm.Get("code_verifier"), codeRecord.CodeChallenge, codeRecord.CodeChallengeMethod)
+		if err != nil {
+			log.Printf("PKCE verification failed: %s", err)
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier is invalid")
+			return
+		}
+
+		// consuming marks the code as used, so it can never be exchanged twice
+		_, err = qtx.ConsumeOAuthAuthorizationCode(r.Context(), codeRecord.CodeHash)
+		if err != nil {
+			log.Printf("Error consuming authorization code: %s", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		tokenResponse, err = cfg.issueOAuthTokens(r.Context(), qtx, codeRecord.UserID, client.ID, codeRecord.Scope)
+		if err != nil {
+			log.Printf("Error issuing oauth tokens: %s", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+	case "refresh_token":
+		refreshTokenRecord, err := qtx.GetUserFromRefreshToken(r.Context(), auth.HashToken(r.PostForm.Get("refresh_token")))
+		if err != nil || !refreshTokenIsActive(refreshTokenRecord) {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+		if !refreshTokenRecord.ClientID.Valid || refreshTokenRecord.ClientID.UUID != client.ID {
+			log.Printf("Client '%s' presented a refresh token it does not own", client.ID)
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+
+		// the client may narrow, but never widen, the original scope
+		scope := refreshTokenRecord.Scope
+		if requested := r.PostForm.Get("scope"); requested != "" {
+			requestedScopes := auth.ParseScope(requested)
+			if !auth.ScopeCovers(auth.ParseScope(scope), requestedScopes) {
+				respondWithOAuthError(w, http.StatusBadRequest, "invalid_scope", "scope exceeds the original grant")
+				return
+			}
+			scope = strings.Join(requestedScopes, " ")
+		}
+
+		// refresh tokens are rotated on every use
+		// only one of two requests racing with the same token gets to revoke it
+		rotated, err := qtx.RotateRefreshToken(r.Context(), refreshTokenRecord.ID)
+		if err != nil {
+			log.Printf("Error revoking rotated refresh token: %s", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		if rotated == 0 {
+			respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+
+		tokenResponse, err = cfg.issueOAuthTokens(r.Context(), qtx, refreshTokenRecord.UserID, client.ID, scope)
+		if err != nil {
+			log.Printf("Error issuing oauth tokens: %s", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Unable to commit oauth token exchange: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	log.Printf("Issued oauth tokens to client '%s'.", client.ID)
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, tokenResponse)
+}
+
+// revokes a refresh token issued to the client (RFC 7009)
+// access tokens (JWT) are not revokable and simply expire
+func (cfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "unable to parse form body")
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		log.Printf("Unable to authenticate oauth client: %s", err)
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	// unknown tokens are not an error (section 2.2)
+	refreshTokenRecord, err := cfg.db.GetUserFromRefreshToken(r.Context(), auth.HashToken(r.PostForm.Get("token")))
+	if err == nil && refreshTokenRecord.ClientID.Valid && refreshTokenRecord.ClientID.UUID == client.ID {
+		err = cfg.db.RevokeRefreshTokenWithToken(r.Context(), refreshTokenRecord.ID)
+		if err != nil {
+			log.Printf("Error revoking oauth refresh token: %s", err)
+			respondWithOAuthError(w, http.StatusServiceUnavailable, "server_error", "")
+			return
+		}
+		log.Printf("Client '%s' revoked a refresh token.", client.ID)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// reports whether a token issued to the client is active (RFC 7662)
+func (cfg *apiConfig) handlerOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "unable to parse form body")
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		log.Printf("Unable to authenticate oauth client: %s", err)
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	inactive := OAuthIntrospectionResponse{Active: false}
+	w.Header().Set("Cache-Control", "no-store")
+
+	// access tokens
+	claims, err := auth.ValidateJWTClaims(token, cfg.jwtSecret)
+	if err == nil {
+		if claims.ClientID != client.ID.String() {
+			respondWithJSON(w, http.StatusOK, inactive)
+			return
+		}
+
+		// the user's access tokens stop working once their account is pending deletion
+		userID, err := uuid.Parse(claims.Subject)
+		if err != nil {
+			respondWithJSON(w, http.StatusOK, inactive)
+			return
+		}
+		pending, err := cfg.pendingDeletions.IsUserPendingDeletion(r.Context(), userID)
+		if err != nil || pending {
+			respondWithJSON(w, http.StatusOK, inactive)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, OAuthIntrospectionResponse{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			Subject:   claims.Subject,
+			TokenType: "Bearer",
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+			Issuer:    claims.Issuer,
+		})
+		return
+	}
+
+	// refresh tokens
+	refreshTokenRecord, err := cfg.db.GetUserFromRefreshToken(r.Context(), auth.HashToken(token))
+	if err != nil || !refreshTokenIsActive(refreshTokenRecord) {
+		respondWithJSON(w, http.StatusOK, inactive)
+		return
+	}
+	if !refreshTokenRecord.ClientID.Valid || refreshTokenRecord.ClientID.UUID != client.ID {
+		respondWithJSON(w, http.StatusOK, inactive)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, OAuthIntrospectionResponse{
+		Active:    true,
+		Scope:     refreshTokenRecord.Scope,
+		ClientID:  refreshTokenRecord.ClientID.UUID.String(),
+		Subject:   refreshTokenRecord.UserID.String(),
+		TokenType: "refresh_token",
+		ExpiresAt: refreshTokenRecord.ExpiresAt.Unix(),
+		IssuedAt:  refreshTokenRecord.CreatedAt.Unix(),
+	})
+}
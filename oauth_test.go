@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+)
+
+func TestValidateRedirectURI(t *testing.T) {
+	var tests = []struct {
+		input     string
+		expectErr bool
+	}{
+		{"https://example.com/callback", false},
+		{"http://localhost:3000/callback", false},
+		{"http://127.0.0.1/callback", false},
+		{"http://example.com/callback", true},
+		{"https://example.com/callback#frag", true},
+		{"/callback", true},
+		{"javascript:alert(1)", true},
+	}
+
+	for _, test := range tests {
+		err := validateRedirectURI(test.input)
+		if (err != nil) != test.expectErr {
+			t.Errorf("URI '%s', expected error: %t, Got: '%v'", test.input, test.expectErr, err)
+		}
+	}
+}
+
+func TestBuildRedirectURI(t *testing.T) {
+	var tests = []struct {
+		inputURI    string
+		inputParams url.Values
+		expected    string
+	}{
+		{
+			"https://example.com/cb",
+			url.Values{"code": {"abc"}, "state": {"xyz"}},
+			"https://example.com/cb?code=abc&state=xyz",
+		},
+		{
+			"https://example.com/cb?app=1",
+			url.Values{"error": {"access_denied"}},
+			"https://example.com/cb?app=1&error=access_denied",
+		},
+	}
+
+	for _, test := range tests {
+		actual := buildRedirectURI(test.inputURI, test.inputParams)
+		if actual != test.expected {
+			t.Errorf("Expected '%s', received '%s'", test.expected, actual)
+		}
+	}
+}
+
+func TestAuthenticateRequestScope(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	userID := uuid.New()
+
+	firstParty, err := auth.MakeJWT(userID, cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+	thirdParty, err := auth.MakeScopedJWT(userID, uuid.New(), auth.ScopeChirpsWrite, cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+
+	var tests = []struct {
+		token     string
+		scope     string
+		expectErr bool
+	}{
+		{firstParty, auth.ScopeChirpsWrite, false},
+		{firstParty, "", false},
+		{thirdParty, auth.ScopeChirpsWrite, false},
+		{thirdParty, auth.ScopeUsersWrite, true},
+		{thirdParty, "", true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+		r.Header.Set("Authorization", "Bearer "+test.token)
+
+		actual, err := cfg.authenticateRequest(r, test.scope)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Scope '%s', expected error: %t, Got: '%v'", test.scope, test.expectErr, err)
+		}
+		if err == nil && actual != userID {
+			t.Errorf("Expected '%s', received '%s'", userID, actual)
+		}
+	}
+}
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+	"github.com/nicholasss/chirpy/internal/outbound"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	// events integrators can subscribe to, about the subscribing user
+	outboundEventChirpCreated = "chirp.created"
+	outboundEventChirpDeleted = "chirp.deleted"
+	outboundEventUserUpgraded = "user.upgraded"
+
+	maxWebhookSubscriptionsPerUser = 10
+
+	webhookDeliveryInterval = time.Duration(time.Second * 10)
+	webhookDeliveryTimeout  = time.Duration(time.Second * 10)
+	// a claimed delivery is tried again after this long if its worker stops, so it must outlast a batch
+	webhookDeliveryLease     = time.Duration(time.Minute * 5)
+	webhookDeliveryBatchSize = 20
+	// deliveries of a batch sent at the same time, so a slow endpoint does not hold up the others
+	webhookDeliveryWorkers = 5
+
+	// after this many failed attempts, a delivery is dead-lettered and only sent again by hand
+	webhookDeliveryMaxAttempts = 8
+	// doubled after each failed attempt, up to the max
+	webhookRetryBaseDelay = time.Duration(time.Second * 30)
+	webhookRetryMaxDelay  = time.Duration(time.Hour * 6)
+
+	webhookDeliveryStatusPending   = "pending"
+	webhookDeliveryStatusDelivered = "delivered"
+	webhookDeliveryStatusDead      = "dead"
+)
+
+// ================
+// GLOBAL VARIABLES
+// ================
+
+var outboundEvents = []string{
+	outboundEventChirpCreated,
+	outboundEventChirpDeleted,
+	outboundEventUserUpgraded,
+}
+
+// =====
+// TYPES
+// =====
+
+type WebhookSubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type WebhookSubscriptionResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	URL       string     `json:"url"`
+	Events    []string   `json:"events"`
+	ClientID  *uuid.UUID `json:"client_id"`
+	// only shown when the subscription is made
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID        uuid.UUID       `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	EventID   uuid.UUID       `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int32           `json:"attempts"`
+	// only set while the delivery is pending
+	NextAttemptAt *time.Time                       `json:"next_attempt_at"`
+	DeliveredAt   *time.Time                       `json:"delivered_at"`
+	LastError     string                           `json:"last_error"`
+	Log           []WebhookDeliveryAttemptResponse `json:"log"`
+}
+
+type WebhookDeliveryAttemptResponse struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	// null when no response was received
+	StatusCode *int32 `json:"status_code"`
+	Error      string `json:"error"`
+	DurationMs int32  `json:"duration_ms"`
+}
+
+// the body of every delivery
+type OutboundWebhookEvent struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type ChirpWebhookData struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+}
+
+type ChirpDeletedWebhookData struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type UserUpgradedWebhookData struct {
+	UserID uuid.UUID `json:"user_id"`
+	Plan   string    `json:"plan"`
+}
+
+// sends due deliveries from the outbox, retrying those that fail, every webhookDeliveryInterval
+type webhookDeliveryJob struct{}
+
+func (webhookDeliveryJob) Kind() string { return "webhooks.deliver" }
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+func newWebhookSubscriptionResponse(subscription database.WebhookSubscription) WebhookSubscriptionResponse {
+	response := WebhookSubscriptionResponse{
+		ID:        subscription.ID,
+		CreatedAt: subscription.CreatedAt,
+		UpdatedAt: subscription.UpdatedAt,
+		URL:       subscription.Url,
+		Events:    subscription.Events,
+	}
+	if subscription.ClientID.Valid {
+		response.ClientID = &subscription.ClientID.UUID
+	}
+
+	return response
+}
+
+func newWebhookDeliveryResponse(delivery database.WebhookDelivery, attempts []database.WebhookDeliveryAttempt) WebhookDeliveryResponse {
+	response := WebhookDeliveryResponse{
+		ID:        delivery.ID,
+		CreatedAt: delivery.CreatedAt,
+		EventID:   delivery.EventID,
+		EventType: delivery.EventType,
+		Payload:   delivery.Payload,
+		Status:    delivery.Status,
+		Attempts:  delivery.Attempts,
+		LastError: delivery.LastError.String,
+		Log:       make([]WebhookDeliveryAttemptResponse, 0, len(attempts)),
+	}
+	if delivery.Status == webhookDeliveryStatusPending {
+		response.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.DeliveredAt.Valid {
+		response.DeliveredAt = &delivery.DeliveredAt.Time
+	}
+
+	for _, attempt := range attempts {
+		attemptResponse := WebhookDeliveryAttemptResponse{
+			AttemptedAt: attempt.AttemptedAt,
+			Error:       attempt.Error.String,
+			DurationMs:  attempt.DurationMs,
+		}
+		if attempt.StatusCode.Valid {
+			attemptResponse.StatusCode = &attempt.StatusCode.Int32
+		}
+		response.Log = append(response.Log, attemptResponse)
+	}
+
+	return response
+}
+
+func newChirpWebhookData(chirp database.Chirp) ChirpWebhookData {
+	data := ChirpWebhookData{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+	}
+	if chirp.InReplyTo.Valid {
+		data.InReplyTo = &chirp.InReplyTo.UUID
+	}
+
+	return data
+}
+
+// checks the events a subscription asks for, and returns them without duplicates
+func parseOutboundEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, errors.New("at least one event is required")
+	}
+
+	parsed := make([]string, 0, len(events))
+	for _, event := range events {
+		if !slices.Contains(outboundEvents, event) {
+			return nil, fmt.Errorf("unknown event '%s'", event)
+		}
+		if !slices.Contains(parsed, event) {
+			parsed = append(parsed, event)
+		}
+	}
+
+	return parsed, nil
+}
+
+// reports if the token may see and change the subscription
+// a third-party app only sees the subscriptions it made, the user sees them all
+func canManageWebhookSubscription(subscription database.WebhookSubscription, userID uuid.UUID, clientID uuid.NullUUID) bool {
+	if subscription.UserID != userID {
+		return false
+	}
+
+	return !clientID.Valid || subscription.ClientID == clientID
+}
+
+// writes a delivery of the event for each of the user's subscriptions to it
+// runs inside the caller's transaction, so the event is only sent if the change it reports is saved
+func enqueueOutboundWebhook(ctx context.Context, qtx *database.Queries, userID uuid.UUID, eventType string, data any) error {
+	event := OutboundWebhookEvent{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = qtx.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		EventID:   event.ID,
+		EventType: eventType,
+		Payload:   payload,
+		UserID:    userID,
+	})
+	return err
+}
+
+// how long to wait before trying again, after the given number of failed attempts
+func webhookRetryDelay(attempts int32) time.Duration {
+	delay := webhookRetryBaseDelay
+	for i := int32(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= webhookRetryMaxDelay {
+			return webhookRetryMaxDelay
+		}
+	}
+
+	return delay
+}
+
+// works out what happens to a delivery after an attempt failed
+// attempts is the number made before this one
+func nextWebhookDelivery(attempts int32, now time.Time) (string, time.Time) {
+	attempts++
+	if attempts >= webhookDeliveryMaxAttempts {
+		return webhookDeliveryStatusDead, now
+	}
+
+	return webhookDeliveryStatusPending, now.Add(webhookRetryDelay(attempts))
+}
+
+// sends one claimed delivery, and records how it went
+func (cfg *apiConfig) deliverWebhook(ctx context.Context, delivery database.ClaimDueWebhookDeliveriesRow) {
+	now := time.Now().UTC()
+	result, sendErr := cfg.webhookSender.Send(ctx, delivery.Url, delivery.Secret, outbound.Delivery{
+		ID:    delivery.ID.String(),
+		Event: delivery.EventType,
+		Body:  delivery.Payload,
+	}, now)
+
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	attempt := database.CreateWebhookDeliveryAttemptParams{
+		DeliveryID: delivery.ID,
+		DurationMs: int32(result.Duration.Milliseconds()),
+	}
+	if result.StatusCode != 0 {
+		attempt.StatusCode = sql.NullInt32{Int32: int32(result.StatusCode), Valid: true}
+	}
+	if sendErr != nil {
+		attempt.Error = sql.NullString{String: sendErr.Error(), Valid: true}
+	}
+	err = qtx.CreateWebhookDeliveryAttempt(ctx, attempt)
+	if err != nil {
+		log.Printf("Unable to record attempt of webhook delivery '%s': %s", delivery.ID, err)
+		return
+	}
+
+	if sendErr == nil {
+		err = qtx.CompleteWebhookDelivery(ctx, delivery.ID)
+	} else {
+		status, nextAttemptAt := nextWebhookDelivery(delivery.Attempts, now)
+		err = qtx.RetryWebhookDelivery(ctx, database.RetryWebhookDeliveryParams{
+			ID:            delivery.ID,
+			Status:        status,
+			NextAttemptAt: nextAttemptAt,
+			LastError:     attempt.Error,
+		})
+		if status == webhookDeliveryStatusDead {
+			log.Printf("Webhook delivery '%s' failed %d times, it is dead-lettered: %s", delivery.ID, webhookDeliveryMaxAttempts, sendErr)
+		}
+	}
+	if err != nil {
+		log.Printf("Unable to update webhook delivery '%s': %s", delivery.ID, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Unable to commit webhook delivery '%s': %s", delivery.ID, err)
+	}
+}
+
+// sends the deliveries that are due, a few at a time, and waits for them all
+// each is claimed for a while, so another instance running at the same time skips it
+func (cfg *apiConfig) deliverDueWebhooks(ctx context.Context) {
+	now := time.Now().UTC()
+	deliveries, err := cfg.db.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+		LeaseUntil:    now.Add(webhookDeliveryLease),
+		Now:           now,
+		MaxDeliveries: webhookDeliveryBatchSize,
+	})
+	if err != nil {
+		log.Printf("Unable to claim webhook deliveries: %s", err)
+		return
+	}
+
+	workers := make(chan struct{}, webhookDeliveryWorkers)
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			cfg.deliverWebhook(ctx, delivery)
+		}()
+	}
+	wg.Wait()
+}
+
+// gets the subscription in the path, if the token may manage it
+func (cfg *apiConfig) getManagedWebhookSubscription(r *http.Request, userID uuid.UUID, clientID uuid.NullUUID) (database.WebhookSubscription, error) {
+	subscriptionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return database.WebhookSubscription{}, sql.ErrNoRows
+	}
+
+	subscription, err := cfg.db.GetWebhookSubscription(r.Context(), subscriptionID)
+	if err != nil {
+		return database.WebhookSubscription{}, err
+	}
+	if !canManageWebhookSubscription(subscription, userID, clientID) {
+		return database.WebhookSubscription{}, sql.ErrNoRows
+	}
+
+	return subscription, nil
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// subscribes a url to events about the user
+// responds with the secret deliveries are signed with, which is not shown again
+func (cfg *apiConfig) handlerCreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, clientID, err := cfg.authenticateRequestClient(r, auth.ScopeWebhooksWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	var subscriptionRequest WebhookSubscriptionRequest
+	err = json.NewDecoder(r.Body).Decode(&subscriptionRequest)
+	if err != nil {
+		log.Printf("Error decoding webhook subscription request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	err = outbound.ValidateURL(subscriptionRequest.URL)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid url: "+err.Error()+".")
+		return
+	}
+
+	events, err := parseOutboundEvents(subscriptionRequest.Events)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid events: "+err.Error()+".")
+		return
+	}
+
+	subscriptions, err := cfg.db.ListWebhookSubscriptionsByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing webhook subscriptions of user '%s': %s", userID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if len(subscriptions) >= maxWebhookSubscriptionsPerUser {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("You can have at most %d webhook subscriptions.", maxWebhookSubscriptionsPerUser))
+		return
+	}
+
+	secret, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error making webhook secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	subscription, err := cfg.db.CreateWebhookSubscription(r.Context(), database.CreateWebhookSubscriptionParams{
+		UserID:   userID,
+		ClientID: clientID,
+		Url:      subscriptionRequest.URL,
+		Secret:   secret,
+		Events:   events,
+	})
+	if err != nil {
+		log.Printf("Error creating webhook subscription: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	response := newWebhookSubscriptionResponse(subscription)
+	response.Secret = subscription.Secret
+
+	log.Printf("User '%s' subscribed '%s' to %v.", userID, subscription.Url, subscription.Events)
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+// lists the user's webhook subscriptions, or only the app's own when an app asks
+func (cfg *apiConfig) handlerListWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userID, clientID, err := cfg.authenticateRequestClient(r, auth.ScopeWebhooksWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	subscriptions, err := cfg.db.ListWebhookSubscriptionsByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing webhook subscriptions of user '%s': %s", userID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	subscriptionResponses := make([]WebhookSubscriptionResponse, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		if canManageWebhookSubscription(subscription, userID, clientID) {
+			subscriptionResponses = append(subscriptionResponses, newWebhookSubscriptionResponse(subscription))
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, subscriptionResponses)
+}
+
+// unsubscribes, deliveries that are still pending are dropped
+func (cfg *apiConfig) handlerDeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, clientID, err := cfg.authenticateRequestClient(r, auth.ScopeWebhooksWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	subscription, err := cfg.getManagedWebhookSubscription(r, userID, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Webhook subscription not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting webhook subscription: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = cfg.db.DeleteWebhookSubscription(r.Context(), subscription.ID)
+	if err != nil {
+		log.Printf("Error deleting webhook subscription '%s': %s", subscription.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("User '%s' deleted webhook subscription '%s'.", userID, subscription.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lists a subscription's deliveries, newest first, each with the log of its attempts
+func (cfg *apiConfig) handlerListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, clientID, err := cfg.authenticateRequestClient(r, auth.ScopeWebhooksWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	limit, err := parseListLimit(r, defaultWebhookEventListLimit, maxWebhookEventListLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit: "+err.Error()+".")
+		return
+	}
+
+	subscription, err := cfg.getManagedWebhookSubscription(r, userID, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Webhook subscription not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting webhook subscription: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	deliveries, err := cfg.db.ListWebhookDeliveriesBySubscriptionID(r.Context(), database.ListWebhookDeliveriesBySubscriptionIDParams{
+		SubscriptionID: subscription.ID,
+		Limit:          int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error listing deliveries of webhook subscription '%s': %s", subscription.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	deliveryIDs := make([]uuid.UUID, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		deliveryIDs = append(deliveryIDs, delivery.ID)
+	}
+	attempts, err := cfg.db.ListWebhookDeliveryAttemptsByDeliveryIDs(r.Context(), deliveryIDs)
+	if err != nil {
+		log.Printf("Error listing webhook delivery attempts: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	attemptsByDelivery := make(map[uuid.UUID][]database.WebhookDeliveryAttempt, len(deliveries))
+	for _, attempt := range attempts {
+		attemptsByDelivery[attempt.DeliveryID] = append(attemptsByDelivery[attempt.DeliveryID], attempt)
+	}
+
+	deliveryResponses := make([]WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		deliveryResponses = append(deliveryResponses, newWebhookDeliveryResponse(delivery, attemptsByDelivery[delivery.ID]))
+	}
+
+	respondWithJSON(w, http.StatusOK, deliveryResponses)
+}
+
+// sends a delivery again as soon as possible, whatever its status
+// a dead-lettered delivery gets all its attempts back, one being sent right now is left alone
+func (cfg *apiConfig) handlerRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, clientID, err := cfg.authenticateRequestClient(r, auth.ScopeWebhooksWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	deliveryID, err := uuid.Parse(r.PathValue("delivery_id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Webhook delivery not found.")
+		return
+	}
+
+	subscription, err := cfg.getManagedWebhookSubscription(r, userID, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Webhook subscription not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting webhook subscription: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	delivery, err := cfg.db.RedeliverWebhookDelivery(r.Context(), database.RedeliverWebhookDeliveryParams{
+		ID:             deliveryID,
+		SubscriptionID: subscription.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// either there is no such delivery, or it is leased to a sender
+		_, err = cfg.db.GetWebhookDelivery(r.Context(), database.GetWebhookDeliveryParams{
+			ID:             deliveryID,
+			SubscriptionID: subscription.ID,
+		})
+		if err == nil {
+			respondWithError(w, http.StatusConflict, "Webhook delivery is being sent, try again shortly.")
+			return
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Webhook delivery not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error redelivering webhook delivery '%s': %s", deliveryID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("Webhook delivery '%s' will be sent again.", delivery.ID)
+	respondWithJSON(w, http.StatusAccepted, newWebhookDeliveryResponse(delivery, nil))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+func TestParseOutboundEvents(t *testing.T) {
+	var tests = []struct {
+		input     []string
+		expected  []string
+		expectErr bool
+	}{
+		{[]string{outboundEventChirpCreated}, []string{outboundEventChirpCreated}, false},
+		{[]string{outboundEventUserUpgraded, outboundEventChirpDeleted, outboundEventUserUpgraded}, []string{outboundEventUserUpgraded, outboundEventChirpDeleted}, false},
+		{[]string{}, nil, true},
+		{[]string{outboundEventChirpCreated, "chirp.liked"}, nil, true},
+	}
+
+	for _, test := range tests {
+		received, err := parseOutboundEvents(test.input)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Events '%v', expected error: %t, Got: '%v'", test.input, test.expectErr, err)
+			continue
+		}
+		if !slices.Equal(received, test.expected) {
+			t.Errorf("Expected '%v', received '%v'", test.expected, received)
+		}
+	}
+}
+
+func TestCanManageWebhookSubscription(t *testing.T) {
+	userID := uuid.New()
+	clientID := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+	byUser := database.WebhookSubscription{UserID: userID}
+	byApp := database.WebhookSubscription{UserID: userID, ClientID: clientID}
+
+	var tests = []struct {
+		name         string
+		subscription database.WebhookSubscription
+		userID       uuid.UUID
+		clientID     uuid.NullUUID
+		expected     bool
+	}{
+		{"user sees their own", byUser, userID, uuid.NullUUID{}, true},
+		{"user sees the app's", byApp, userID, uuid.NullUUID{}, true},
+		{"app sees its own", byApp, userID, clientID, true},
+		{"app does not see the user's", byUser, userID, clientID, false},
+		{"app does not see another app's", byApp, userID, uuid.NullUUID{UUID: uuid.New(), Valid: true}, false},
+		{"other user", byUser, uuid.New(), uuid.NullUUID{}, false},
+	}
+
+	for _, test := range tests {
+		received := canManageWebhookSubscription(test.subscription, test.userID, test.clientID)
+		if received != test.expected {
+			t.Errorf("%s: Expected %t, received %t", test.name, test.expected, received)
+		}
+	}
+}
+
+func TestNextWebhookDelivery(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		attempts       int32
+		expectedStatus string
+		expectedNext   time.Time
+	}{
+		{0, webhookDeliveryStatusPending, now.Add(webhookRetryBaseDelay)},
+		{1, webhookDeliveryStatusPending, now.Add(webhookRetryBaseDelay * 2)},
+		{3, webhookDeliveryStatusPending, now.Add(webhookRetryBaseDelay * 8)},
+		{webhookDeliveryMaxAttempts - 2, webhookDeliveryStatusPending, now.Add(min(webhookRetryBaseDelay<<(webhookDeliveryMaxAttempts-2), webhookRetryMaxDelay))},
+		{webhookDeliveryMaxAttempts - 1, webhookDeliveryStatusDead, now},
+	}
+
+	for _, test := range tests {
+		status, next := nextWebhookDelivery(test.attempts, now)
+		if status != test.expectedStatus || !next.Equal(test.expectedNext) {
+			t.Errorf("Attempts %d, expected '%s' at '%s', received '%s' at '%s'", test.attempts, test.expectedStatus, test.expectedNext, status, next)
+		}
+	}
+
+	if webhookRetryDelay(100) != webhookRetryMaxDelay {
+		t.Errorf("Expected: %s, Got: %s", webhookRetryMaxDelay, webhookRetryDelay(100))
+	}
+}
+
+func TestNewWebhookDeliveryResponse(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	delivery := database.WebhookDelivery{
+		ID:            uuid.New(),
+		EventType:     outboundEventChirpCreated,
+		Payload:       json.RawMessage(`{}`),
+		Status:        webhookDeliveryStatusPending,
+		Attempts:      1,
+		NextAttemptAt: now,
+		LastError:     sql.NullString{String: "receiver responded with status 500", Valid: true},
+	}
+	attempts := []database.WebhookDeliveryAttempt{
+		{DeliveryID: delivery.ID, StatusCode: sql.NullInt32{Int32: 500, Valid: true}, Error: delivery.LastError},
+		{DeliveryID: delivery.ID, Error: sql.NullString{String: "timeout", Valid: true}},
+	}
+
+	received := newWebhookDeliveryResponse(delivery, attempts)
+	if received.NextAttemptAt == nil || !received.NextAttemptAt.Equal(now) {
+		t.Errorf("Expected next attempt at '%s', received '%v'", now, received.NextAttemptAt)
+	}
+	if len(received.Log) != 2 {
+		t.Fatalf("Expected: %d, Got: %d", 2, len(received.Log))
+	}
+	if received.Log[0].StatusCode == nil || *received.Log[0].StatusCode != 500 {
+		t.Errorf("Expected status code 500, received '%v'", received.Log[0].StatusCode)
+	}
+	if received.Log[1].StatusCode != nil {
+		t.Errorf("Expected no status code, received '%d'", *received.Log[1].StatusCode)
+	}
+
+	delivery.Status = webhookDeliveryStatusDead
+	received = newWebhookDeliveryResponse(delivery, nil)
+	if received.NextAttemptAt != nil || received.Log == nil {
+		t.Errorf("Expected no next attempt and an empty log, received '%v' and '%v'", received.NextAttemptAt, received.Log)
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerCreateWebhookSubscriptionRejects(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	userID := uuid.New()
+
+	firstParty, err := auth.MakeJWT(userID, cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+	withoutScope, err := auth.MakeScopedJWT(userID, uuid.New(), auth.ScopeChirpsWrite, cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+
+	var tests = []struct {
+		token        string
+		body         string
+		expectedCode int
+	}{
+		{"", `{"url":"https://example.com/hooks","events":["chirp.created"]}`, http.StatusUnauthorized},
+		{withoutScope, `{"url":"https://example.com/hooks","events":["chirp.created"]}`, http.StatusForbidden},
+		{firstParty, `not json`, http.StatusBadRequest},
+		{firstParty, `{"url":"ftp://example.com/hooks","events":["chirp.created"]}`, http.StatusBadRequest},
+		{firstParty, `{"url":"https://example.com/hooks","events":[]}`, http.StatusBadRequest},
+		{firstParty, `{"url":"https://example.com/hooks","events":["chirp.liked"]}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/users/me/webhooks", strings.NewReader(test.body))
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+
+		cfg.handlerCreateWebhookSubscription(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Body '%s', expected: %d, Got: %d", test.body, test.expectedCode, actualCode)
+		}
+	}
+}
+
+func TestHandlerListWebhookDeliveriesRejects(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	token, err := auth.MakeJWT(uuid.New(), cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/users/me/webhooks/x/deliveries?limit=0", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.SetPathValue("id", uuid.NewString())
+	w := httptest.NewRecorder()
+
+	cfg.handlerListWebhookDeliveries(w, r)
+
+	_, actualCode := readResponse(w, t)
+	if actualCode != http.StatusBadRequest {
+		t.Errorf("Expected: %d, Got: %d", http.StatusBadRequest, actualCode)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// =====
+// TYPES
+// =====
+
+// the user's pinned chirps, in order, replacing any pinned before
+type PinnedChirpsRequest struct {
+	ChirpIDs []uuid.UUID `json:"chirp_ids"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// checks the ids can be pinned as they are, the plan's limit is checked separately
+func validatePinnedChirpIDs(chirpIDs []uuid.UUID) error {
+	for i, chirpID := range chirpIDs {
+		if slices.Contains(chirpIDs[:i], chirpID) {
+			return errors.New("each chirp can only be pinned once")
+		}
+	}
+
+	return nil
+}
+
+// flags the responses of chirps that are pinned
+func markPinnedChirps(chirpResponses []ChirpResponse, pins []database.ChirpPin) {
+	pinned := make(map[uuid.UUID]bool)
+	for _, pin := range pins {
+		pinned[pin.ChirpID] = true
+	}
+
+	for i := range chirpResponses {
+		chirpResponses[i].Pinned = pinned[chirpResponses[i].ID]
+	}
+}
+
+// responds with the user's pinned chirps, in order
+func (cfg *apiConfig) respondWithPinnedChirps(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	chirpRecords, err := cfg.db.ListPinnedChirpsByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing pinned chirps of user '%s': %s", userID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	chirpResponses, err := cfg.newChirpResponses(r.Context(), chirpRecords)
+	if err != nil {
+		log.Printf("Error getting chirp attachments: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	for i := range chirpResponses {
+		chirpResponses[i].Pinned = true
+	}
+
+	respondWithJSON(w, http.StatusOK, chirpResponses)
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// lists the chirps the user has pinned, in the order they chose
+func (cfg *apiConfig) handlerGetPinnedChirps(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found.")
+		return
+	}
+
+	cfg.respondWithPinnedChirps(w, r, userID)
+}
+
+// replaces the user's pinned chirps, up to the max_pinned_chirps of their plan
+// an empty list unpins them all
+func (cfg *apiConfig) handlerSetPinnedChirps(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	var pinRequest PinnedChirpsRequest
+	err = json.NewDecoder(r.Body).Decode(&pinRequest)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	err = validatePinnedChirpIDs(pinRequest.ChirpIDs)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp_ids: "+err.Error()+".")
+		return
+	}
+
+	entitlements, err := cfg.db.GetEntitlementsByUserID(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error getting entitlements of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if len(pinRequest.ChirpIDs) > int(entitlements.MaxPinnedChirps) {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("You can pin at most %d chirps.", entitlements.MaxPinnedChirps))
+		return
+	}
+
+	// the pins are replaced together, so they are never half updated
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if len(pinRequest.ChirpIDs) > 0 {
+		// only the user's own published chirps that are not deleted can be pinned
+		pinnable, err := qtx.CountPinnableChirps(r.Context(), database.CountPinnableChirpsParams{
+			Ids:    pinRequest.ChirpIDs,
+			UserID: tokenUUID,
+		})
+		if err != nil {
+			log.Printf("Unable to count pinnable chirps: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		if pinnable != int64(len(pinRequest.ChirpIDs)) {
+			respondWithError(w, http.StatusBadRequest, "Invalid chirp_ids: each must be one of your own published chirps.")
+			return
+		}
+	}
+
+	err = qtx.DeleteChirpPinsByUserID(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Unable to unpin chirps of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	if len(pinRequest.ChirpIDs) > 0 {
+		err = qtx.PinChirps(r.Context(), database.PinChirpsParams{
+			UserID:   tokenUUID,
+			ChirpIds: pinRequest.ChirpIDs,
+		})
+		if err != nil {
+			log.Printf("Unable to pin chirps of user '%s': %s", tokenUUID, err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Unable to commit pinned chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	cfg.respondWithPinnedChirps(w, r, tokenUUID)
+}
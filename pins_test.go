@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+func TestValidatePinnedChirpIDs(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+
+	var tests = []struct {
+		input     []uuid.UUID
+		expectErr bool
+	}{
+		{nil, false},
+		{[]uuid.UUID{first}, false},
+		{[]uuid.UUID{first, second}, false},
+		{[]uuid.UUID{first, second, first}, true},
+	}
+
+	for _, test := range tests {
+		err := validatePinnedChirpIDs(test.input)
+		if (err != nil) != test.expectErr {
+			t.Errorf("'%v', expected error: %t, Got: '%v'", test.input, test.expectErr, err)
+		}
+	}
+}
+
+func TestMarkPinnedChirps(t *testing.T) {
+	pinnedID, otherID := uuid.New(), uuid.New()
+	chirpResponses := []ChirpResponse{
+		{Chirp: database.Chirp{ID: otherID}},
+		{Chirp: database.Chirp{ID: pinnedID}},
+	}
+
+	markPinnedChirps(chirpResponses, []database.ChirpPin{{ChirpID: pinnedID, Position: 1}})
+	if chirpResponses[0].Pinned {
+		t.Errorf("Expected '%s' not to be pinned", otherID)
+	}
+	if !chirpResponses[1].Pinned {
+		t.Errorf("Expected '%s' to be pinned", pinnedID)
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerPinnedChirpsReject(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	token, err := auth.MakeJWT(uuid.New(), cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+	chirpID := uuid.NewString()
+
+	var tests = []struct {
+		name         string
+		handler      http.HandlerFunc
+		token        string
+		id           string
+		body         string
+		expectedCode int
+	}{
+		{"get bad id", cfg.handlerGetPinnedChirps, "", "not-a-uuid", "", http.StatusNotFound},
+		{"set without token", cfg.handlerSetPinnedChirps, "", "", `{"chirp_ids":[]}`, http.StatusUnauthorized},
+		{"set bad body", cfg.handlerSetPinnedChirps, token, "", `not json`, http.StatusBadRequest},
+		{"set duplicates", cfg.handlerSetPinnedChirps, token, "", `{"chirp_ids":["` + chirpID + `","` + chirpID + `"]}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/api/users/me/pinned", strings.NewReader(test.body))
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		r.SetPathValue("id", test.id)
+		w := httptest.NewRecorder()
+
+		test.handler(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("%s, expected: %d, Got: %d", test.name, test.expectedCode, actualCode)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	polkaEventUpgraded      = "user.upgraded"
+	polkaEventDowngraded    = "user.downgraded"
+	polkaEventRenewed       = "user.renewed"
+	polkaEventPaymentFailed = "user.payment_failed"
+	polkaEventRefunded      = "user.refunded"
+)
+
+// ================
+// GLOBAL VARIABLES
+// ================
+
+// the subscription event each polka event is
+var polkaSubscriptionEvents = map[string]string{
+	polkaEventUpgraded:      subscriptionEventStarted,
+	polkaEventRenewed:       subscriptionEventRenewed,
+	polkaEventPaymentFailed: subscriptionEventPaymentFailed,
+	polkaEventDowngraded:    subscriptionEventCanceled,
+	polkaEventRefunded:      subscriptionEventRefunded,
+}
+
+// =====
+// TYPES
+// =====
+
+type PolkaWebhookRequest struct {
+	// the same event sent again has the same id
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserID uuid.UUID `json:"user_id"`
+	} `json:"data"`
+}
+
+// polka, the payment processor chirpy red was first sold through
+type polkaProvider struct {
+	// the older static api key, only checked when there are no secrets
+	key     string
+	secrets []string
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+func (p polkaProvider) Name() string {
+	return webhookProviderPolka
+}
+
+// when signing secrets are set the body must be signed with one of them, and the nonce of the
+// delivery is returned to catch replays. Otherwise the older static api key (POLKA_KEY) is
+// checked, which has no replay protection, and the nonce is blank
+func (p polkaProvider) Verify(headers http.Header, body []byte, now time.Time) (string, error) {
+	if len(p.secrets) > 0 {
+		timestamp := headers.Get(webhookTimestampHeader)
+		err := auth.ValidateWebhookSignature(body, timestamp, headers.Get(webhookSignatureHeader), p.secrets, webhookTimestampTolerance, now)
+		if err != nil {
+			return "", err
+		}
+		return webhookNonce(timestamp, body), nil
+	}
+
+	if p.key == "" {
+		return "", errors.New("neither POLKA_WEBHOOK_SECRETS nor POLKA_KEY is set")
+	}
+
+	keyString, err := auth.GetAPIKey(headers)
+	if err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(keyString), []byte(p.key)) != 1 {
+		return "", errors.New("invalid polka api key")
+	}
+
+	return "", nil
+}
+
+func (p polkaProvider) Parse(body []byte) (webhookEvent, error) {
+	var webhookRequest PolkaWebhookRequest
+	err := json.Unmarshal(body, &webhookRequest)
+	if err != nil {
+		return webhookEvent{}, err
+	}
+
+	return webhookEvent{
+		ID:           webhookRequest.ID,
+		ProviderType: webhookRequest.Event,
+		Type:         polkaSubscriptionEvents[webhookRequest.Event],
+		UserID:       webhookRequest.Data.UserID,
+	}, nil
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// the url polka was first set up with, the same as /api/webhooks/polka
+func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request) {
+	cfg.receiveWebhook(w, r, cfg.webhookProviders[webhookProviderPolka])
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+)
+
+func TestPolkaProviderParse(t *testing.T) {
+	userID := uuid.MustParse("3f2b8c1e-6d4a-4b7e-9a35-2c1d0e8f7a61")
+
+	var tests = []struct {
+		fixture  string
+		expected webhookEvent
+	}{
+		{"upgraded", webhookEvent{"evt_polka_upgraded", polkaEventUpgraded, subscriptionEventStarted, userID}},
+		{"renewed", webhookEvent{"evt_polka_renewed", polkaEventRenewed, subscriptionEventRenewed, userID}},
+		{"payment_failed", webhookEvent{"evt_polka_payment_failed", polkaEventPaymentFailed, subscriptionEventPaymentFailed, userID}},
+		{"downgraded", webhookEvent{"evt_polka_downgraded", polkaEventDowngraded, subscriptionEventCanceled, userID}},
+		{"refunded", webhookEvent{"evt_polka_refunded", polkaEventRefunded, subscriptionEventRefunded, userID}},
+		{"unknown", webhookEvent{"evt_polka_unknown", "user.teleported", "", userID}},
+		{"without_id", webhookEvent{"", polkaEventUpgraded, subscriptionEventStarted, userID}},
+	}
+
+	for _, test := range tests {
+		received, err := polkaProvider{}.Parse(readWebhookFixture(t, webhookProviderPolka, test.fixture))
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", test.fixture, err)
+			continue
+		}
+		if received != test.expected {
+			t.Errorf("%s: Expected '%+v', received '%+v'", test.fixture, test.expected, received)
+		}
+	}
+
+	_, err := polkaProvider{}.Parse([]byte(`not json`))
+	if err == nil {
+		t.Errorf("Expected an error for a payload that is not json")
+	}
+}
+
+func TestPolkaProviderVerify(t *testing.T) {
+	body := readWebhookFixture(t, webhookProviderPolka, "upgraded")
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	signed := func(timestamp, signature string) http.Header {
+		headers := http.Header{}
+		headers.Set(webhookTimestampHeader, timestamp)
+		headers.Set(webhookSignatureHeader, signature)
+		return headers
+	}
+	withKey := func(key string) http.Header {
+		headers := http.Header{}
+		headers.Set("Authorization", "ApiKey "+key)
+		return headers
+	}
+
+	signing := polkaProvider{secrets: []string{"new", "old"}, key: "polka-key"}
+	keyOnly := polkaProvider{key: "polka-key"}
+	unset := polkaProvider{}
+
+	var tests = []struct {
+		name          string
+		provider      polkaProvider
+		headers       http.Header
+		expectErr     bool
+		expectedNonce string
+	}{
+		{"signed", signing, signed(timestamp, auth.SignWebhook(body, now, "old")), false, webhookNonce(timestamp, body)},
+		{"unknown secret", signing, signed(timestamp, auth.SignWebhook(body, now, "other")), true, ""},
+		{"expired", signing, signed("1700000000", auth.SignWebhook(body, time.Unix(1700000000, 0), "new")), true, ""},
+		{"key when signing", signing, withKey("polka-key"), true, ""},
+		{"key", keyOnly, withKey("polka-key"), false, ""},
+		{"wrong key", keyOnly, withKey("wrong-key"), true, ""},
+		{"unset", unset, withKey(""), true, ""},
+	}
+
+	for _, test := range tests {
+		nonce, err := test.provider.Verify(test.headers, body, now)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: Expected error: %t, received: %v", test.name, test.expectErr, err)
+			continue
+		}
+		if nonce != test.expectedNonce {
+			t.Errorf("%s: Expected '%s', received '%s'", test.name, test.expectedNonce, nonce)
+		}
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerPolkaWebhookRejects(t *testing.T) {
+	cfg := apiConfig{webhookProviders: newWebhookProviders(polkaProvider{key: "polka-key"})}
+
+	var tests = []struct {
+		key          string
+		body         string
+		expectedCode int
+	}{
+		{"", `{"event":"user.upgraded"}`, http.StatusUnauthorized},
+		{"wrong-key", `{"event":"user.upgraded"}`, http.StatusUnauthorized},
+		{"polka-key", `not json`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/polka/webhooks", strings.NewReader(test.body))
+		if test.key != "" {
+			r.Header.Set("Authorization", "ApiKey "+test.key)
+		}
+		w := httptest.NewRecorder()
+
+		cfg.handlerPolkaWebhook(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Body '%s', expected: %d, Got: %d", test.body, test.expectedCode, actualCode)
+		}
+	}
+}
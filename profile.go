@@ -0,0 +1,277 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+// longest values allowed, in characters (runes)
+const (
+	profileMaxDisplayName = 50
+	profileMaxBio         = 160
+	profileMaxLocation    = 30
+	profileMaxWebsite     = 100
+	profileMaxAvatarURL   = 500
+)
+
+// ================
+// GLOBAL VARIABLES
+// ================
+
+// 3 to 15 letters, digits or underscores
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,15}$`)
+
+// handles that could be mistaken for chirpy itself
+var reservedHandles = []string{"admin", "chirpy", "support", "help", "api"}
+
+// =====
+// TYPES
+// =====
+
+// everything here is public, so it must never include the email or password hash
+type PublicProfileResponse struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	Location    string    `json:"location"`
+	Website     string    `json:"website"`
+	ChirpCount  int64     `json:"chirp_count"`
+	// chirpy has no follows yet, so this is always 0
+	FollowerCount int64 `json:"follower_count"`
+}
+
+// every field is optional, nil fields are left unchanged and blank fields are cleared
+type ProfileUpdateRequest struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"`
+	Location    *string `json:"location"`
+	Website     *string `json:"website"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// only absolute http(s) urls, so links in profiles can not run scripts
+func validateProfileURL(field, rawURL string, maxLength int) error {
+	if rawURL == "" {
+		return nil
+	}
+	if utf8.RuneCountInString(rawURL) > maxLength {
+		return fmt.Errorf("%s must be at most %d characters", field, maxLength)
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%s must be an http or https url", field)
+	}
+
+	return nil
+}
+
+// checks every profile field, returning the first problem found
+func validateProfile(profile database.UpsertProfileParams) error {
+	if profile.Handle.Valid {
+		if !handlePattern.MatchString(profile.Handle.String) {
+			return errors.New("handle must be 3 to 15 letters, digits or underscores")
+		}
+		if slices.Contains(reservedHandles, strings.ToLower(profile.Handle.String)) {
+			return errors.New("handle is reserved")
+		}
+	}
+
+	for _, field := range []struct {
+		name      string
+		value     string
+		maxLength int
+	}{
+		{"display_name", profile.DisplayName, profileMaxDisplayName},
+		{"bio", profile.Bio, profileMaxBio},
+		{"location", profile.Location, profileMaxLocation},
+	} {
+		if utf8.RuneCountInString(field.value) > field.maxLength {
+			return fmt.Errorf("%s must be at most %d characters", field.name, field.maxLength)
+		}
+	}
+
+	err := validateProfileURL("website", profile.Website, profileMaxWebsite)
+	if err != nil {
+		return err
+	}
+
+	return validateProfileURL("avatar_url", profile.AvatarUrl, profileMaxAvatarURL)
+}
+
+// applies the fields present in the request to the stored profile
+func applyProfileUpdate(profile *database.UpsertProfileParams, update ProfileUpdateRequest) {
+	if update.Handle != nil {
+		handle := strings.TrimPrefix(strings.TrimSpace(*update.Handle), "@")
+		profile.Handle = sql.NullString{String: handle, Valid: handle != ""}
+	}
+
+	for _, field := range []struct {
+		value  *string
+		target *string
+	}{
+		{update.DisplayName, &profile.DisplayName},
+		{update.Bio, &profile.Bio},
+		{update.AvatarURL, &profile.AvatarUrl},
+		{update.Location, &profile.Location},
+		{update.Website, &profile.Website},
+	} {
+		if field.value != nil {
+			*field.target = strings.TrimSpace(*field.value)
+		}
+	}
+}
+
+func newPublicProfileResponse(profileRecord database.GetPublicProfileByUserIDRow) PublicProfileResponse {
+	return PublicProfileResponse{
+		ID:          profileRecord.ID,
+		CreatedAt:   profileRecord.CreatedAt,
+		IsChirpyRed: profileRecord.IsChirpyRed,
+		Handle:      profileRecord.Handle.String,
+		DisplayName: profileRecord.DisplayName.String,
+		Bio:         profileRecord.Bio.String,
+		AvatarURL:   profileRecord.AvatarUrl.String,
+		Location:    profileRecord.Location.String,
+		Website:     profileRecord.Website.String,
+		ChirpCount:  profileRecord.ChirpCount,
+	}
+}
+
+// responds with the user's public profile
+// users pending deletion are treated as not found
+func (cfg *apiConfig) respondWithPublicProfile(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	profileRecord, err := cfg.db.GetPublicProfileByUserID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting public profile: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newPublicProfileResponse(profileRecord))
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+func (cfg *apiConfig) handlerGetUserProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found.")
+		return
+	}
+
+	cfg.respondWithPublicProfile(w, r, userID)
+}
+
+func (cfg *apiConfig) handlerGetUserProfileByHandle(w http.ResponseWriter, r *http.Request) {
+	handle := strings.TrimPrefix(r.PathValue("handle"), "@")
+	if !handlePattern.MatchString(handle) {
+		respondWithError(w, http.StatusNotFound, "User not found.")
+		return
+	}
+
+	userID, err := cfg.db.GetUserIDByHandle(r.Context(), handle)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user by handle: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	cfg.respondWithPublicProfile(w, r, userID)
+}
+
+// partially updates the user's public profile
+func (cfg *apiConfig) handlerUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeUsersWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	var updateRequest ProfileUpdateRequest
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&updateRequest)
+	if err != nil {
+		log.Printf("Error decoding update profile request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	// users without a profile yet start from a blank one
+	profile := database.UpsertProfileParams{UserID: tokenUUID}
+	profileRecord, err := cfg.db.GetProfileByUserID(r.Context(), tokenUUID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting profile: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if err == nil {
+		profile = database.UpsertProfileParams{
+			UserID:      profileRecord.UserID,
+			Handle:      profileRecord.Handle,
+			DisplayName: profileRecord.DisplayName,
+			Bio:         profileRecord.Bio,
+			AvatarUrl:   profileRecord.AvatarUrl,
+			Location:    profileRecord.Location,
+			Website:     profileRecord.Website,
+		}
+	}
+
+	applyProfileUpdate(&profile, updateRequest)
+	err = validateProfile(profile)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid profile: "+err.Error()+".")
+		return
+	}
+
+	err = cfg.db.UpsertProfile(r.Context(), profile)
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "Handle is already taken.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating profile for '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("Updated profile for user '%s'.", tokenUUID)
+	cfg.respondWithPublicProfile(w, r, tokenUUID)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+func TestValidateProfile(t *testing.T) {
+	handle := func(h string) sql.NullString {
+		return sql.NullString{String: h, Valid: true}
+	}
+
+	var tests = []struct {
+		profile   database.UpsertProfileParams
+		expectErr bool
+	}{
+		{database.UpsertProfileParams{}, false},
+		{database.UpsertProfileParams{Handle: handle("chirp_fan_99")}, false},
+		{database.UpsertProfileParams{Handle: handle("ab")}, true},
+		{database.UpsertProfileParams{Handle: handle("much_too_long_handle")}, true},
+		{database.UpsertProfileParams{Handle: handle("no spaces")}, true},
+		{database.UpsertProfileParams{Handle: handle("Admin")}, true},
+		{database.UpsertProfileParams{DisplayName: strings.Repeat("é", profileMaxDisplayName)}, false},
+		{database.UpsertProfileParams{DisplayName: strings.Repeat("é", profileMaxDisplayName+1)}, true},
+		{database.UpsertProfileParams{Bio: strings.Repeat("a", profileMaxBio+1)}, true},
+		{database.UpsertProfileParams{Location: strings.Repeat("a", profileMaxLocation+1)}, true},
+		{database.UpsertProfileParams{Website: "https://example.com/me"}, false},
+		{database.UpsertProfileParams{Website: "javascript:alert(1)"}, true},
+		{database.UpsertProfileParams{Website: "example.com"}, true},
+		{database.UpsertProfileParams{AvatarUrl: "http://example.com/avatar.png"}, false},
+		{database.UpsertProfileParams{AvatarUrl: "data:image/png;base64,AAAA"}, true},
+	}
+
+	for _, test := range tests {
+		err := validateProfile(test.profile)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Profile '%v', expected error: %t, Got: '%v'", test.profile, test.expectErr, err)
+		}
+	}
+}
+
+func TestApplyProfileUpdate(t *testing.T) {
+	profile := database.UpsertProfileParams{
+		Handle:      sql.NullString{String: "old_handle", Valid: true},
+		DisplayName: "Old Name",
+		Bio:         "old bio",
+	}
+
+	newHandle := " @new_handle "
+	newBio := ""
+	applyProfileUpdate(&profile, ProfileUpdateRequest{
+		Handle: &newHandle,
+		Bio:    &newBio,
+	})
+
+	if !profile.Handle.Valid || profile.Handle.String != "new_handle" {
+		t.Errorf("Expected '%s', received '%v'", "new_handle", profile.Handle)
+	}
+	if profile.DisplayName != "Old Name" {
+		t.Errorf("Expected '%s', received '%s'", "Old Name", profile.DisplayName)
+	}
+	if profile.Bio != "" {
+		t.Errorf("Expected '%s', received '%s'", "", profile.Bio)
+	}
+
+	blank := ""
+	applyProfileUpdate(&profile, ProfileUpdateRequest{Handle: &blank})
+	if profile.Handle.Valid {
+		t.Errorf("Expected handle to be cleared, received '%v'", profile.Handle)
+	}
+}
+
+// the public profile must never leak private account fields
+func TestPublicProfileResponseFields(t *testing.T) {
+	data, err := json.Marshal(newPublicProfileResponse(database.GetPublicProfileByUserIDRow{ID: uuid.New()}))
+	if err != nil {
+		t.Fatalf("unable to marshal profile: %s", err)
+	}
+
+	for _, field := range []string{"email", "hashed_password", "password"} {
+		if strings.Contains(string(data), `"`+field+`"`) {
+			t.Errorf("Expected no '%s' field, received '%s'", field, data)
+		}
+	}
+	if !strings.Contains(string(data), `"follower_count":0`) {
+		t.Errorf("Expected a follower_count of 0, received '%s'", data)
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerGetUserProfileNotFound(t *testing.T) {
+	cfg := apiConfig{}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/users/not-a-uuid", nil)
+	r.SetPathValue("id", "not-a-uuid")
+	w := httptest.NewRecorder()
+	cfg.handlerGetUserProfile(w, r)
+	if _, code := readResponse(w, t); code != http.StatusNotFound {
+		t.Errorf("Expected: %d, Got: %d", http.StatusNotFound, code)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/users/by-handle/a", nil)
+	r.SetPathValue("handle", "a")
+	w = httptest.NewRecorder()
+	cfg.handlerGetUserProfileByHandle(w, r)
+	if _, code := readResponse(w, t); code != http.StatusNotFound {
+		t.Errorf("Expected: %d, Got: %d", http.StatusNotFound, code)
+	}
+}
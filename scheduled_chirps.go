@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	// time zones are looked up from the binary, so they work on hosts without a zoneinfo database
+	_ "time/tzdata"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+	"github.com/nicholasss/chirpy/internal/jobs"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	// chirps can be scheduled up to a year ahead
+	maxScheduleAhead = time.Duration(time.Hour * 24 * 365)
+	// chirps waiting to be published, per user
+	maxScheduledChirpsPerUser = 100
+
+	// a publish_at given without a UTC offset, read in its time_zone
+	publishAtLocalLayout = "2006-01-02T15:04:05"
+)
+
+// =====
+// TYPES
+// =====
+
+// publishes a scheduled chirp, once it is due
+// the chirp may have been rescheduled or cancelled since, so it is checked again
+type publishChirpJob struct {
+	ChirpID uuid.UUID `json:"chirp_id"`
+}
+
+func (publishChirpJob) Kind() string { return "chirps.publish" }
+
+type ChirpScheduleRequest struct {
+	PublishAt string `json:"publish_at"`
+	TimeZone  string `json:"time_zone"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// reads a publish time, which must say which time zone it is in:
+// either RFC 3339 with a UTC offset, or a local time with the IANA time zone it is in
+// a local time that is skipped or repeated when the clocks change is refused, as it is unclear
+// the time is returned in its time zone, or its offset when there is none
+func parsePublishAt(raw, timeZone string) (time.Time, error) {
+	var loc *time.Location
+	if timeZone != "" {
+		// 'Local' is the server's own time zone
+		if timeZone == "Local" {
+			return time.Time{}, fmt.Errorf("unknown time_zone '%s'", timeZone)
+		}
+		var err error
+		loc, err = time.LoadLocation(timeZone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown time_zone '%s'", timeZone)
+		}
+	}
+
+	publishAt, err := time.Parse(time.RFC3339, raw)
+	if err == nil {
+		if loc == nil {
+			return publishAt, nil
+		}
+
+		// both were given, they must agree
+		_, givenOffset := publishAt.Zone()
+		inZone := publishAt.In(loc)
+		_, zoneOffset := inZone.Zone()
+		if givenOffset != zoneOffset {
+			return time.Time{}, fmt.Errorf("publish_at has a UTC offset that %s does not have at that time", timeZone)
+		}
+		return inZone, nil
+	}
+
+	if _, err := time.Parse(publishAtLocalLayout, raw); err != nil {
+		return time.Time{}, errors.New("publish_at must be a time such as '2025-03-01T09:00:00+01:00'")
+	}
+	if loc == nil {
+		return time.Time{}, errors.New("publish_at must include a UTC offset, or time_zone must be set")
+	}
+
+	publishAt, err = time.ParseInLocation(publishAtLocalLayout, raw, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// times skipped when the clocks go forward are moved past the gap
+	if publishAt.Format(publishAtLocalLayout) != raw {
+		return time.Time{}, fmt.Errorf("publish_at does not exist in %s, the clocks change then", timeZone)
+	}
+	if isAmbiguousLocalTime(publishAt) {
+		return time.Time{}, fmt.Errorf("publish_at happens twice in %s, the clocks change then, give it with a UTC offset", timeZone)
+	}
+
+	return publishAt, nil
+}
+
+// reports if the wall clock time also happens at another instant in its time zone,
+// as it does when the clocks go back
+func isAmbiguousLocalTime(t time.Time) bool {
+	_, offset := t.Zone()
+	for _, nearby := range []time.Time{t.Add(-12 * time.Hour), t.Add(12 * time.Hour)} {
+		_, nearbyOffset := nearby.Zone()
+		if nearbyOffset == offset {
+			continue
+		}
+
+		other := t.Add(time.Duration(offset-nearbyOffset) * time.Second)
+		if other.Format(publishAtLocalLayout) == t.Format(publishAtLocalLayout) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reads and checks the schedule of a chirp, returning the time it is published and its time zone
+func parseChirpSchedule(request ChirpScheduleRequest, now time.Time) (time.Time, sql.NullString, error) {
+	publishAt, err := parsePublishAt(request.PublishAt, request.TimeZone)
+	if err != nil {
+		return time.Time{}, sql.NullString{}, err
+	}
+	if !publishAt.After(now) {
+		return time.Time{}, sql.NullString{}, errors.New("publish_at must be in the future")
+	}
+	if publishAt.Sub(now) > maxScheduleAhead {
+		return time.Time{}, sql.NullString{}, errors.New("publish_at must be within a year")
+	}
+
+	return publishAt.UTC(), sql.NullString{String: request.TimeZone, Valid: request.TimeZone != ""}, nil
+}
+
+// shows when the chirp will be published, in the time zone it was scheduled in
+func setChirpSchedule(response *ChirpResponse, schedule database.ChirpSchedule) {
+	publishAt := schedule.PublishAt.UTC()
+	if schedule.TimeZone.Valid {
+		loc, err := time.LoadLocation(schedule.TimeZone.String)
+		if err == nil {
+			publishAt = publishAt.In(loc)
+		}
+	}
+
+	response.PublishAt = &publishAt
+	response.TimeZone = schedule.TimeZone.String
+}
+
+// saves the chirp's schedule and enqueues publishing it, as part of the transaction
+func scheduleChirp(ctx context.Context, qtx *database.Queries, chirpID uuid.UUID, publishAt time.Time, timeZone sql.NullString) (database.ChirpSchedule, error) {
+	schedule, err := qtx.CreateChirpSchedule(ctx, database.CreateChirpScheduleParams{
+		ChirpID:   chirpID,
+		PublishAt: publishAt,
+		TimeZone:  timeZone,
+	})
+	if err != nil {
+		return database.ChirpSchedule{}, err
+	}
+
+	_, err = jobs.Enqueue(ctx, qtx, publishChirpJob{ChirpID: chirpID}, jobs.Options{RunAt: publishAt})
+	if err != nil {
+		return database.ChirpSchedule{}, err
+	}
+
+	return schedule, nil
+}
+
+// publishes the chirp if its schedule is due, fetches its link previews, and tells webhook subscribers it was created
+// nothing is done when it was cancelled, already published, or rescheduled to later
+func (cfg *apiConfig) publishScheduledChirp(ctx context.Context, job publishChirpJob) error {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	_, err = qtx.DeleteDueChirpSchedule(ctx, database.DeleteDueChirpScheduleParams{
+		ChirpID:   job.ChirpID,
+		PublishAt: time.Now().UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	chirpRecord, err := qtx.PublishChirp(ctx, job.ChirpID)
+	if err != nil {
+		return err
+	}
+
+	// links are saved afresh, in case some were saved when the chirp was scheduled
+	err = qtx.DeleteChirpLinksByChirpID(ctx, chirpRecord.ID)
+	if err != nil {
+		return err
+	}
+	err = saveChirpLinks(ctx, qtx, chirpRecord.ID, chirpRecord.Body)
+	if err != nil {
+		return err
+	}
+
+	err = enqueueOutboundWebhook(ctx, qtx, chirpRecord.UserID, outboundEventChirpCreated, newChirpWebhookData(chirpRecord))
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Published scheduled chirp '%s'.", chirpRecord.ID)
+	return nil
+}
+
+// the scheduled chirp of the user, replying with an error when it can not be found
+// chirps of other users are not found either, so their ids are not revealed
+func (cfg *apiConfig) getOwnScheduledChirp(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.Chirp, bool) {
+	chirpID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Scheduled chirp not found.")
+		return database.Chirp{}, false
+	}
+
+	chirpRecord, err := cfg.db.GetScheduledChirpByID(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && chirpRecord.UserID != userID) {
+		respondWithError(w, http.StatusNotFound, "Scheduled chirp not found.")
+		return database.Chirp{}, false
+	}
+	if err != nil {
+		log.Printf("Error getting scheduled chirp '%s': %s", chirpID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return database.Chirp{}, false
+	}
+
+	return chirpRecord, true
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// lists the user's chirps that are waiting to be published, the soonest first
+// they are not public yet, so only apps that can post chirps see them
+func (cfg *apiConfig) handlerListScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpRecords, err := cfg.db.ListScheduledChirpsByUserID(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error listing scheduled chirps of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	chirpIDs := make([]uuid.UUID, 0, len(chirpRecords))
+	for _, chirpRecord := range chirpRecords {
+		chirpIDs = append(chirpIDs, chirpRecord.ID)
+	}
+	schedules, err := cfg.db.ListChirpSchedulesByChirpIDs(r.Context(), chirpIDs)
+	if err != nil {
+		log.Printf("Error listing chirp schedules: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	chirpResponses, err := cfg.newChirpResponses(r.Context(), chirpRecords)
+	if err != nil {
+		log.Printf("Error getting chirp attachments: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	byChirp := make(map[uuid.UUID]database.ChirpSchedule)
+	for _, schedule := range schedules {
+		byChirp[schedule.ChirpID] = schedule
+	}
+	for i := range chirpResponses {
+		setChirpSchedule(&chirpResponses[i], byChirp[chirpResponses[i].ID])
+	}
+
+	respondWithJSON(w, http.StatusOK, chirpResponses)
+}
+
+// moves a scheduled chirp to another time, for users whose plan allows scheduling
+func (cfg *apiConfig) handlerRescheduleChirp(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	var scheduleRequest ChirpScheduleRequest
+	err = json.NewDecoder(r.Body).Decode(&scheduleRequest)
+	if err != nil {
+		log.Printf("Error decoding reschedule chirp request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	publishAt, timeZone, err := parseChirpSchedule(scheduleRequest, time.Now().UTC())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid publish_at: "+err.Error()+".")
+		return
+	}
+
+	chirpRecord, ok := cfg.getOwnScheduledChirp(w, r, tokenUUID)
+	if !ok {
+		return
+	}
+
+	entitlements, err := cfg.db.GetEntitlementsByUserID(r.Context(), tokenUUID)
+	if err != nil {
+		log.Printf("Error getting entitlements of user '%s': %s", tokenUUID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if !entitlements.CanScheduleChirps {
+		respondWithError(w, http.StatusForbidden, "Scheduling chirps is not included in your plan.")
+		return
+	}
+
+	// the job for the old time finds the chirp not yet due, and leaves it
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	schedule, err := qtx.RescheduleChirp(r.Context(), database.RescheduleChirpParams{
+		ChirpID:   chirpRecord.ID,
+		PublishAt: publishAt,
+		TimeZone:  timeZone,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// published in the meantime
+		respondWithError(w, http.StatusNotFound, "Scheduled chirp not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to reschedule chirp '%s': %s", chirpRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	_, err = jobs.Enqueue(r.Context(), qtx, publishChirpJob{ChirpID: chirpRecord.ID}, jobs.Options{RunAt: publishAt})
+	if err != nil {
+		log.Printf("Unable to queue publishing chirp '%s': %s", chirpRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Unable to commit chirp reschedule: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	chirpResponses, err := cfg.newChirpResponses(r.Context(), []database.Chirp{chirpRecord})
+	if err != nil {
+		log.Printf("Error getting chirp attachments: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	setChirpSchedule(&chirpResponses[0], schedule)
+
+	log.Printf("Rescheduled chirp '%s' for %s.", chirpRecord.ID, publishAt.Format(time.RFC3339))
+	respondWithJSON(w, http.StatusOK, chirpResponses[0])
+}
+
+// cancels a scheduled chirp, deleting it and its attachments
+// allowed on any plan, so chirps scheduled before a downgrade can still be cancelled
+func (cfg *apiConfig) handlerCancelScheduledChirp(w http.ResponseWriter, r *http.Request) {
+	tokenUUID, err := cfg.authenticateRequest(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Unable to validate presented token: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	chirpRecord, ok := cfg.getOwnScheduledChirp(w, r, tokenUUID)
+	if !ok {
+		return
+	}
+
+	attachments, err := cfg.db.ListAttachmentsByChirpIDs(r.Context(), []uuid.UUID{chirpRecord.ID})
+	if err != nil {
+		log.Printf("Unable to list attachments of chirp '%s': %s", chirpRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	// its schedule goes with it, the publish job then finds nothing to do
+	// it was never published, so there is no webhook
+	deleted, err := cfg.db.DeleteScheduledChirp(r.Context(), chirpRecord.ID)
+	if err != nil {
+		log.Printf("Unable to delete scheduled chirp '%s': %s", chirpRecord.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if deleted == 0 {
+		// published in the meantime
+		respondWithError(w, http.StatusNotFound, "Scheduled chirp not found.")
+		return
+	}
+
+	cfg.deleteAttachments(r.Context(), attachments)
+
+	log.Printf("Cancelled scheduled chirp '%s'.", chirpRecord.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
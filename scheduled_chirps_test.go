@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+func TestParsePublishAt(t *testing.T) {
+	var tests = []struct {
+		publishAt string
+		timeZone  string
+		expected  time.Time
+		expectErr bool
+	}{
+		{"2026-03-01T09:00:00+01:00", "", time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC), false},
+		{"2026-03-01T09:00:00Z", "", time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC), false},
+		{"2026-03-01T09:00:00", "America/New_York", time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC), false},
+		{"2026-03-01T09:00:00-05:00", "America/New_York", time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC), false},
+		// the offset picks which of the repeated times is meant
+		{"2026-11-01T01:30:00-04:00", "America/New_York", time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), false},
+		{"2026-11-01T01:30:00-05:00", "America/New_York", time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC), false},
+		// no time zone at all
+		{"2026-03-01T09:00:00", "", time.Time{}, true},
+		// an offset the time zone does not have then
+		{"2026-03-01T09:00:00+01:00", "America/New_York", time.Time{}, true},
+		// skipped when the clocks go forward
+		{"2026-03-08T02:30:00", "America/New_York", time.Time{}, true},
+		// happens twice when the clocks go back
+		{"2026-11-01T01:30:00", "America/New_York", time.Time{}, true},
+		{"2026-03-01T09:00:00", "Mars/Olympus_Mons", time.Time{}, true},
+		{"2026-03-01T09:00:00", "Local", time.Time{}, true},
+		{"2026-03-01 09:00", "UTC", time.Time{}, true},
+		{"tomorrow", "", time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		received, err := parsePublishAt(test.publishAt, test.timeZone)
+		if (err != nil) != test.expectErr {
+			t.Errorf("'%s' in '%s', expected error: %t, Got: '%v'", test.publishAt, test.timeZone, test.expectErr, err)
+			continue
+		}
+		if !received.Equal(test.expected) {
+			t.Errorf("'%s' in '%s', expected '%s', received '%s'", test.publishAt, test.timeZone, test.expected, received)
+		}
+	}
+}
+
+func TestParseChirpSchedule(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		request          ChirpScheduleRequest
+		expectedTimeZone sql.NullString
+		expectErr        bool
+	}{
+		{ChirpScheduleRequest{"2026-03-02T09:00:00", "Europe/Berlin"}, sql.NullString{String: "Europe/Berlin", Valid: true}, false},
+		{ChirpScheduleRequest{"2026-03-02T09:00:00Z", ""}, sql.NullString{}, false},
+		{ChirpScheduleRequest{"2026-03-01T12:00:00Z", ""}, sql.NullString{}, true},
+		{ChirpScheduleRequest{"2026-03-01T09:00:00Z", ""}, sql.NullString{}, true},
+		{ChirpScheduleRequest{"2027-03-02T09:00:00Z", ""}, sql.NullString{}, true},
+	}
+
+	for _, test := range tests {
+		publishAt, timeZone, err := parseChirpSchedule(test.request, now)
+		if (err != nil) != test.expectErr {
+			t.Errorf("'%+v', expected error: %t, Got: '%v'", test.request, test.expectErr, err)
+			continue
+		}
+		if err == nil && publishAt.Location() != time.UTC {
+			t.Errorf("Expected the publish time in UTC, received '%s'", publishAt)
+		}
+		if timeZone != test.expectedTimeZone {
+			t.Errorf("Expected '%v', received '%v'", test.expectedTimeZone, timeZone)
+		}
+	}
+}
+
+func TestSetChirpSchedule(t *testing.T) {
+	publishAt := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+
+	response := ChirpResponse{}
+	setChirpSchedule(&response, database.ChirpSchedule{PublishAt: publishAt, TimeZone: sql.NullString{String: "Europe/Berlin", Valid: true}})
+	if response.PublishAt == nil || response.PublishAt.Format(time.RFC3339) != "2026-03-02T09:00:00+01:00" {
+		t.Errorf("Expected '%s', received '%v'", "2026-03-02T09:00:00+01:00", response.PublishAt)
+	}
+	if response.TimeZone != "Europe/Berlin" {
+		t.Errorf("Expected '%s', received '%s'", "Europe/Berlin", response.TimeZone)
+	}
+
+	response = ChirpResponse{}
+	setChirpSchedule(&response, database.ChirpSchedule{PublishAt: publishAt})
+	if response.PublishAt == nil || response.PublishAt.Format(time.RFC3339) != "2026-03-02T08:00:00Z" {
+		t.Errorf("Expected '%s', received '%v'", "2026-03-02T08:00:00Z", response.PublishAt)
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerRescheduleChirpRejects(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	token, err := auth.MakeJWT(uuid.New(), cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+
+	var tests = []struct {
+		token        string
+		body         string
+		expectedCode int
+	}{
+		{"", `{"publish_at":"2099-03-01T09:00:00Z"}`, http.StatusUnauthorized},
+		{token, `not json`, http.StatusBadRequest},
+		{token, `{"publish_at":"2099-03-01T09:00:00"}`, http.StatusBadRequest},
+		{token, `{"publish_at":"2020-03-01T09:00:00Z"}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPatch, "/api/chirps/scheduled/x", strings.NewReader(test.body))
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		r.SetPathValue("id", uuid.NewString())
+		w := httptest.NewRecorder()
+
+		cfg.handlerRescheduleChirp(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Body '%s', expected: %d, Got: %d", test.body, test.expectedCode, actualCode)
+		}
+	}
+}
+
+func TestHandlerCancelScheduledChirpRejects(t *testing.T) {
+	cfg := apiConfig{jwtSecret: "secret", pendingDeletions: fakePendingDeletions{}}
+	token, err := auth.MakeJWT(uuid.New(), cfg.jwtSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to create JWT: %s", err)
+	}
+
+	var tests = []struct {
+		token        string
+		id           string
+		expectedCode int
+	}{
+		{"", uuid.NewString(), http.StatusUnauthorized},
+		{token, "not-a-uuid", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodDelete, "/api/chirps/scheduled/"+test.id, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		r.SetPathValue("id", test.id)
+		w := httptest.NewRecorder()
+
+		cfg.handlerCancelScheduledChirp(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Id '%s', expected: %d, Got: %d", test.id, test.expectedCode, actualCode)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+-- name: CreateAttachment :one
+insert into attachments (
+  id, created_at, user_id, storage_key, content_type, size_bytes, width, height
+) values (
+  $1, now(), $2, $3, $4, $5, $6, $7
+)
+returning *;
+
+-- name: AttachMediaToChirp :execrows
+update attachments
+set chirp_id = sqlc.arg(chirp_id)
+where id = any(sqlc.arg(ids)::uuid[])
+  and user_id = sqlc.arg(user_id)
+  and chirp_id is null;
+
+-- name: ListAttachmentsByChirpIDs :many
+select * from attachments
+where chirp_id = any(sqlc.arg(chirp_ids)::uuid[])
+order by created_at asc, id asc;
+
+-- name: ListUnattachedAttachments :many
+select * from attachments
+where chirp_id is null
+  and created_at < $1
+order by created_at asc
+limit 100;
+
+-- name: ListAttachmentsOfUsersDueForDeletion :many
+select * from attachments
+where user_id in (
+  select id from users
+  where delete_after is not null
+    and delete_after <= now()
+);
+
+-- name: DeleteAttachmentByID :exec
+delete from attachments
+where id = $1;
+
+-- name: GetAttachmentByID :one
+select * from attachments
+where id = $1;
+
+-- name: GetServableAttachmentByID :one
+select * from attachments
+where id = $1
+  and (chirp_id is null or chirp_id not in (select id from chirps where deleted_at is not null));
+
+-- name: IsMediaOfDeletedChirp :one
+select exists (
+  select 1 from attachments
+  join chirps on chirps.id = attachments.chirp_id
+  left join attachment_variants on attachment_variants.attachment_id = attachments.id
+  where chirps.deleted_at is not null
+    and (attachments.storage_key = $1 or attachment_variants.storage_key = $1)
+);
+
+-- name: ListAttachmentsOfChirpsDeletedBefore :many
+select * from attachments
+where chirp_id in (
+  select id from chirps
+  where deleted_at is not null
+    and deleted_at < $1
+);
+
+-- name: UpsertAttachmentVariant :one
+insert into attachment_variants (
+  attachment_id, size, created_at, storage_key, content_type, size_bytes, width, height
+) values (
+  $1, $2, now(), $3, $4, $5, $6, $7
+)
+on conflict (attachment_id, size) do update
+set
+  created_at = now(),
+  storage_key = excluded.storage_key,
+  content_type = excluded.content_type,
+  size_bytes = excluded.size_bytes,
+  width = excluded.width,
+  height = excluded.height
+returning *;
+
+-- name: ListAttachmentVariantsByAttachmentIDs :many
+select * from attachment_variants
+where attachment_id = any(sqlc.arg(attachment_ids)::uuid[])
+order by attachment_id asc, size asc;
+
+-- name: CountAttachmentsByUserSince :one
+select count(*) from attachments
+where user_id = $1
+  and created_at > $2;
@@ -0,0 +1,32 @@
+-- name: ListPinnedChirpsByUserID :many
+select chirps.* from chirps
+join chirp_pins on chirp_pins.chirp_id = chirps.id
+where chirp_pins.user_id = $1
+  and chirps.deleted_at is null
+  and chirps.user_id not in (select id from users where delete_after is not null)
+order by chirp_pins.position asc;
+
+-- name: ListChirpPinsByUserID :many
+select * from chirp_pins
+where user_id = $1
+order by position asc;
+
+-- name: CountPinnableChirps :one
+select count(*) from chirps
+where id = any(sqlc.arg(ids)::uuid[])
+  and user_id = sqlc.arg(user_id)
+  and deleted_at is null
+  and id not in (select chirp_id from chirp_schedules);
+
+-- name: DeleteChirpPinsByUserID :exec
+delete from chirp_pins
+where user_id = $1;
+
+-- name: PinChirps :exec
+insert into chirp_pins (chirp_id, user_id, created_at, position)
+select pins.chirp_id, sqlc.arg(user_id), now(), pins.position
+from unnest(sqlc.arg(chirp_ids)::uuid[]) with ordinality as pins (chirp_id, position);
+
+-- name: DeleteChirpPinByChirpID :exec
+delete from chirp_pins
+where chirp_id = $1;
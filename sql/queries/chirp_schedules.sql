@@ -0,0 +1,47 @@
+-- name: CreateChirpSchedule :one
+insert into chirp_schedules (
+  chirp_id, created_at, updated_at, publish_at, time_zone
+) values (
+  $1, now(), now(), $2, $3
+)
+returning *;
+
+-- name: GetScheduledChirpByID :one
+select chirps.* from chirps
+join chirp_schedules on chirp_schedules.chirp_id = chirps.id
+where chirps.id = $1;
+
+-- name: ListScheduledChirpsByUserID :many
+select chirps.* from chirps
+join chirp_schedules on chirp_schedules.chirp_id = chirps.id
+where chirps.user_id = $1
+order by chirp_schedules.publish_at asc;
+
+-- name: ListChirpSchedulesByChirpIDs :many
+select * from chirp_schedules
+where chirp_id = any(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: CountChirpSchedulesByUserID :one
+select count(*) from chirp_schedules
+join chirps on chirps.id = chirp_schedules.chirp_id
+where chirps.user_id = $1;
+
+-- name: RescheduleChirp :one
+update chirp_schedules
+set
+  publish_at = $2,
+  time_zone = $3,
+  updated_at = now()
+where chirp_id = $1
+returning *;
+
+-- name: DeleteDueChirpSchedule :one
+delete from chirp_schedules
+where chirp_id = $1
+  and publish_at <= $2
+returning *;
+
+-- name: DeleteScheduledChirp :execrows
+delete from chirps
+where id = $1
+  and id in (select chirp_id from chirp_schedules);
@@ -1,8 +1,8 @@
 -- name: CreateChirp :one
 insert into chirps (
-	id, created_at, updated_at, body, user_id
+	id, created_at, updated_at, body, user_id, in_reply_to
 ) values (
-	gen_random_uuid(), now(), now(), $1, $2
+	gen_random_uuid(), now(), now(), $1, $2, $3
 )
 returning *;
 
@@ -11,17 +11,99 @@ delete from chirps;
 
 -- name: GetAllChirps :many
 select * from chirps
+where user_id not in (select id from users where delete_after is not null)
+  and id not in (select chirp_id from chirp_schedules)
+  and deleted_at is null
 order by created_at asc;
 
 -- name: GetAllChirpsByAuthorID :many
 select * from chirps
 where user_id = $1
+  and user_id not in (select id from users where delete_after is not null)
+  and id not in (select chirp_id from chirp_schedules)
+  and deleted_at is null
 order by created_at asc;
 
 -- name: GetChirpByID :one
 select * from chirps
-where id = $1;
+where id = $1
+  and user_id not in (select id from users where delete_after is not null)
+  and id not in (select chirp_id from chirp_schedules)
+  and deleted_at is null;
 
--- name: DeleteChirpByID :exec
+-- name: SoftDeleteChirpByID :execrows
+update chirps
+set deleted_at = now()
+where id = $1
+  and deleted_at is null;
+
+-- name: RestoreChirpByID :one
+update chirps
+set deleted_at = null
+where id = $1
+  and deleted_at is not null
+returning *;
+
+-- name: PurgeDeletedChirpsBefore :execrows
 delete from chirps
-where id = $1;
+where deleted_at < $1;
+
+-- name: GetThreadChirpByID :one
+select * from chirps
+where id = $1
+  and id not in (select chirp_id from chirp_schedules);
+
+-- name: ListChirpAncestors :many
+with recursive ancestors (id, in_reply_to, depth) as (
+  select chirps.id, chirps.in_reply_to, 0 from chirps
+  where chirps.id = sqlc.arg(id)
+  union all
+  select chirps.id, chirps.in_reply_to, ancestors.depth + 1 from chirps
+  join ancestors on chirps.id = ancestors.in_reply_to
+  where ancestors.depth < sqlc.arg(max_depth)::int
+)
+select chirps.* from chirps
+where chirps.id in (select ancestors.id from ancestors where ancestors.depth > 0)
+order by chirps.created_at asc;
+
+-- name: ListChirpReplies :many
+select * from chirps
+where in_reply_to = $1
+  and id not in (select chirp_id from chirp_schedules)
+  and (deleted_at is null or id in (select in_reply_to from chirps where in_reply_to is not null))
+order by created_at asc;
+
+-- name: ListChirpsByUserIDForExport :many
+select * from chirps
+where user_id = $1
+  and id not in (select chirp_id from chirp_schedules)
+order by created_at asc;
+
+-- name: PublishChirp :one
+update chirps
+set
+  created_at = now(),
+  updated_at = now()
+where id = $1
+returning *;
+
+-- name: ImportChirp :exec
+insert into chirps (
+	id, created_at, updated_at, body, user_id, posted_at
+) values (
+	gen_random_uuid(), $1, $1, $2, $3, $1
+);
+
+-- name: UpdateChirpBody :one
+update chirps
+set
+  updated_at = now(),
+  body = $2
+where id = $1
+  and deleted_at is null
+returning *;
+
+-- name: CountChirpsByUserSince :one
+select count(*) from chirps
+where user_id = $1
+  and posted_at > $2;
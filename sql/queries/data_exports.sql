@@ -0,0 +1,40 @@
+-- name: CreateDataExport :one
+insert into data_exports (
+  id, created_at, user_id, status
+) values (
+  gen_random_uuid(), now(), $1, 'pending'
+)
+returning *;
+
+-- name: GetDataExportByID :one
+select * from data_exports
+where id = $1;
+
+-- name: GetPendingDataExportByUserID :one
+select * from data_exports
+where user_id = $1
+  and status = 'pending'
+order by created_at desc
+limit 1;
+
+-- name: CompleteDataExport :exec
+update data_exports
+set
+  status = 'ready',
+  archive = $2,
+  completed_at = now(),
+  expires_at = $3
+where id = $1;
+
+-- name: FailDataExport :exec
+update data_exports
+set
+  status = 'failed',
+  error = $2,
+  completed_at = now()
+where id = $1;
+
+-- name: DeleteExpiredDataExports :execrows
+delete from data_exports
+where expires_at is not null
+  and expires_at <= now();
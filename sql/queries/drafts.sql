@@ -0,0 +1,41 @@
+-- name: CreateDraft :one
+insert into drafts (
+  id, created_at, updated_at, user_id, body, in_reply_to
+) values (
+  gen_random_uuid(), now(), now(), $1, $2, $3
+)
+returning *;
+
+-- name: GetDraftByID :one
+select * from drafts
+where id = $1;
+
+-- name: ListDraftsByUserID :many
+select * from drafts
+where user_id = $1
+order by updated_at desc;
+
+-- name: CountDraftsByUserID :one
+select count(*) from drafts
+where user_id = $1;
+
+-- name: UpdateDraft :one
+update drafts
+set
+  body = $3,
+  in_reply_to = $4,
+  updated_at = now()
+where id = $1
+  and user_id = $2
+returning *;
+
+-- name: DeleteDraft :execrows
+delete from drafts
+where id = $1
+  and user_id = $2;
+
+-- name: TakeDraft :one
+delete from drafts
+where id = $1
+  and user_id = $2
+returning *;
@@ -0,0 +1,25 @@
+-- name: CreateEmailToken :one
+insert into email_tokens (
+  id, created_at, user_id, purpose, expires_at, used_at
+) values (
+  gen_random_uuid(), now(), $1, $2, $3, NULL
+)
+returning *;
+
+-- name: UseEmailToken :one
+update email_tokens
+set
+  used_at = now()
+where id = $1
+  and purpose = $2
+  and used_at is null
+  and expires_at > now()
+returning *;
+
+-- name: InvalidateEmailTokensByUserID :exec
+update email_tokens
+set
+  used_at = now()
+where user_id = $1
+  and purpose = $2
+  and used_at is null;
@@ -0,0 +1,10 @@
+-- name: GetEntitlementsByUserID :one
+select plan_entitlements.* from plan_entitlements
+join users on plan_entitlements.plan = (
+  case when users.is_chirpy_red then 'chirpy_red' else 'free' end
+)
+where users.id = $1;
+
+-- name: ListPlanEntitlements :many
+select * from plan_entitlements
+order by plan asc;
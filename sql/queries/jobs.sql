@@ -0,0 +1,117 @@
+-- name: EnqueueJob :one
+insert into jobs (
+  id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at
+) values (
+  gen_random_uuid(), now(), now(), $1, $2, 'pending', 0, $3, $4
+)
+returning *;
+
+-- name: EnqueuePeriodicJob :exec
+insert into jobs (
+  id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at
+) values (
+  $1, now(), now(), $2, '{}', 'pending', 0, $3, $4
+)
+on conflict (id) do update
+set
+  status = 'pending',
+  attempts = 0,
+  run_at = excluded.run_at,
+  locked_until = null,
+  finished_at = null,
+  updated_at = now()
+where jobs.status in ('done', 'failed');
+
+-- name: EnqueueUniqueJob :execrows
+insert into jobs (
+  id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at
+) values (
+  $1, now(), now(), $2, $3, 'pending', 0, $4, $5
+)
+on conflict (id) do update
+set
+  status = 'pending',
+  payload = excluded.payload,
+  attempts = 0,
+  max_attempts = excluded.max_attempts,
+  run_at = excluded.run_at,
+  locked_until = null,
+  last_error = null,
+  finished_at = null,
+  updated_at = now()
+where jobs.status in ('done', 'failed');
+
+-- name: ClaimJobs :many
+update jobs
+set
+  status = 'running',
+  attempts = attempts + 1,
+  locked_until = sqlc.arg(locked_until),
+  updated_at = now()
+where id in (
+  select due.id from jobs as due
+  where due.kind = any(sqlc.arg(kinds)::text[])
+    and (
+      (due.status = 'pending' and due.run_at <= sqlc.arg(now))
+      or (due.status = 'running' and due.locked_until <= sqlc.arg(now))
+    )
+  order by due.run_at
+  limit sqlc.arg(max_jobs)
+  for update skip locked
+)
+returning *;
+
+-- name: CompleteJob :execrows
+update jobs
+set
+  status = 'done',
+  payload = '{}',
+  locked_until = null,
+  last_error = null,
+  finished_at = now(),
+  updated_at = now()
+where id = $1
+  and attempts = $2
+  and status = 'running';
+
+-- name: RetryJob :execrows
+update jobs
+set
+  status = 'pending',
+  run_at = $3,
+  locked_until = null,
+  last_error = $4,
+  updated_at = now()
+where id = $1
+  and attempts = $2
+  and status = 'running';
+
+-- name: RescheduleJob :execrows
+update jobs
+set
+  status = 'pending',
+  attempts = 0,
+  run_at = $3,
+  locked_until = null,
+  last_error = $4,
+  updated_at = now()
+where id = $1
+  and attempts = $2
+  and status = 'running';
+
+-- name: FailJob :execrows
+update jobs
+set
+  status = 'failed',
+  payload = '{}',
+  locked_until = null,
+  last_error = $3,
+  finished_at = now(),
+  updated_at = now()
+where id = $1
+  and attempts = $2
+  and status = 'running';
+
+-- name: DeleteFinishedJobsBefore :execrows
+delete from jobs
+where finished_at < $1;
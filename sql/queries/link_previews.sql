@@ -0,0 +1,41 @@
+-- name: CreateChirpLink :exec
+insert into chirp_links (
+  chirp_id, position, url
+) values (
+  $1, $2, $3
+);
+
+-- name: GetLinkPreviewByURL :one
+select * from link_previews
+where url = $1;
+
+-- name: UpsertLinkPreview :exec
+insert into link_previews (
+  url, fetched_at, status, title, description, image_url, site_name, error
+) values (
+  $1, now(), $2, $3, $4, $5, $6, $7
+)
+on conflict (url) do update
+set
+  fetched_at = now(),
+  status = excluded.status,
+  title = excluded.title,
+  description = excluded.description,
+  image_url = excluded.image_url,
+  site_name = excluded.site_name,
+  error = excluded.error;
+
+-- name: ListLinkPreviewsByChirpIDs :many
+select
+  chirp_links.chirp_id, chirp_links.url,
+  link_previews.title, link_previews.description,
+  link_previews.image_url, link_previews.site_name
+from chirp_links
+join link_previews on link_previews.url = chirp_links.url
+where chirp_links.chirp_id = any(sqlc.arg(chirp_ids)::uuid[])
+  and link_previews.status = 'ok'
+order by chirp_links.chirp_id asc, chirp_links.position asc;
+
+-- name: DeleteChirpLinksByChirpID :exec
+delete from chirp_links
+where chirp_id = $1;
@@ -0,0 +1,15 @@
+-- name: CreateLoginEvent :exec
+insert into login_events (
+  id, created_at, user_id, method, ip_address, user_agent
+) values (
+  gen_random_uuid(), now(), $1, $2, $3, $4
+);
+
+-- name: ListLoginEventsByUserID :many
+select * from login_events
+where user_id = $1
+order by created_at desc;
+
+-- name: DeleteLoginEventsBefore :execrows
+delete from login_events
+where created_at < $1;
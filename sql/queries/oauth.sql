@@ -0,0 +1,53 @@
+-- name: CreateOAuthClient :one
+insert into oauth_clients (
+  id, created_at, updated_at, user_id, name, hashed_secret, redirect_uris, scope
+) values (
+  gen_random_uuid(), now(), now(), $1, $2, $3, $4, $5
+)
+returning *;
+
+-- name: GetOAuthClientByID :one
+select * from oauth_clients
+where id = $1;
+
+-- name: CreateOAuthAuthorizationCode :exec
+insert into oauth_authorization_codes (
+  code_hash, created_at, client_id, user_id, redirect_uri, scope,
+  code_challenge, code_challenge_method, expires_at, used_at
+) values (
+  $1, now(), $2, $3, $4, $5, $6, $7, $8, NULL
+);
+
+-- name: GetOAuthAuthorizationCodeForUpdate :one
+select * from oauth_authorization_codes
+where code_hash = $1
+  and used_at is null
+for update;
+
+-- name: ConsumeOAuthAuthorizationCode :one
+update oauth_authorization_codes
+set
+  used_at = now()
+where code_hash = $1
+  and used_at is null
+returning *;
+
+-- name: GetOAuthConsent :one
+select * from oauth_consents
+where user_id = $1 and client_id = $2;
+
+-- name: UpsertOAuthConsent :exec
+insert into oauth_consents (
+  user_id, client_id, created_at, updated_at, scope
+) values (
+  $1, $2, now(), now(), $3
+)
+on conflict (user_id, client_id) do update
+set
+  updated_at = now(),
+  scope = excluded.scope;
+
+-- name: ListOAuthConsentsByUserID :many
+select * from oauth_consents
+where user_id = $1
+order by created_at asc;
@@ -0,0 +1,105 @@
+-- name: CreateWebhookSubscription :one
+insert into webhook_subscriptions (
+  id, created_at, updated_at, user_id, client_id, url, secret, events
+) values (
+  gen_random_uuid(), now(), now(), $1, $2, $3, $4, $5
+)
+returning *;
+
+-- name: GetWebhookSubscription :one
+select * from webhook_subscriptions
+where id = $1;
+
+-- name: ListWebhookSubscriptionsByUserID :many
+select * from webhook_subscriptions
+where user_id = $1
+order by created_at;
+
+-- name: DeleteWebhookSubscription :exec
+delete from webhook_subscriptions
+where id = $1;
+
+-- name: EnqueueWebhookDeliveries :execrows
+insert into webhook_deliveries (
+  id, created_at, updated_at, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at
+)
+select
+  gen_random_uuid(), now(), now(), id, $1, $2, $3, 'pending', 0, now()
+from webhook_subscriptions
+where user_id = $4
+  and $2::text = any(events);
+
+-- name: ClaimDueWebhookDeliveries :many
+update webhook_deliveries
+set
+  next_attempt_at = sqlc.arg(lease_until),
+  locked_until = sqlc.arg(lease_until),
+  updated_at = now()
+from webhook_subscriptions
+where webhook_subscriptions.id = webhook_deliveries.subscription_id
+  and webhook_deliveries.id in (
+    select due.id from webhook_deliveries as due
+    where due.status = 'pending'
+      and due.next_attempt_at <= sqlc.arg(now)
+    order by due.next_attempt_at
+    limit sqlc.arg(max_deliveries)
+    for update skip locked
+  )
+returning webhook_deliveries.id, webhook_deliveries.event_type, webhook_deliveries.payload, webhook_deliveries.attempts, webhook_subscriptions.url, webhook_subscriptions.secret;
+
+-- name: CompleteWebhookDelivery :exec
+update webhook_deliveries
+set
+  status = 'delivered',
+  attempts = attempts + 1,
+  delivered_at = now(),
+  last_error = null,
+  locked_until = null,
+  updated_at = now()
+where id = $1;
+
+-- name: RetryWebhookDelivery :exec
+update webhook_deliveries
+set
+  status = $2,
+  attempts = attempts + 1,
+  next_attempt_at = $3,
+  last_error = $4,
+  locked_until = null,
+  updated_at = now()
+where id = $1;
+
+-- name: RedeliverWebhookDelivery :one
+update webhook_deliveries
+set
+  status = 'pending',
+  attempts = 0,
+  next_attempt_at = now(),
+  updated_at = now()
+where id = $1
+  and subscription_id = $2
+  and (locked_until is null or locked_until <= now())
+returning *;
+
+-- name: GetWebhookDelivery :one
+select * from webhook_deliveries
+where id = $1
+  and subscription_id = $2;
+
+-- name: ListWebhookDeliveriesBySubscriptionID :many
+select * from webhook_deliveries
+where subscription_id = $1
+order by created_at desc
+limit $2;
+
+-- name: CreateWebhookDeliveryAttempt :exec
+insert into webhook_delivery_attempts (
+  id, delivery_id, attempted_at, status_code, error, duration_ms
+) values (
+  gen_random_uuid(), $1, now(), $2, $3, $4
+);
+
+-- name: ListWebhookDeliveryAttemptsByDeliveryIDs :many
+select * from webhook_delivery_attempts
+where delivery_id = any(sqlc.arg(delivery_ids)::uuid[])
+order by attempted_at;
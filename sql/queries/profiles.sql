@@ -0,0 +1,38 @@
+-- name: GetProfileByUserID :one
+select * from profiles
+where user_id = $1;
+
+-- name: GetUserIDByHandle :one
+select user_id from profiles
+where lower(handle) = lower(sqlc.arg(handle));
+
+-- name: UpsertProfile :exec
+insert into profiles (
+  user_id, created_at, updated_at, handle, display_name, bio, avatar_url, location, website
+) values (
+  $1, now(), now(), $2, $3, $4, $5, $6, $7
+)
+on conflict (user_id) do update
+set
+  updated_at = now(),
+  handle = excluded.handle,
+  display_name = excluded.display_name,
+  bio = excluded.bio,
+  avatar_url = excluded.avatar_url,
+  location = excluded.location,
+  website = excluded.website;
+
+-- name: GetPublicProfileByUserID :one
+select
+  users.id, users.created_at, users.is_chirpy_red,
+  profiles.handle, profiles.display_name, profiles.bio,
+  profiles.avatar_url, profiles.location, profiles.website,
+  count(chirps.id) as chirp_count
+from users
+left join profiles on profiles.user_id = users.id
+left join chirps on chirps.user_id = users.id
+  and chirps.id not in (select chirp_id from chirp_schedules)
+  and chirps.deleted_at is null
+where users.id = $1
+  and users.delete_after is null
+group by users.id, profiles.user_id;
@@ -6,6 +6,14 @@ insert into refresh_tokens (
 )
 returning *;
 
+-- name: CreateOAuthRefreshToken :one
+insert into refresh_tokens (
+  id, created_at, updated_at, user_id, expires_at, revoked_at, client_id, scope
+) values (
+  $1, now(), now(), $2, $3, NULL, $4, $5
+)
+returning *;
+
 -- name: GetUserFromRefreshToken :one
 select * from refresh_tokens
 where id = $1;
@@ -16,3 +24,24 @@ set
   updated_at = now(),
   revoked_at = now()
 where id = $1;
+
+-- name: RotateRefreshToken :execrows
+update refresh_tokens
+set
+  updated_at = now(),
+  revoked_at = now()
+where id = $1
+  and revoked_at is null;
+
+-- name: RevokeAllRefreshTokensByUserID :exec
+update refresh_tokens
+set
+  updated_at = now(),
+  revoked_at = now()
+where user_id = $1
+  and revoked_at is null;
+
+-- name: ListRefreshTokensByUserID :many
+select created_at, expires_at, revoked_at, client_id, scope from refresh_tokens
+where user_id = $1
+order by created_at asc;
@@ -0,0 +1,28 @@
+-- name: GetSubscriptionByUserIDForUpdate :one
+select * from subscriptions
+where user_id = $1
+for update;
+
+-- name: UpsertSubscription :one
+insert into subscriptions (
+  user_id, created_at, updated_at, plan, status, current_period_start, current_period_end
+) values (
+  $1, now(), now(), $2, $3, $4, $5
+)
+on conflict (user_id) do update
+set
+  updated_at = now(),
+  plan = excluded.plan,
+  status = excluded.status,
+  current_period_start = excluded.current_period_start,
+  current_period_end = excluded.current_period_end
+returning *;
+
+-- name: ExpireLapsedSubscriptions :many
+update subscriptions
+set
+  updated_at = now(),
+  status = 'expired'
+where current_period_end <= $1
+  and status in ('active', 'past_due', 'canceled')
+returning user_id;
@@ -0,0 +1,54 @@
+-- name: UpsertPendingTOTPSecret :exec
+insert into totp_secrets (
+  user_id, created_at, updated_at, encrypted_secret, confirmed_at, last_used_step
+) values (
+  $1, now(), now(), $2, NULL, 0
+)
+on conflict (user_id) do update
+set
+  updated_at = now(),
+  encrypted_secret = excluded.encrypted_secret,
+  last_used_step = 0
+where totp_secrets.confirmed_at is null;
+
+-- name: GetTOTPSecretByUserID :one
+select * from totp_secrets
+where user_id = $1;
+
+-- name: ConfirmTOTPSecret :exec
+update totp_secrets
+set
+  updated_at = now(),
+  confirmed_at = now()
+where user_id = $1;
+
+-- name: UpdateTOTPLastUsedStep :execrows
+update totp_secrets
+set
+  updated_at = now(),
+  last_used_step = $2
+where user_id = $1
+  and last_used_step < $2;
+
+-- name: DeleteTOTPSecret :exec
+delete from totp_secrets
+where user_id = $1;
+
+-- name: CreateTOTPRecoveryCode :exec
+insert into totp_recovery_codes (
+  id, created_at, user_id, code_hash, used_at
+) values (
+  gen_random_uuid(), now(), $1, $2, NULL
+);
+
+-- name: UseTOTPRecoveryCode :execrows
+update totp_recovery_codes
+set
+  used_at = now()
+where user_id = $1
+  and code_hash = $2
+  and used_at is null;
+
+-- name: DeleteTOTPRecoveryCodesByUserID :exec
+delete from totp_recovery_codes
+where user_id = $1;
@@ -6,15 +6,6 @@ insert into users (
 )
 returning *;
 
--- name: UpdateUser :one
-update users
-set
-  updated_at = now(),
-  email = $2,
-  hashed_password = $3
-where id = $1
-returning id, created_at, updated_at, email, is_chirpy_red;
-
 -- name: ResetUsers :exec
 delete from users;
 
@@ -22,17 +13,86 @@ delete from users;
 select * from users
 where email = $1;
 
+-- name: GetUserByIDRetHashedPassword :one
+select * from users
+where id = $1;
+
 -- name: GetUserByEmailSafe :one
-select id, created_at, updated_at, email, is_chirpy_red from users
+select id, created_at, updated_at, email, is_chirpy_red, email_verified from users
 where email = $1;
 
 -- name: GetUserByIDSafe :one
-select id, created_at, updated_at, email, is_chirpy_red from users
+select id, created_at, updated_at, email, is_chirpy_red, email_verified from users
 where id = $1;
 
+-- name: LockUserByID :one
+select id from users
+where id = $1
+for update;
+
 -- name: UpgradeUserByID :exec
 update users
 set
   updated_at = now(),
   is_chirpy_red = true  
 where id = $1;
+
+-- name: DowngradeUsersByIDs :exec
+update users
+set
+  updated_at = now(),
+  is_chirpy_red = false
+where id = any(sqlc.arg(ids)::uuid[]);
+
+-- name: MarkUserEmailVerified :exec
+update users
+set
+  updated_at = now(),
+  email_verified = true
+where id = $1 and email = $2;
+
+-- name: UpdateUserPassword :exec
+update users
+set
+  updated_at = now(),
+  hashed_password = $2
+where id = $1;
+
+-- name: UpdateUserEmail :one
+update users
+set
+  updated_at = now(),
+  email = $2,
+  email_verified = false
+where id = $1
+returning id, created_at, updated_at, email, is_chirpy_red, email_verified;
+
+-- name: ScheduleUserDeletion :exec
+update users
+set
+  updated_at = now(),
+  delete_after = $2
+where id = $1;
+
+-- name: CancelUserDeletion :execrows
+update users
+set
+  updated_at = now(),
+  delete_after = null
+where id = $1
+  and delete_after is not null;
+
+-- name: DeleteUsersDueForDeletion :execrows
+delete from users
+where delete_after is not null
+  and delete_after <= now();
+
+-- name: IsUserPendingDeletion :one
+select (delete_after is not null)::boolean as pending_deletion
+from users
+where id = $1;
+
+-- name: ListUserIDsPendingDeletion :many
+select id from users
+where id = any(sqlc.arg(ids)::uuid[])
+  and delete_after is not null;
@@ -0,0 +1,58 @@
+-- name: ClaimWebhookNonce :execrows
+insert into webhook_nonces (
+  provider, nonce, received_at
+) values (
+  $1, $2, now()
+)
+on conflict (provider, nonce) do nothing;
+
+-- name: ReleaseWebhookNonce :exec
+delete from webhook_nonces
+where provider = $1
+  and nonce = $2;
+
+-- name: DeleteWebhookNoncesBefore :execrows
+delete from webhook_nonces
+where received_at < $1;
+
+-- name: ReceiveWebhookEvent :one
+insert into webhook_events (
+  provider, id, event_type, payload, status, attempts, received_at
+) values (
+  $1, $2, $3, $4, 'pending', 1, now()
+)
+on conflict (provider, id) do update
+set attempts = webhook_events.attempts + 1
+returning *;
+
+-- name: CompleteWebhookEvent :exec
+update webhook_events
+set
+  status = $3,
+  error = null,
+  processed_at = now()
+where provider = $1
+  and id = $2;
+
+-- name: FailWebhookEvent :exec
+insert into webhook_events (
+  provider, id, event_type, payload, status, error, attempts, received_at
+) values (
+  $1, $2, $3, $4, 'failed', $5, 1, now()
+)
+on conflict (provider, id) do update
+set
+  status = 'failed',
+  error = excluded.error,
+  attempts = webhook_events.attempts + 1;
+
+-- name: GetWebhookEvent :one
+select * from webhook_events
+where provider = $1
+  and id = $2;
+
+-- name: ListWebhookEventsByStatus :many
+select * from webhook_events
+where status = $1
+order by received_at desc
+limit $2;
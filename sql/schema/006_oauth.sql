@@ -0,0 +1,72 @@
+-- +goose Up
+create table oauth_clients (
+  id uuid primary key,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  user_id uuid not null,
+  name text not null,
+  hashed_secret text,
+  redirect_uris text[] not null,
+  scope text not null,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade
+);
+
+create table oauth_authorization_codes (
+  code_hash text primary key,
+  created_at timestamp not null,
+  client_id uuid not null,
+  user_id uuid not null,
+  redirect_uri text not null,
+  scope text not null,
+  code_challenge text not null,
+  code_challenge_method text not null,
+  expires_at timestamp not null,
+  used_at timestamp,
+
+  constraint fk_client
+  foreign key (client_id)
+  references oauth_clients (id)
+  on delete cascade,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade
+);
+
+create table oauth_consents (
+  user_id uuid not null,
+  client_id uuid not null,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  scope text not null,
+
+  primary key (user_id, client_id),
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade,
+
+  constraint fk_client
+  foreign key (client_id)
+  references oauth_clients (id)
+  on delete cascade
+);
+
+alter table refresh_tokens
+add column client_id uuid references oauth_clients (id) on delete cascade,
+add column scope text default '' not null;
+
+-- +goose Down
+alter table refresh_tokens
+drop column client_id,
+drop column scope;
+
+drop table oauth_consents;
+drop table oauth_authorization_codes;
+drop table oauth_clients;
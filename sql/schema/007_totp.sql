@@ -0,0 +1,33 @@
+-- +goose Up
+create table totp_secrets (
+  user_id uuid primary key,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  encrypted_secret text not null,
+  confirmed_at timestamp,
+  last_used_step bigint default 0 not null,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade
+);
+
+create table totp_recovery_codes (
+  id uuid primary key,
+  created_at timestamp not null,
+  user_id uuid not null,
+  code_hash text not null,
+  used_at timestamp,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade
+);
+
+create index totp_recovery_codes_user_id_idx on totp_recovery_codes (user_id);
+
+-- +goose Down
+drop table totp_recovery_codes;
+drop table totp_secrets;
@@ -0,0 +1,23 @@
+-- +goose Up
+alter table users
+add column email_verified boolean default false not null;
+
+create table email_tokens (
+  id uuid primary key,
+  created_at timestamp not null,
+  user_id uuid not null,
+  purpose text not null,
+  expires_at timestamp not null,
+  used_at timestamp,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade
+);
+
+-- +goose Down
+drop table email_tokens;
+
+alter table users
+drop column email_verified;
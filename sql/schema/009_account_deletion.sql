@@ -0,0 +1,7 @@
+-- +goose Up
+alter table users
+add column delete_after timestamp;
+
+-- +goose Down
+alter table users
+drop column delete_after;
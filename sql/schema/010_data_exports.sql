@@ -0,0 +1,19 @@
+-- +goose Up
+create table data_exports (
+  id uuid primary key,
+  created_at timestamp not null,
+  user_id uuid not null,
+  status text not null,
+  archive bytea,
+  error text,
+  completed_at timestamp,
+  expires_at timestamp,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade
+);
+
+-- +goose Down
+drop table data_exports;
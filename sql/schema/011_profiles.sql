@@ -0,0 +1,23 @@
+-- +goose Up
+create table profiles (
+  user_id uuid primary key,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  handle text,
+  display_name text default '' not null,
+  bio text default '' not null,
+  avatar_url text default '' not null,
+  location text default '' not null,
+  website text default '' not null,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade
+);
+
+-- handles are unique regardless of case
+create unique index profiles_handle_idx on profiles (lower(handle));
+
+-- +goose Down
+drop table profiles;
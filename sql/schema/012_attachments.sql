@@ -0,0 +1,27 @@
+-- +goose Up
+create table attachments (
+  id uuid primary key,
+  created_at timestamp not null,
+  user_id uuid not null,
+  chirp_id uuid,
+  storage_key text not null unique,
+  content_type text not null,
+  size_bytes bigint not null,
+  width integer not null,
+  height integer not null,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade,
+
+  constraint fk_chirp
+  foreign key (chirp_id)
+  references chirps (id)
+  on delete set null
+);
+
+create index attachments_chirp_id_idx on attachments (chirp_id);
+
+-- +goose Down
+drop table attachments;
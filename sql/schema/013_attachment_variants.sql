@@ -0,0 +1,21 @@
+-- +goose Up
+create table attachment_variants (
+  attachment_id uuid not null,
+  size integer not null,
+  created_at timestamp not null,
+  storage_key text not null unique,
+  content_type text not null,
+  size_bytes bigint not null,
+  width integer not null,
+  height integer not null,
+
+  primary key (attachment_id, size),
+
+  constraint fk_attachment
+  foreign key (attachment_id)
+  references attachments (id)
+  on delete cascade
+);
+
+-- +goose Down
+drop table attachment_variants;
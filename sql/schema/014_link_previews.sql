@@ -0,0 +1,28 @@
+-- +goose Up
+create table link_previews (
+  url text primary key,
+  fetched_at timestamp not null,
+  status text not null,
+  title text not null default '',
+  description text not null default '',
+  image_url text not null default '',
+  site_name text not null default '',
+  error text
+);
+
+create table chirp_links (
+  chirp_id uuid not null,
+  position integer not null,
+  url text not null,
+
+  primary key (chirp_id, position),
+
+  constraint fk_chirp
+  foreign key (chirp_id)
+  references chirps (id)
+  on delete cascade
+);
+
+-- +goose Down
+drop table chirp_links;
+drop table link_previews;
@@ -0,0 +1,9 @@
+-- +goose Up
+alter table chirps
+add column in_reply_to uuid
+references chirps (id)
+on delete set null;
+
+-- +goose Down
+alter table chirps
+drop column in_reply_to;
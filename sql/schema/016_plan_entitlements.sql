@@ -0,0 +1,21 @@
+-- +goose Up
+create table plan_entitlements (
+  plan text primary key,
+  updated_at timestamp not null default now(),
+  max_chirp_length integer not null,
+  max_media_per_chirp integer not null,
+  chirps_per_hour integer not null,
+  media_uploads_per_hour integer not null,
+  can_edit_chirps boolean not null default false,
+  can_schedule_chirps boolean not null default false
+);
+
+insert into plan_entitlements (
+  plan, max_chirp_length, max_media_per_chirp, chirps_per_hour,
+  media_uploads_per_hour, can_edit_chirps, can_schedule_chirps
+) values
+  ('free', 140, 4, 30, 30, false, false),
+  ('chirpy_red', 500, 8, 120, 120, true, true);
+
+-- +goose Down
+drop table plan_entitlements;
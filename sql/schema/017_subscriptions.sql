@@ -0,0 +1,20 @@
+-- +goose Up
+create table subscriptions (
+  user_id uuid primary key,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  plan text not null,
+  status text not null,
+  current_period_start timestamp not null,
+  current_period_end timestamp not null,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade
+);
+
+create index subscriptions_current_period_end_idx on subscriptions (current_period_end);
+
+-- +goose Down
+drop table subscriptions;
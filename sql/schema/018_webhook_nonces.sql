@@ -0,0 +1,13 @@
+-- +goose Up
+create table webhook_nonces (
+  provider text not null,
+  nonce text not null,
+  received_at timestamp not null,
+
+  primary key (provider, nonce)
+);
+
+create index webhook_nonces_received_at_idx on webhook_nonces (received_at);
+
+-- +goose Down
+drop table webhook_nonces;
@@ -0,0 +1,19 @@
+-- +goose Up
+create table webhook_events (
+  provider text not null,
+  id text not null,
+  event_type text not null,
+  payload jsonb not null,
+  status text not null,
+  error text,
+  attempts integer not null default 1,
+  received_at timestamp not null,
+  processed_at timestamp,
+
+  primary key (provider, id)
+);
+
+create index webhook_events_status_idx on webhook_events (status, received_at);
+
+-- +goose Down
+drop table webhook_events;
@@ -0,0 +1,72 @@
+-- +goose Up
+create table webhook_subscriptions (
+  id uuid primary key,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  user_id uuid not null,
+  -- the third-party app that subscribed, null when the user did
+  client_id uuid,
+  url text not null,
+  -- signs every delivery, shown once when the subscription is made
+  secret text not null,
+  events text[] not null,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade,
+
+  constraint fk_client
+  foreign key (client_id)
+  references oauth_clients (id)
+  on delete cascade
+);
+
+create index webhook_subscriptions_user_id_idx on webhook_subscriptions (user_id);
+
+-- the outbox, rows are written in the same transaction as the change they report
+create table webhook_deliveries (
+  id uuid primary key,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  subscription_id uuid not null,
+  -- the same for every subscription the event is delivered to
+  event_id uuid not null,
+  event_type text not null,
+  payload jsonb not null,
+  status text not null,
+  attempts int not null default 0,
+  next_attempt_at timestamp not null,
+  delivered_at timestamp,
+  last_error text,
+
+  constraint fk_subscription
+  foreign key (subscription_id)
+  references webhook_subscriptions (id)
+  on delete cascade
+);
+
+create index webhook_deliveries_due_idx on webhook_deliveries (status, next_attempt_at);
+create index webhook_deliveries_subscription_id_idx on webhook_deliveries (subscription_id, created_at);
+
+create table webhook_delivery_attempts (
+  id uuid primary key,
+  delivery_id uuid not null,
+  attempted_at timestamp not null,
+  -- null when no response was received
+  status_code int,
+  error text,
+  duration_ms int not null,
+
+  constraint fk_delivery
+  foreign key (delivery_id)
+  references webhook_deliveries (id)
+  on delete cascade
+);
+
+create index webhook_delivery_attempts_delivery_id_idx on webhook_delivery_attempts (delivery_id);
+
+-- +goose Down
+drop table webhook_delivery_attempts;
+drop table webhook_deliveries;
+drop table webhook_subscriptions;
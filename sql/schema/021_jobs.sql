@@ -0,0 +1,24 @@
+-- +goose Up
+-- background work, claimed by whichever instance's runner gets to it first
+create table jobs (
+  id uuid primary key,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  kind text not null,
+  payload jsonb not null,
+  status text not null,
+  attempts int not null default 0,
+  max_attempts int not null,
+  -- not run before this, pushed back after each failed attempt
+  run_at timestamp not null,
+  -- a running job whose worker has not finished it by then may be claimed again
+  locked_until timestamp,
+  last_error text,
+  finished_at timestamp
+);
+
+create index jobs_due_idx on jobs (status, run_at);
+create index jobs_finished_at_idx on jobs (finished_at) where finished_at is not null;
+
+-- +goose Down
+drop table jobs;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- chirps that stay hidden until publish_at, the row is deleted once the chirp is published
+create table chirp_schedules (
+  chirp_id uuid primary key,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  publish_at timestamp not null,
+  -- the IANA time zone publish_at was given in, null when it was given with a UTC offset
+  time_zone text,
+
+  constraint fk_chirp
+  foreign key (chirp_id)
+  references chirps (id)
+  on delete cascade
+);
+
+create index chirp_schedules_publish_at_idx on chirp_schedules (publish_at);
+
+-- +goose Down
+drop table chirp_schedules;
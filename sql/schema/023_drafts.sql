@@ -0,0 +1,26 @@
+-- +goose Up
+-- unfinished chirps, only seen by their author until they are published
+create table drafts (
+  id uuid primary key,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  user_id uuid not null,
+  -- as the author wrote it, censoring happens when it is published
+  body text not null,
+  in_reply_to uuid,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade,
+
+  constraint fk_in_reply_to
+  foreign key (in_reply_to)
+  references chirps (id)
+  on delete set null
+);
+
+create index drafts_user_id_idx on drafts (user_id, updated_at desc);
+
+-- +goose Down
+drop table drafts;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- deleted chirps are kept as tombstones, so replies still know what they replied to,
+-- until they are purged once the retention period has passed
+alter table chirps
+add column deleted_at timestamp;
+
+create index chirps_deleted_at_idx on chirps (deleted_at)
+where deleted_at is not null;
+
+-- +goose Down
+delete from chirps
+where deleted_at is not null;
+
+alter table chirps
+drop column deleted_at;
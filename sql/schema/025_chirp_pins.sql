@@ -0,0 +1,35 @@
+-- +goose Up
+-- the chirps a user shows at the top of their profile, in the order they chose
+alter table plan_entitlements
+add column max_pinned_chirps integer not null default 3;
+
+update plan_entitlements
+set max_pinned_chirps = 5, updated_at = now()
+where plan = 'chirpy_red';
+
+create table chirp_pins (
+  chirp_id uuid primary key,
+  user_id uuid not null,
+  created_at timestamp not null,
+  position integer not null,
+
+  -- a user can only pin their own chirps, so a pin goes with the chirp or the user
+  constraint fk_chirp
+  foreign key (chirp_id)
+  references chirps (id)
+  on delete cascade,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade,
+
+  constraint chirp_pins_position_key
+  unique (user_id, position)
+);
+
+-- +goose Down
+drop table chirp_pins;
+
+alter table plan_entitlements
+drop column max_pinned_chirps;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- every successful login, kept for the user's own records and their data export
+create table login_events (
+  id uuid primary key,
+  created_at timestamp not null,
+  user_id uuid not null,
+  -- password, or two_factor once the second step is passed
+  method text not null,
+  ip_address text not null,
+  user_agent text not null,
+
+  constraint fk_user
+  foreign key (user_id)
+  references users (id)
+  on delete cascade
+);
+
+create index login_events_user_id_idx on login_events (user_id, created_at desc);
+create index login_events_created_at_idx on login_events (created_at);
+
+-- +goose Down
+drop table login_events;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- set while a delivery is being sent, so it is not reset or sent again until the lease passes
+alter table webhook_deliveries add column locked_until timestamp;
+
+-- +goose Down
+alter table webhook_deliveries drop column locked_until;
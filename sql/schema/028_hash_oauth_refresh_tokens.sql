@@ -0,0 +1,12 @@
+-- +goose Up
+-- oauth refresh tokens are stored as the sha-256 of the token, like authorization codes
+update refresh_tokens
+set id = encode(sha256(convert_to(id, 'UTF8')), 'hex')
+where client_id is not null;
+
+-- +goose Down
+-- the tokens can not be recovered from their hashes, so they are revoked instead
+update refresh_tokens
+set revoked_at = now()
+where client_id is not null
+  and revoked_at is null;
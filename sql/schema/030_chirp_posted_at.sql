@@ -0,0 +1,8 @@
+-- +goose Up
+-- when the chirp was saved, as created_at moves to the publish time of a scheduled chirp
+-- the chirp rate limit counts by it, so a scheduled chirp is only counted once
+alter table chirps add column posted_at timestamp not null default now();
+update chirps set posted_at = created_at;
+
+-- +goose Down
+alter table chirps drop column posted_at;
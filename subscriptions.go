@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	// polka bills chirpy red monthly
+	subscriptionPeriod         = time.Duration(time.Hour * 24 * 30)
+	subscriptionExpiryInterval = time.Duration(time.Hour * 1)
+
+	planChirpyRed = "chirpy_red"
+
+	subscriptionStatusActive = "active"
+	// a payment failed, the subscriber keeps chirpy red until the period ends
+	subscriptionStatusPastDue = "past_due"
+	// the subscriber downgraded, they keep chirpy red until the period ends
+	subscriptionStatusCanceled = "canceled"
+	subscriptionStatusRefunded = "refunded"
+	// set by ExpireLapsedSubscriptions once the period has ended
+	subscriptionStatusExpired = "expired"
+
+	// the subscription events every webhook provider's events are parsed into
+	subscriptionEventStarted       = "subscription.started"
+	subscriptionEventRenewed       = "subscription.renewed"
+	subscriptionEventPaymentFailed = "subscription.payment_failed"
+	subscriptionEventCanceled      = "subscription.canceled"
+	subscriptionEventRefunded      = "subscription.refunded"
+)
+
+// ================
+// GLOBAL VARIABLES
+// ================
+
+// the user a webhook event is about does not exist
+var errWebhookUserNotFound = errors.New("user not found")
+
+// =====
+// TYPES
+// =====
+
+// what a subscription event does to the subscriber
+type subscriptionChange struct {
+	// the subscription row is only written when save is set
+	subscription database.UpsertSubscriptionParams
+	save         bool
+	chirpyRed    bool
+}
+
+// takes chirpy red away once a subscription's period is over, every subscriptionExpiryInterval
+type subscriptionExpiryJob struct{}
+
+func (subscriptionExpiryJob) Kind() string { return "subscriptions.expire" }
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// works out the subscription after a subscription event
+// found is false when the user has no subscription yet, e.g. they were upgraded
+// before subscriptions were recorded
+func nextSubscription(userID uuid.UUID, current database.Subscription, found bool, event string, now time.Time) subscriptionChange {
+	subscription := database.UpsertSubscriptionParams{
+		UserID:             userID,
+		Plan:               planChirpyRed,
+		Status:             current.Status,
+		CurrentPeriodStart: current.CurrentPeriodStart,
+		CurrentPeriodEnd:   current.CurrentPeriodEnd,
+	}
+	withinPeriod := found && now.Before(current.CurrentPeriodEnd)
+
+	switch event {
+	case subscriptionEventStarted:
+		subscription.Status = subscriptionStatusActive
+		subscription.CurrentPeriodStart = now
+		subscription.CurrentPeriodEnd = now.Add(subscriptionPeriod)
+		return subscriptionChange{subscription: subscription, save: true, chirpyRed: true}
+
+	case subscriptionEventRenewed:
+		// an early renewal starts where the current period ends, a late one starts now
+		start := now
+		if withinPeriod {
+			start = current.CurrentPeriodEnd
+		}
+		subscription.Status = subscriptionStatusActive
+		subscription.CurrentPeriodStart = start
+		subscription.CurrentPeriodEnd = start.Add(subscriptionPeriod)
+		return subscriptionChange{subscription: subscription, save: true, chirpyRed: true}
+
+	case subscriptionEventPaymentFailed, subscriptionEventCanceled:
+		if !found {
+			// nothing recorded to let run out, so it ends now
+			return subscriptionChange{chirpyRed: false}
+		}
+		subscription.Status = subscriptionStatusPastDue
+		if event == subscriptionEventCanceled {
+			subscription.Status = subscriptionStatusCanceled
+		}
+		return subscriptionChange{subscription: subscription, save: true, chirpyRed: withinPeriod}
+
+	default:
+		// refunded, the subscription ends at once
+		if !found {
+			return subscriptionChange{chirpyRed: false}
+		}
+		subscription.Status = subscriptionStatusRefunded
+		subscription.CurrentPeriodEnd = now
+		if subscription.CurrentPeriodStart.After(now) {
+			subscription.CurrentPeriodStart = now
+		}
+		return subscriptionChange{subscription: subscription, save: true, chirpyRed: false}
+	}
+}
+
+// records the subscription event on the user's subscription, and upgrades or downgrades them to match
+// a user who was not already on chirpy red is reported to their webhook subscriptions
+// runs inside the caller's transaction
+func applySubscriptionEvent(ctx context.Context, qtx *database.Queries, user database.GetUserByIDSafeRow, event string) error {
+	userID := user.ID
+	current, err := qtx.GetSubscriptionByUserIDForUpdate(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	change := nextSubscription(userID, current, err == nil, event, time.Now().UTC())
+	if change.save {
+		_, err = qtx.UpsertSubscription(ctx, change.subscription)
+		if err != nil {
+			return err
+		}
+	}
+
+	if change.chirpyRed {
+		err = qtx.UpgradeUserByID(ctx, userID)
+		if err != nil || user.IsChirpyRed {
+			return err
+		}
+		return enqueueOutboundWebhook(ctx, qtx, userID, outboundEventUserUpgraded, UserUpgradedWebhookData{
+			UserID: userID,
+			Plan:   planChirpyRed,
+		})
+	}
+	return qtx.DowngradeUsersByIDs(ctx, []uuid.UUID{userID})
+}
+
+// applies a provider's event, as it was received or when it is replayed
+func applyWebhookEvent(ctx context.Context, qtx *database.Queries, event webhookEvent) error {
+	if event.Type == "" {
+		return errWebhookEventIgnored
+	}
+
+	user, err := qtx.GetUserByIDSafe(ctx, event.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errWebhookUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return applySubscriptionEvent(ctx, qtx, user, event.Type)
+}
+
+// ends the subscriptions whose period is over, and takes chirpy red away from their users
+func (cfg *apiConfig) expireLapsedSubscriptions(ctx context.Context) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Unable to begin transaction: %s", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	userIDs, err := qtx.ExpireLapsedSubscriptions(ctx, time.Now().UTC())
+	if err != nil {
+		log.Printf("Unable to expire lapsed subscriptions: %s", err)
+		return
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+
+	err = qtx.DowngradeUsersByIDs(ctx, userIDs)
+	if err != nil {
+		log.Printf("Unable to downgrade users with lapsed subscriptions: %s", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Unable to commit expired subscriptions: %s", err)
+		return
+	}
+
+	log.Printf("Expired %d lapsed subscriptions.", len(userIDs))
+}
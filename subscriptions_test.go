@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+func TestNextSubscription(t *testing.T) {
+	userID := uuid.New()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	periodStart := now.Add(-time.Hour * 24 * 10)
+	periodEnd := periodStart.Add(subscriptionPeriod)
+	current := database.Subscription{
+		UserID:             userID,
+		Plan:               planChirpyRed,
+		Status:             subscriptionStatusActive,
+		CurrentPeriodStart: periodStart,
+		CurrentPeriodEnd:   periodEnd,
+	}
+	lapsed := current
+	lapsed.CurrentPeriodEnd = now.Add(-time.Hour)
+
+	var tests = []struct {
+		name           string
+		current        database.Subscription
+		found          bool
+		event          string
+		expectedSave   bool
+		expectedStatus string
+		expectedStart  time.Time
+		expectedEnd    time.Time
+		expectedRed    bool
+	}{
+		{"started", database.Subscription{}, false, subscriptionEventStarted, true, subscriptionStatusActive, now, now.Add(subscriptionPeriod), true},
+		{"renewed early", current, true, subscriptionEventRenewed, true, subscriptionStatusActive, periodEnd, periodEnd.Add(subscriptionPeriod), true},
+		{"renewed late", lapsed, true, subscriptionEventRenewed, true, subscriptionStatusActive, now, now.Add(subscriptionPeriod), true},
+		{"renewed without subscription", database.Subscription{}, false, subscriptionEventRenewed, true, subscriptionStatusActive, now, now.Add(subscriptionPeriod), true},
+		{"payment failed", current, true, subscriptionEventPaymentFailed, true, subscriptionStatusPastDue, periodStart, periodEnd, true},
+		{"payment failed after period", lapsed, true, subscriptionEventPaymentFailed, true, subscriptionStatusPastDue, periodStart, lapsed.CurrentPeriodEnd, false},
+		{"canceled", current, true, subscriptionEventCanceled, true, subscriptionStatusCanceled, periodStart, periodEnd, true},
+		{"canceled without subscription", database.Subscription{}, false, subscriptionEventCanceled, false, "", time.Time{}, time.Time{}, false},
+		{"refunded", current, true, subscriptionEventRefunded, true, subscriptionStatusRefunded, periodStart, now, false},
+	}
+
+	for _, test := range tests {
+		change := nextSubscription(userID, test.current, test.found, test.event, now)
+		if change.save != test.expectedSave || change.chirpyRed != test.expectedRed {
+			t.Errorf("%s: Expected save %t and chirpy red %t, received %t and %t", test.name, test.expectedSave, test.expectedRed, change.save, change.chirpyRed)
+			continue
+		}
+		if !change.save {
+			continue
+		}
+
+		subscription := change.subscription
+		if subscription.UserID != userID || subscription.Plan != planChirpyRed || subscription.Status != test.expectedStatus {
+			t.Errorf("%s: Expected '%s', received '%+v'", test.name, test.expectedStatus, subscription)
+		}
+		if !subscription.CurrentPeriodStart.Equal(test.expectedStart) || !subscription.CurrentPeriodEnd.Equal(test.expectedEnd) {
+			t.Errorf("%s: Expected period '%s' to '%s', received '%s' to '%s'", test.name, test.expectedStart, test.expectedEnd, subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd)
+		}
+	}
+}
+
+// only covers the events ignored before the database is touched
+func TestApplyWebhookEventIgnored(t *testing.T) {
+	event := webhookEvent{ID: "evt_1", ProviderType: "user.teleported", UserID: uuid.New()}
+
+	err := applyWebhookEvent(context.Background(), nil, event)
+	if !errors.Is(err, errWebhookEventIgnored) {
+		t.Errorf("Expected: '%v', Got: '%v'", errWebhookEventIgnored, err)
+	}
+}
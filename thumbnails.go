@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/blobstore"
+	"github.com/nicholasss/chirpy/internal/database"
+	"github.com/nicholasss/chirpy/internal/jobs"
+	"github.com/nicholasss/chirpy/internal/media"
+)
+
+// ================
+// GLOBAL VARIABLES
+// ================
+
+// longest side of each thumbnail, in pixels
+var thumbnailSizes = []int32{160, 320, 640, 1280}
+
+// =====
+// TYPES
+// =====
+
+// makes the thumbnails of a new upload, or those found missing when served
+type thumbnailJob struct {
+	AttachmentID uuid.UUID `json:"attachment_id"`
+	// made again even when recorded, as their files are missing
+	Sizes []int32 `json:"sizes,omitempty"`
+}
+
+func (thumbnailJob) Kind() string { return "thumbnails.generate" }
+
+type MediaVariantResponse struct {
+	Size        int32  `json:"size"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	Width       int32  `json:"width"`
+	Height      int32  `json:"height"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// thumbnails are stored next to the original, as '<attachment id>_<size><ext>'
+func variantStorageKey(attachmentID uuid.UUID, size int32, contentType string) string {
+	return fmt.Sprintf("%s_%d%s", attachmentID, size, media.Extension(contentType))
+}
+
+// the thumbnail sizes worth making for an image, those smaller than its longest side
+func variantSizesFor(width, height int32) []int32 {
+	longest := max(width, height)
+
+	sizes := make([]int32, 0, len(thumbnailSizes))
+	for _, size := range thumbnailSizes {
+		if size < longest {
+			sizes = append(sizes, size)
+		}
+	}
+
+	return sizes
+}
+
+// the smallest thumbnail at least as large as the requested size
+// returns 0 when the original is the best fit
+func bestVariantSize(width, height, requested int32) int32 {
+	for _, size := range variantSizesFor(width, height) {
+		if size >= requested {
+			return size
+		}
+	}
+
+	return 0
+}
+
+func (cfg *apiConfig) newMediaVariantResponse(variant database.AttachmentVariant) MediaVariantResponse {
+	return MediaVariantResponse{
+		Size:        variant.Size,
+		URL:         cfg.mediaURL(variant.StorageKey),
+		ContentType: variant.ContentType,
+		SizeBytes:   variant.SizeBytes,
+		Width:       variant.Width,
+		Height:      variant.Height,
+	}
+}
+
+// makes every thumbnail the attachment is missing, and those of the job's sizes
+func (cfg *apiConfig) generateThumbnails(ctx context.Context, job thumbnailJob) error {
+	attachment, err := cfg.db.GetAttachmentByID(ctx, job.AttachmentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// deleted before its turn came
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	existing, err := cfg.db.ListAttachmentVariantsByAttachmentIDs(ctx, []uuid.UUID{attachment.ID})
+	if err != nil {
+		return err
+	}
+
+	missing := make([]int32, 0)
+	for _, size := range variantSizesFor(attachment.Width, attachment.Height) {
+		if slices.Contains(job.Sizes, size) || !slices.ContainsFunc(existing, func(variant database.AttachmentVariant) bool {
+			return variant.Size == size
+		}) {
+			missing = append(missing, size)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	variants, err := cfg.createVariants(ctx, attachment, missing)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Made %d thumbnails for attachment '%s'.", len(variants), attachment.ID)
+	return nil
+}
+
+// makes and stores thumbnails of the given sizes, decoding the original only once
+// a variant that already exists is replaced
+func (cfg *apiConfig) createVariants(ctx context.Context, attachment database.Attachment, sizes []int32) ([]database.AttachmentVariant, error) {
+	reader, _, err := cfg.blobs.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// stored originals were already checked, cleaned and oriented when uploaded
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	variants := make([]database.AttachmentVariant, 0, len(sizes))
+	for _, size := range sizes {
+		thumbnail, err := media.Thumbnail(img, attachment.ContentType, int(size))
+		if err != nil {
+			return nil, err
+		}
+
+		storageKey := variantStorageKey(attachment.ID, size, thumbnail.ContentType)
+		err = cfg.blobs.Put(ctx, storageKey, bytes.NewReader(thumbnail.Data), int64(len(thumbnail.Data)), thumbnail.ContentType)
+		if err != nil {
+			return nil, err
+		}
+
+		variant, err := cfg.db.UpsertAttachmentVariant(ctx, database.UpsertAttachmentVariantParams{
+			AttachmentID: attachment.ID,
+			Size:         size,
+			StorageKey:   storageKey,
+			ContentType:  thumbnail.ContentType,
+			SizeBytes:    int64(len(thumbnail.Data)),
+			Width:        int32(thumbnail.Width),
+			Height:       int32(thumbnail.Height),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+// serves the attachment's thumbnail of the given size
+// when it or its file is missing, it is made again in the background and the original is served meanwhile
+func (cfg *apiConfig) serveVariant(w http.ResponseWriter, r *http.Request, attachment database.Attachment, size int32) error {
+	variants, err := cfg.db.ListAttachmentVariantsByAttachmentIDs(r.Context(), []uuid.UUID{attachment.ID})
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range variants {
+		if variant.Size != size {
+			continue
+		}
+		err = cfg.serveBlob(w, r, variant.StorageKey, mediaCacheControl)
+		if !errors.Is(err, blobstore.ErrNotFound) {
+			return err
+		}
+		log.Printf("Thumbnail file '%s' is missing.", variant.StorageKey)
+	}
+
+	// asking again while it is being made does not enqueue it twice
+	enqueued, err := jobs.EnqueueUnique(r.Context(), cfg.db, thumbnailJob{
+		AttachmentID: attachment.ID,
+		Sizes:        []int32{size},
+	}, fmt.Sprintf("%s_%d", attachment.ID, size), jobs.Options{})
+	if err != nil {
+		log.Printf("Unable to enqueue thumbnail %d of attachment '%s': %s", size, attachment.ID, err)
+	}
+	if enqueued {
+		log.Printf("Thumbnail %d of attachment '%s' is missing, making it in the background.", size, attachment.ID)
+	}
+
+	return cfg.serveBlob(w, r, attachment.StorageKey, mediaFallbackCacheControl)
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// serves the attachment, or the thumbnail that best fits the optional 'size' parameter
+// a thumbnail that is missing is made by the thumbnail job, the original is served until it is ready
+func (cfg *apiConfig) handlerGetMedia(w http.ResponseWriter, r *http.Request) {
+	attachmentID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Media not found.")
+		return
+	}
+
+	var requested int32
+	if raw := r.URL.Query().Get("size"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || parsed <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Size must be a positive number of pixels.")
+			return
+		}
+		requested = int32(parsed)
+	}
+
+	// media of deleted chirps is hidden, but kept in case the chirp is restored
+	attachment, err := cfg.db.GetServableAttachmentByID(r.Context(), attachmentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Media not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting attachment '%s': %s", attachmentID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	size := int32(0)
+	if requested > 0 {
+		size = bestVariantSize(attachment.Width, attachment.Height, requested)
+	}
+	if size == 0 {
+		err = cfg.serveBlob(w, r, attachment.StorageKey, mediaCacheControl)
+	} else {
+		err = cfg.serveVariant(w, r, attachment, size)
+	}
+	if errors.Is(err, blobstore.ErrNotFound) {
+		log.Printf("File of attachment '%s' is missing.", attachment.ID)
+		respondWithError(w, http.StatusNotFound, "Media not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to serve attachment '%s': %s", attachment.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVariantSizesFor(t *testing.T) {
+	tests := []struct {
+		width    int32
+		height   int32
+		expected []int32
+	}{
+		{2048, 1024, []int32{160, 320, 640, 1280}},
+		{600, 800, []int32{160, 320, 640}},
+		{640, 480, []int32{160, 320}},
+		{100, 100, []int32{}},
+	}
+
+	for _, test := range tests {
+		received := variantSizesFor(test.width, test.height)
+		if !slices.Equal(received, test.expected) {
+			t.Errorf("%dx%d: Expected '%v', received '%v'", test.width, test.height, test.expected, received)
+		}
+	}
+}
+
+func TestBestVariantSize(t *testing.T) {
+	tests := []struct {
+		width     int32
+		height    int32
+		requested int32
+		expected  int32
+	}{
+		{2048, 1536, 100, 160},
+		{2048, 1536, 160, 160},
+		{2048, 1536, 161, 320},
+		{2048, 1536, 1280, 1280},
+		// larger than every thumbnail, so the original
+		{2048, 1536, 1500, 0},
+		// the original is smaller than the next thumbnail up
+		{1000, 750, 700, 0},
+		{100, 100, 50, 0},
+	}
+
+	for _, test := range tests {
+		received := bestVariantSize(test.width, test.height, test.requested)
+		if received != test.expected {
+			t.Errorf("%dx%d at %d, Expected: %d, Got: %d", test.width, test.height, test.requested, test.expected, received)
+		}
+	}
+}
+
+func TestVariantStorageKey(t *testing.T) {
+	attachmentID := uuid.MustParse("0195a1b2-0000-7000-8000-000000000000")
+
+	tests := []struct {
+		contentType string
+		expected    string
+	}{
+		{"image/jpeg", "0195a1b2-0000-7000-8000-000000000000_320.jpg"},
+		{"image/png", "0195a1b2-0000-7000-8000-000000000000_320.png"},
+	}
+
+	for _, test := range tests {
+		received := variantStorageKey(attachmentID, 320, test.contentType)
+		if received != test.expected {
+			t.Errorf("Expected '%s', received '%s'", test.expected, received)
+		}
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerGetMediaRejects(t *testing.T) {
+	cfg := apiConfig{}
+
+	tests := []struct {
+		id           string
+		size         string
+		expectedCode int
+	}{
+		{"not-a-uuid", "", http.StatusNotFound},
+		{uuid.NewString(), "big", http.StatusBadRequest},
+		{uuid.NewString(), "0", http.StatusBadRequest},
+		{uuid.NewString(), "-160", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/media/"+test.id+"?size="+test.size, nil)
+		req.SetPathValue("id", test.id)
+		w := httptest.NewRecorder()
+
+		cfg.handlerGetMedia(w, req)
+		_, code := readResponse(w, t)
+		if code != test.expectedCode {
+			t.Errorf("Expected: %d, Got: %d", test.expectedCode, code)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/auth"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	totpIssuer         = "Chirpy"
+	recoveryCodeCount  = 10
+	mfaChallengeExpiry = time.Duration(time.Minute * 5)
+	// failed codes allowed per user within one challenge lifetime
+	mfaMaxAttempts = 5
+)
+
+// =====
+// TYPES
+// =====
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+type TOTPConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+var errTOTPCodeInvalid = errors.New("totp code is invalid or already used")
+
+// counts attempts per user within a fixed window, only a successful attempt gives them back
+// windows that have ended are swept out at most once a window, so the map does not grow forever
+type attemptLimiter struct {
+	mu        sync.Mutex
+	max       int
+	window    time.Duration
+	attempts  map[uuid.UUID]attemptWindow
+	nextSweep time.Time
+}
+type attemptWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		attempts: make(map[uuid.UUID]attemptWindow),
+	}
+}
+
+// uses up one of the user's attempts before it is made, reporting false when none are left
+// taking it first stops attempts made at the same time from all getting through
+func (l *attemptLimiter) take(userID uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep()
+
+	current, ok := l.attempts[userID]
+	if !ok || time.Now().After(current.resetAt) {
+		current = attemptWindow{resetAt: time.Now().Add(l.window)}
+	}
+	if current.count >= l.max {
+		return false
+	}
+	current.count++
+	l.attempts[userID] = current
+
+	return true
+}
+
+func (l *attemptLimiter) reset(userID uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, userID)
+}
+
+// removes the windows that have ended, the caller holds the lock
+func (l *attemptLimiter) sweep() {
+	now := time.Now()
+	if now.Before(l.nextSweep) {
+		return
+	}
+
+	for userID, current := range l.attempts {
+		if now.After(current.resetAt) {
+			delete(l.attempts, userID)
+		}
+	}
+	l.nextSweep = now.Add(l.window)
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// checks the code against the user's secret
+// each code is only accepted once, even within its 30 second step
+func (cfg *apiConfig) verifyTOTPCode(ctx context.Context, totpRecord database.TotpSecret, code string) error {
+	secret, err := auth.DecryptSecret(totpRecord.EncryptedSecret, cfg.totpKey)
+	if err != nil {
+		return err
+	}
+
+	step, err := auth.ValidateTOTPCode(secret, code, time.Now())
+	if err != nil {
+		return errTOTPCodeInvalid
+	}
+
+	rows, err := cfg.db.UpdateTOTPLastUsedStep(ctx, database.UpdateTOTPLastUsedStepParams{
+		UserID:       totpRecord.UserID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errTOTPCodeInvalid
+	}
+
+	return nil
+}
+
+// marks a recovery code as used, if it is valid
+func (cfg *apiConfig) useRecoveryCode(ctx context.Context, userID uuid.UUID, recoveryCode string) error {
+	rows, err := cfg.db.UseTOTPRecoveryCode(ctx, database.UseTOTPRecoveryCodeParams{
+		UserID:   userID,
+		CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errTOTPCodeInvalid
+	}
+
+	return nil
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// generates a new totp secret for the user, which must be confirmed with a code
+func (cfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Unable to authenticate totp enrolment: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	safeUserRecord, err := cfg.db.GetUserByIDSafe(r.Context(), userID)
+	if err != nil {
+		log.Printf("Unable to find user for totp enrolment: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	totpRecord, err := cfg.db.GetTOTPSecretByUserID(r.Context(), userID)
+	if err == nil && totpRecord.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled.")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating totp secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	encryptedSecret, err := auth.EncryptSecret(secret, cfg.totpKey)
+	if err != nil {
+		log.Printf("Error encrypting totp secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	// replaces any earlier unconfirmed secret
+	err = cfg.db.UpsertPendingTOTPSecret(r.Context(), database.UpsertPendingTOTPSecretParams{
+		UserID:          userID,
+		EncryptedSecret: encryptedSecret,
+	})
+	if err != nil {
+		log.Printf("Error storing totp secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("User '%s' started totp enrolment.", userID)
+	respondWithJSON(w, http.StatusCreated, TOTPEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, safeUserRecord.Email, secret),
+	})
+}
+
+// confirms enrolment with a code from the authenticator app
+// and responds with the recovery codes, which are only shown once
+func (cfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Unable to authenticate totp confirmation: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	var codeRequest TOTPCodeRequest
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&codeRequest)
+	if err != nil {
+		log.Printf("Error decoding totp confirmation: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	totpRecord, err := cfg.db.GetTOTPSecretByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("No totp enrolment found for '%s': %s", userID, err)
+		respondWithError(w, http.StatusNotFound, "No pending two-factor enrolment.")
+		return
+	}
+	if totpRecord.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled.")
+		return
+	}
+
+	err = cfg.verifyTOTPCode(r.Context(), totpRecord, codeRequest.Code)
+	if errors.Is(err, errTOTPCodeInvalid) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying totp code: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		log.Printf("Error generating recovery codes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	// confirming and storing recovery codes happen together
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	err = qtx.DeleteTOTPRecoveryCodesByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error clearing recovery codes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	for _, recoveryCode := range recoveryCodes {
+		err = qtx.CreateTOTPRecoveryCode(r.Context(), database.CreateTOTPRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+		})
+		if err != nil {
+			log.Printf("Error storing recovery code: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+	}
+	err = qtx.ConfirmTOTPSecret(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error confirming totp secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing totp confirmation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("User '%s' enabled two-factor authentication.", userID)
+	respondWithJSON(w, http.StatusOK, TOTPConfirmResponse{RecoveryCodes: recoveryCodes})
+}
+
+// turns off two-factor authentication, which requires a current code
+func (cfg *apiConfig) handlerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticateRequest(r, "")
+	if err != nil {
+		log.Printf("Unable to authenticate totp removal: %s", err)
+		respondWithAuthError(w, err)
+		return
+	}
+
+	var codeRequest TOTPCodeRequest
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&codeRequest)
+	if err != nil {
+		log.Printf("Error decoding totp removal: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	totpRecord, err := cfg.db.GetTOTPSecretByUserID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Two-factor authentication is not enabled.")
+		return
+	}
+
+	// unconfirmed enrolments can be dropped without a code
+	if totpRecord.ConfirmedAt.Valid {
+		err = cfg.verifyTOTPCode(r.Context(), totpRecord, codeRequest.Code)
+		if errors.Is(err, errTOTPCodeInvalid) {
+			respondWithError(w, http.StatusUnauthorized, "Invalid code.")
+			return
+		}
+		if err != nil {
+			log.Printf("Error verifying totp code: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+	}
+
+	err = cfg.db.DeleteTOTPSecret(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error deleting totp secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	err = cfg.db.DeleteTOTPRecoveryCodesByUserID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error deleting recovery codes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("User '%s' disabled two-factor authentication.", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// second step of login for users with two-factor authentication
+// accepts the challenge token from POST /api/login and a totp or recovery code
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	var mfaLoginRequest MFALoginRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&mfaLoginRequest)
+	if err != nil {
+		log.Printf("Error decoding mfa login request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+
+	userID, err := auth.ValidateMFAChallengeJWT(mfaLoginRequest.MFAToken, cfg.jwtSecret)
+	if err != nil {
+		log.Printf("Invalid mfa challenge token: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if mfaLoginRequest.Code == "" && mfaLoginRequest.RecoveryCode == "" {
+		respondWithError(w, http.StatusBadRequest, "A code or recovery code is required.")
+		return
+	}
+
+	if !cfg.mfaAttempts.take(userID) {
+		log.Printf("Too many failed mfa attempts for '%s'", userID)
+		respondWithError(w, http.StatusTooManyRequests, "Too many attempts, please log in again later.")
+		return
+	}
+
+	switch {
+	case mfaLoginRequest.Code != "":
+		totpRecord, err := cfg.db.GetTOTPSecretByUserID(r.Context(), userID)
+		if err != nil || !totpRecord.ConfirmedAt.Valid {
+			log.Printf("MFA login for user without totp '%s': %v", userID, err)
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		err = cfg.verifyTOTPCode(r.Context(), totpRecord, mfaLoginRequest.Code)
+		if err != nil && !errors.Is(err, errTOTPCodeInvalid) {
+			log.Printf("Error verifying totp code: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		if err != nil {
+			log.Printf("Wrong totp code submitted for '%s'", userID)
+			respondWithError(w, http.StatusUnauthorized, "Invalid code.")
+			return
+		}
+
+	case mfaLoginRequest.RecoveryCode != "":
+		err = cfg.useRecoveryCode(r.Context(), userID, mfaLoginRequest.RecoveryCode)
+		if err != nil && !errors.Is(err, errTOTPCodeInvalid) {
+			log.Printf("Error checking recovery code: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		if err != nil {
+			log.Printf("Wrong recovery code submitted for '%s'", userID)
+			respondWithError(w, http.StatusUnauthorized, "Invalid code.")
+			return
+		}
+		log.Printf("User '%s' used a recovery code.", userID)
+	}
+	cfg.mfaAttempts.reset(userID)
+
+	loginResponseRecord, err := cfg.issueLoginTokens(r, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if err != nil {
+		log.Printf("Error issuing login tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	cfg.recordLogin(r, loginResponseRecord.ID, loginMethodTwoFactor)
+
+	log.Printf("User '%s' logged in successfuly with mfa.", loginResponseRecord.Email)
+	respondWithJSON(w, http.StatusOK, loginResponseRecord)
+}
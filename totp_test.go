@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	limiter := newAttemptLimiter(3, time.Minute)
+	userID := uuid.New()
+	otherUserID := uuid.New()
+
+	for range 3 {
+		if !limiter.take(userID) {
+			t.Fatal("Expected attempt to be allowed")
+		}
+	}
+
+	if limiter.take(userID) {
+		t.Error("Expected attempts to be exhausted")
+	}
+	if !limiter.take(otherUserID) {
+		t.Error("Expected other users to be unaffected")
+	}
+
+	limiter.reset(userID)
+	if !limiter.take(userID) {
+		t.Error("Expected attempts to be allowed after reset")
+	}
+}
+
+func TestAttemptLimiterConcurrent(t *testing.T) {
+	limiter := newAttemptLimiter(5, time.Minute)
+	userID := uuid.New()
+
+	var taken atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.take(userID) {
+				taken.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if taken.Load() != 5 {
+		t.Errorf("Expected: %d, Got: %d", 5, taken.Load())
+	}
+}
+
+func TestAttemptLimiterWindow(t *testing.T) {
+	limiter := newAttemptLimiter(1, time.Millisecond*10)
+	userID := uuid.New()
+
+	limiter.take(userID)
+	if limiter.take(userID) {
+		t.Error("Expected attempts to be exhausted")
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	if !limiter.take(userID) {
+		t.Error("Expected attempts to be allowed after the window")
+	}
+}
+
+func TestAttemptLimiterSweep(t *testing.T) {
+	limiter := newAttemptLimiter(1, time.Millisecond*10)
+
+	for range 100 {
+		limiter.take(uuid.New())
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	limiter.take(uuid.New())
+	if len(limiter.attempts) != 1 {
+		t.Errorf("Expected: %d, Got: %d", 1, len(limiter.attempts))
+	}
+}
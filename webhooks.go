@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// =========
+// CONSTANTS
+// =========
+
+const (
+	// largest webhook body read, provider events are small
+	webhookMaxBytes = 64 << 10
+	// how far a webhook's timestamp may be from the server's clock
+	webhookTimestampTolerance = time.Duration(time.Minute * 5)
+	// nonces are kept until their timestamp is too old to be accepted anyway
+	webhookNonceRetention = webhookTimestampTolerance * 2
+
+	webhookTimestampHeader = "Webhook-Timestamp"
+	webhookSignatureHeader = "Webhook-Signature"
+
+	webhookProviderPolka = "polka"
+	webhookProviderKiwi  = "kiwi"
+
+	// only seen inside the transaction processing the event
+	webhookEventStatusPending   = "pending"
+	webhookEventStatusProcessed = "processed"
+	// the event type is not one chirpy acts on
+	webhookEventStatusIgnored = "ignored"
+	// can be replayed by an admin
+	webhookEventStatusFailed = "failed"
+
+	defaultWebhookEventListLimit = 50
+	maxWebhookEventListLimit     = 500
+)
+
+// ================
+// GLOBAL VARIABLES
+// ================
+
+var (
+	// the webhook was already received, with the same timestamp and body
+	errWebhookReplayed = errors.New("webhook was already received")
+	// the event was already processed, or ignored
+	errWebhookEventDuplicate = errors.New("webhook event was already processed")
+	// returned by an apply function for events it does not act on
+	errWebhookEventIgnored = errors.New("webhook event type is ignored")
+)
+
+// =====
+// TYPES
+// =====
+
+// a payment provider that sends chirpy webhooks, routed at /api/webhooks/{name}
+type WebhookProvider interface {
+	// the provider's name in the webhook url, and in the webhook_events table
+	Name() string
+	// checks that the webhook was sent by the provider
+	// returns the nonce of the delivery to catch replays, or a blank nonce if the provider's
+	// verification has no replay protection
+	Verify(headers http.Header, body []byte, now time.Time) (string, error)
+	// reads the provider's payload into chirpy's event
+	// events chirpy does not act on are returned with a blank Type, rather than an error
+	Parse(body []byte) (webhookEvent, error)
+}
+
+// a provider's event, whatever the shape of its payload
+type webhookEvent struct {
+	// the provider's id for the event, the same each time it is sent
+	ID string
+	// what the provider calls the event
+	ProviderType string
+	// one of the subscription events, blank for events chirpy does not act on
+	Type   string
+	UserID uuid.UUID
+}
+
+type WebhookEventResponse struct {
+	Provider    string          `json:"provider"`
+	ID          string          `json:"id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error"`
+	Attempts    int32           `json:"attempts"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+}
+
+// =================
+// UTILITY FUNCTIONS
+// =================
+
+// reads a comma separated list of the secrets a provider may sign with, e.g. POLKA_WEBHOOK_SECRETS
+// several are accepted at once while a secret is rotated
+func webhookSecretsFromEnv(name string) []string {
+	secrets := make([]string, 0)
+	for _, secret := range strings.Split(os.Getenv(name), ",") {
+		secret = strings.TrimSpace(secret)
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	return secrets
+}
+
+// identifies a delivery by what was signed, its timestamp and body,
+// so a replay is caught whichever of its signatures is sent along
+func webhookNonce(timestamp string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(timestamp + "."))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// maps each provider's name to it
+func newWebhookProviders(providers ...WebhookProvider) map[string]WebhookProvider {
+	providersByName := make(map[string]WebhookProvider, len(providers))
+	for _, provider := range providers {
+		providersByName[provider.Name()] = provider
+	}
+
+	return providersByName
+}
+
+// records the nonce, failing with errWebhookReplayed if it was seen before
+func (cfg *apiConfig) claimWebhookNonce(ctx context.Context, provider, nonce string) error {
+	claimed, err := cfg.db.ClaimWebhookNonce(ctx, database.ClaimWebhookNonceParams{
+		Provider: provider,
+		Nonce:    nonce,
+	})
+	if err != nil {
+		return err
+	}
+	if claimed == 0 {
+		return errWebhookReplayed
+	}
+
+	return nil
+}
+
+// forgets the nonce of a delivery that could not be processed, so the same delivery can be sent again
+func (cfg *apiConfig) releaseWebhookNonce(ctx context.Context, provider, nonce string) {
+	if nonce == "" {
+		return
+	}
+
+	err := cfg.db.ReleaseWebhookNonce(ctx, database.ReleaseWebhookNonceParams{
+		Provider: provider,
+		Nonce:    nonce,
+	})
+	if err != nil {
+		log.Printf("Unable to release %s webhook nonce: %s", provider, err)
+	}
+}
+
+// deletes nonces too old to be replayed, their timestamps are outside the tolerance
+func (cfg *apiConfig) purgeWebhookNonces(ctx context.Context) {
+	deleted, err := cfg.db.DeleteWebhookNoncesBefore(ctx, time.Now().UTC().Add(-webhookNonceRetention))
+	if err != nil {
+		log.Printf("Unable to delete old webhook nonces: %s", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d old webhook nonces.", deleted)
+	}
+}
+
+// reads '?limit=', which is the default when it is not given
+func parseListLimit(r *http.Request, defaultLimit, maxLimit int) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 || limit > maxLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+	}
+
+	return limit, nil
+}
+
+func newWebhookEventResponse(event database.WebhookEvent) WebhookEventResponse {
+	response := WebhookEventResponse{
+		Provider:   event.Provider,
+		ID:         event.ID,
+		EventType:  event.EventType,
+		Payload:    event.Payload,
+		Status:     event.Status,
+		Error:      event.Error.String,
+		Attempts:   event.Attempts,
+		ReceivedAt: event.ReceivedAt,
+	}
+	if event.ProcessedAt.Valid {
+		response.ProcessedAt = &event.ProcessedAt.Time
+	}
+
+	return response
+}
+
+// logs the event and applies it, once per event id
+// the event is marked processed in the same transaction that applies it, so it can not be applied
+// twice, and a failure leaves no partial changes. Failed events are kept for an admin to replay
+// returns the event's status, or errWebhookEventDuplicate if it was already processed or ignored
+func (cfg *apiConfig) processWebhookEvent(ctx context.Context, provider string, parsed webhookEvent, payload []byte) (string, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// locks the event until this transaction ends, so a concurrent delivery waits for it
+	event, err := qtx.ReceiveWebhookEvent(ctx, database.ReceiveWebhookEventParams{
+		Provider:  provider,
+		ID:        parsed.ID,
+		EventType: parsed.ProviderType,
+		Payload:   payload,
+	})
+	if err != nil {
+		return "", err
+	}
+	if event.Status == webhookEventStatusProcessed || event.Status == webhookEventStatusIgnored {
+		return event.Status, errWebhookEventDuplicate
+	}
+
+	status := webhookEventStatusProcessed
+	err = applyWebhookEvent(ctx, qtx, parsed)
+	if errors.Is(err, errWebhookEventIgnored) {
+		status = webhookEventStatusIgnored
+	} else if err != nil {
+		tx.Rollback()
+		failErr := cfg.db.FailWebhookEvent(ctx, database.FailWebhookEventParams{
+			Provider:  provider,
+			ID:        parsed.ID,
+			EventType: parsed.ProviderType,
+			Payload:   payload,
+			Error:     sql.NullString{String: err.Error(), Valid: true},
+		})
+		if failErr != nil {
+			log.Printf("Unable to record failed %s event '%s': %s", provider, parsed.ID, failErr)
+		}
+		return webhookEventStatusFailed, err
+	}
+
+	err = qtx.CompleteWebhookEvent(ctx, database.CompleteWebhookEventParams{
+		Provider: provider,
+		ID:       parsed.ID,
+		Status:   status,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return status, tx.Commit()
+}
+
+// verifies, logs and applies a webhook from the provider
+// each event is processed once, however many times it is sent
+// events that are not understood are acknowledged, so the provider does not retry them forever
+func (cfg *apiConfig) receiveWebhook(w http.ResponseWriter, r *http.Request, provider WebhookProvider) {
+	name := provider.Name()
+
+	r.Body = http.MaxBytesReader(w, r.Body, webhookMaxBytes)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading %s webhook: %s", name, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	nonce, err := provider.Verify(r.Header, body, time.Now())
+	if err != nil {
+		log.Printf("Rejected %s webhook: %s", name, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	event, err := provider.Parse(body)
+	if err != nil {
+		log.Printf("Error decoding %s webhook: %s", name, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if nonce != "" {
+		err = cfg.claimWebhookNonce(r.Context(), name, nonce)
+		if errors.Is(err, errWebhookReplayed) {
+			log.Printf("Rejected replayed %s webhook '%s'.", name, event.ProviderType)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to record %s webhook nonce: %s", name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// events are logged by id, providers send one with every event
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+		log.Printf("%s event '%s' has no id, it is logged as '%s' and can not be deduplicated.", name, event.ProviderType, event.ID)
+	}
+
+	status, err := cfg.processWebhookEvent(r.Context(), name, event, body)
+	switch {
+	case errors.Is(err, errWebhookEventDuplicate):
+		log.Printf("%s event '%s' was already processed.", name, event.ID)
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, errWebhookUserNotFound):
+		log.Printf("%s event '%s' is for unknown user '%s'.", name, event.ID, event.UserID)
+		w.WriteHeader(http.StatusNotFound)
+	case err != nil:
+		log.Printf("Unable to process %s event '%s': %s", name, event.ID, err)
+		cfg.releaseWebhookNonce(r.Context(), name, nonce)
+		w.WriteHeader(http.StatusInternalServerError)
+	case status == webhookEventStatusIgnored:
+		log.Printf("Ignoring %s event of unknown type '%s'.", name, event.ProviderType)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		log.Printf("Applied %s event '%s' to user '%s'.", name, event.ProviderType, event.UserID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// =================
+// HANDLER FUNCTIONS
+// =================
+
+// routes webhooks to the provider named in the url
+func (cfg *apiConfig) handlerWebhook(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.webhookProviders[r.PathValue("provider")]
+	if !ok {
+		log.Printf("Rejected webhook from unknown provider '%s'.", r.PathValue("provider"))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	cfg.receiveWebhook(w, r, provider)
+}
+
+// lists received webhook events, the failed ones unless '?status=' says otherwise
+func (cfg *apiConfig) handlerListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authenticateAdmin(r)
+	if err != nil {
+		log.Printf("Rejected webhook event list: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = webhookEventStatusFailed
+	}
+	if !slices.Contains([]string{webhookEventStatusPending, webhookEventStatusProcessed, webhookEventStatusIgnored, webhookEventStatusFailed}, status) {
+		respondWithError(w, http.StatusBadRequest, "Status must be 'pending', 'processed', 'ignored' or 'failed'.")
+		return
+	}
+
+	limit, err := parseListLimit(r, defaultWebhookEventListLimit, maxWebhookEventListLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid limit: "+err.Error()+".")
+		return
+	}
+
+	events, err := cfg.db.ListWebhookEventsByStatus(r.Context(), database.ListWebhookEventsByStatusParams{
+		Status: status,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error listing webhook events: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	eventResponses := make([]WebhookEventResponse, 0, len(events))
+	for _, event := range events {
+		eventResponses = append(eventResponses, newWebhookEventResponse(event))
+	}
+
+	respondWithJSON(w, http.StatusOK, eventResponses)
+}
+
+// applies a failed webhook event again, e.g. once the bug that failed it is fixed
+// responds with the event as it is afterwards, which may have failed again
+func (cfg *apiConfig) handlerReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	err := cfg.authenticateAdmin(r)
+	if err != nil {
+		log.Printf("Rejected webhook event replay: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	provider := r.PathValue("provider")
+	eventID := r.PathValue("id")
+	event, err := cfg.db.GetWebhookEvent(r.Context(), database.GetWebhookEventParams{
+		Provider: provider,
+		ID:       eventID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Webhook event not found.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting %s event '%s': %s", provider, eventID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	if event.Status != webhookEventStatusFailed {
+		respondWithError(w, http.StatusConflict, "Only failed webhook events can be replayed.")
+		return
+	}
+
+	webhookProvider, ok := cfg.webhookProviders[event.Provider]
+	if !ok {
+		log.Printf("Unable to replay %s event '%s': the provider is unknown", provider, eventID)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	// parsed again, so a fix to the provider's parsing applies to the replay too
+	parsed, err := webhookProvider.Parse(event.Payload)
+	if err != nil {
+		log.Printf("Unable to replay %s event '%s': %s", provider, eventID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+	parsed.ID = event.ID
+
+	_, err = cfg.processWebhookEvent(r.Context(), event.Provider, parsed, event.Payload)
+	if err != nil && !errors.Is(err, errWebhookEventDuplicate) {
+		log.Printf("Replayed %s event '%s' failed again: %s", provider, eventID, err)
+	}
+
+	event, err = cfg.db.GetWebhookEvent(r.Context(), database.GetWebhookEventParams{
+		Provider: provider,
+		ID:       eventID,
+	})
+	if err != nil {
+		log.Printf("Error getting %s event '%s': %s", provider, eventID, err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong.")
+		return
+	}
+
+	log.Printf("Replayed %s event '%s', it is now %s.", provider, eventID, event.Status)
+	respondWithJSON(w, http.StatusOK, newWebhookEventResponse(event))
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nicholasss/chirpy/internal/database"
+)
+
+// reads a provider's payload from testdata/webhooks
+func readWebhookFixture(t *testing.T, provider, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", "webhooks", provider, name+".json"))
+	if err != nil {
+		t.Fatalf("Unable to read fixture '%s/%s': %s", provider, name, err)
+	}
+
+	return body
+}
+
+func TestWebhookSecretsFromEnv(t *testing.T) {
+	var tests = []struct {
+		value    string
+		expected []string
+	}{
+		{"", []string{}},
+		{"one", []string{"one"}},
+		{" new , old ,", []string{"new", "old"}},
+	}
+
+	for _, test := range tests {
+		t.Setenv("POLKA_WEBHOOK_SECRETS", test.value)
+		received := webhookSecretsFromEnv("POLKA_WEBHOOK_SECRETS")
+		if !slices.Equal(received, test.expected) {
+			t.Errorf("Expected '%v', received '%v'", test.expected, received)
+		}
+	}
+}
+
+func TestWebhookNonce(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded"}`)
+
+	if webhookNonce("1700000000", body) != webhookNonce("1700000000", body) {
+		t.Errorf("Expected the same delivery to have the same nonce")
+	}
+	if webhookNonce("1700000000", body) == webhookNonce("1700000001", body) {
+		t.Errorf("Expected another timestamp to have another nonce")
+	}
+	if webhookNonce("1700000000", body) == webhookNonce("1700000000", []byte(`{}`)) {
+		t.Errorf("Expected another body to have another nonce")
+	}
+}
+
+func TestNewWebhookEventResponse(t *testing.T) {
+	receivedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	event := database.WebhookEvent{
+		Provider:   webhookProviderPolka,
+		ID:         "evt_1",
+		EventType:  "user.upgraded",
+		Payload:    json.RawMessage(`{"id":"evt_1"}`),
+		Status:     webhookEventStatusFailed,
+		Error:      sql.NullString{String: "connection reset", Valid: true},
+		Attempts:   2,
+		ReceivedAt: receivedAt,
+	}
+
+	actual := newWebhookEventResponse(event)
+	if actual.Error != "connection reset" {
+		t.Errorf("Expected '%s', received '%s'", "connection reset", actual.Error)
+	}
+	if actual.ProcessedAt != nil {
+		t.Errorf("Expected no processed_at, received '%s'", actual.ProcessedAt)
+	}
+
+	event.Status = webhookEventStatusProcessed
+	event.Error = sql.NullString{}
+	event.ProcessedAt = sql.NullTime{Time: receivedAt.Add(time.Minute), Valid: true}
+	actual = newWebhookEventResponse(event)
+	if actual.ProcessedAt == nil || !actual.ProcessedAt.Equal(event.ProcessedAt.Time) {
+		t.Errorf("Expected processed_at '%s', received '%v'", event.ProcessedAt.Time, actual.ProcessedAt)
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestParseListLimit(t *testing.T) {
+	var tests = []struct {
+		query     string
+		expected  int
+		expectErr bool
+	}{
+		{"", 50, false},
+		{"?limit=10", 10, false},
+		{"?limit=500", 500, false},
+		{"?limit=0", 0, true},
+		{"?limit=501", 0, true},
+		{"?limit=ten", 0, true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/"+test.query, nil)
+
+		actual, err := parseListLimit(r, 50, 500)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Query '%s', expected error: %t, Got: '%v'", test.query, test.expectErr, err)
+		}
+		if err != nil && err.Error() != "limit must be between 1 and 500" {
+			t.Errorf("Expected '%s', received '%s'", "limit must be between 1 and 500", err)
+		}
+		if err == nil && actual != test.expected {
+			t.Errorf("Expected: %d, Got: %d", test.expected, actual)
+		}
+	}
+}
+
+func TestHandlerListWebhookEventsRejects(t *testing.T) {
+	var tests = []struct {
+		adminAPIKey  string
+		header       string
+		target       string
+		expectedCode int
+	}{
+		{"", "ApiKey ", "/admin/webhooks/events", http.StatusUnauthorized},
+		{"key", "ApiKey wrong", "/admin/webhooks/events", http.StatusUnauthorized},
+		{"key", "ApiKey key", "/admin/webhooks/events?status=lost", http.StatusBadRequest},
+		{"key", "ApiKey key", "/admin/webhooks/events?limit=0", http.StatusBadRequest},
+		{"key", "ApiKey key", "/admin/webhooks/events?limit=501", http.StatusBadRequest},
+		{"key", "ApiKey key", "/admin/webhooks/events?limit=ten", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		cfg := apiConfig{adminAPIKey: test.adminAPIKey}
+		r := httptest.NewRequest(http.MethodGet, test.target, nil)
+		r.Header.Set("Authorization", test.header)
+		w := httptest.NewRecorder()
+
+		cfg.handlerListWebhookEvents(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Target '%s', expected: %d, Got: %d", test.target, test.expectedCode, actualCode)
+		}
+	}
+}
+
+func TestHandlerReplayWebhookEventRejects(t *testing.T) {
+	cfg := apiConfig{adminAPIKey: "key"}
+	r := httptest.NewRequest(http.MethodPost, "/admin/webhooks/events/polka/evt_1/replay", nil)
+	r.Header.Set("Authorization", "ApiKey wrong")
+	r.SetPathValue("provider", "polka")
+	r.SetPathValue("id", "evt_1")
+	w := httptest.NewRecorder()
+
+	cfg.handlerReplayWebhookEvent(w, r)
+
+	_, actualCode := readResponse(w, t)
+	if actualCode != http.StatusUnauthorized {
+		t.Errorf("Expected: %d, Got: %d", http.StatusUnauthorized, actualCode)
+	}
+}
+
+// only covers the checks made before the database is touched
+func TestHandlerWebhookRejects(t *testing.T) {
+	cfg := apiConfig{webhookProviders: newWebhookProviders(
+		polkaProvider{key: "polka-key"},
+		kiwiProvider{},
+	)}
+
+	var tests = []struct {
+		provider     string
+		key          string
+		body         string
+		expectedCode int
+	}{
+		{"stripe", "polka-key", `{}`, http.StatusNotFound},
+		{"polka", "wrong-key", string(readWebhookFixture(t, "polka", "upgraded")), http.StatusUnauthorized},
+		{"polka", "polka-key", `not json`, http.StatusBadRequest},
+		// kiwi is not configured, so nothing from it is trusted
+		{"kiwi", "polka-key", string(readWebhookFixture(t, "kiwi", "invoice_paid")), http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/webhooks/"+test.provider, strings.NewReader(test.body))
+		r.SetPathValue("provider", test.provider)
+		r.Header.Set("Authorization", "ApiKey "+test.key)
+		w := httptest.NewRecorder()
+
+		cfg.handlerWebhook(w, r)
+
+		_, actualCode := readResponse(w, t)
+		if actualCode != test.expectedCode {
+			t.Errorf("Provider '%s', expected: %d, Got: %d", test.provider, test.expectedCode, actualCode)
+		}
+	}
+}